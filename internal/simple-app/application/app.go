@@ -5,6 +5,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
+	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 
@@ -12,6 +16,11 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	exportPageSize  = 100
+	importChunkSize = 100
+)
+
 var _ domain.ApplicationInterface = (*Application)(nil)
 
 type Application struct {
@@ -26,63 +35,109 @@ func NewApplication(logger *zap.Logger, storage domain.UserStorage) *Application
 	}
 }
 
-func (a Application) GetUser(ctx context.Context, id uuid.UUID) (name string, err error) {
+func (a Application) GetUser(ctx context.Context, id uuid.UUID) (user domain.User, err error) {
 	strID := id.String()
 
-	name, err = a.storage.Read(ctx, strID)
+	user, err = a.storage.Read(ctx, strID)
 	if err == nil || errors.Is(err, domain.ErrorNotFound) {
 		return
 	}
 
 	a.logger.Error("error getting user", zap.String("id", strID), zap.Error(err))
 
-	return name, fmt.Errorf("error getting message: %s", id)
+	return user, hide(err, "error getting message: %s", id)
 }
 
-func (a Application) CreateUser(ctx context.Context, name string) (id uuid.UUID, err error) {
+func (a Application) CreateUser(ctx context.Context, name, email string, expiresAt time.Time) (id uuid.UUID, err error) {
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return id, err
+	}
+
+	expiresAt, err = validateExpiry(expiresAt)
+	if err != nil {
+		return id, err
+	}
+
 	id, err = uuid.NewUUID()
 	if err != nil {
 		a.logger.Error("error generating uuid", zap.Error(err), zap.String("name", name))
 		return id, fmt.Errorf("error generating id")
 	}
 
-	err = a.storage.Store(ctx, id.String(), name)
+	user := domain.User{ID: id, Name: name, Email: email, ExpiresAt: expiresAt}
+
+	err = a.storage.Store(ctx, user, domain.NewEvent(ctx, domain.EventUserCreated, id.String(), name))
 	if err != nil {
+		if errors.Is(err, domain.ErrorConflict) {
+			return uuid.Nil, err
+		}
+
 		a.logger.Error("error creating user", zap.Error(err), zap.String("id", id.String()), zap.String("name", name))
-		return id, fmt.Errorf("error creating user")
+		return id, hide(err, "error creating user")
 	}
 
 	return
 }
 
-func (a Application) UpdateUser(ctx context.Context, id uuid.UUID, name string) (err error) {
+// UpdateUser replaces the user, a nil expiresAt keeps the expiry it has and a zero one keeps the user for good
+func (a Application) UpdateUser(
+	ctx context.Context,
+	id uuid.UUID,
+	name, email string,
+	expiresAt *time.Time,
+) (user domain.User, err error) {
 	strID := id.String()
 
-	_, err = a.storage.Read(ctx, strID)
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return user, err
+	}
+
+	var expiry time.Time
+
+	if expiresAt != nil {
+		expiry, err = validateExpiry(*expiresAt)
+		if err != nil {
+			return user, err
+		}
+	}
+
+	stored, err := a.storage.Read(ctx, strID)
 	if err != nil {
 		if errors.Is(err, domain.ErrorNotFound) {
-			return
+			return user, err
 		}
 
 		a.logger.Error("error updating user", zap.Error(err), zap.String("id", strID), zap.String("name", name))
 
-		return fmt.Errorf("error getting user")
+		return user, hide(err, "error getting user")
+	}
+
+	if expiresAt == nil {
+		expiry = stored.ExpiresAt
 	}
 
-	err = a.storage.Store(ctx, strID, name)
+	user = domain.User{ID: id, Name: name, Email: email, ExpiresAt: expiry}
+
+	err = a.storage.Store(ctx, user, domain.NewEvent(ctx, domain.EventUserUpdated, strID, name))
 	if err != nil {
+		if errors.Is(err, domain.ErrorConflict) {
+			return domain.User{}, err
+		}
+
 		a.logger.Error("error updating user", zap.Error(err), zap.String("id", strID), zap.String("name", name))
 
-		return fmt.Errorf("error updating user")
+		return domain.User{}, hide(err, "error updating user")
 	}
 
-	return
+	return user, nil
 }
 
 func (a Application) DeleteUser(ctx context.Context, id uuid.UUID) (err error) {
 	strID := id.String()
 
-	err = a.storage.Delete(ctx, strID)
+	err = a.storage.Delete(ctx, strID, domain.NewEvent(ctx, domain.EventUserDeleted, strID, ""))
 	if err != nil {
 		if errors.Is(err, domain.ErrorNotFound) {
 			return
@@ -90,8 +145,359 @@ func (a Application) DeleteUser(ctx context.Context, id uuid.UUID) (err error) {
 
 		a.logger.Error("error deleting user", zap.Error(err), zap.String("id", strID))
 
-		return fmt.Errorf("error deleting user")
+		return hide(err, "error deleting user")
 	}
 
 	return
 }
+
+func (a Application) ListUsers(ctx context.Context, cursor string, limit int) (users []domain.User, next string, err error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("%w: limit must be positive", domain.ErrorInvalidInput)
+	}
+
+	users, next, err = a.storage.List(ctx, cursor, limit)
+	if err == nil || errors.Is(err, domain.ErrorInvalidInput) {
+		return
+	}
+
+	a.logger.Error("error listing users", zap.Error(err), zap.String("cursor", cursor))
+
+	return nil, "", hide(err, "error listing users")
+}
+
+func (a Application) SearchUsers(ctx context.Context, query domain.NameQuery, limit int) (users []domain.User, err error) {
+	switch {
+	case query.Name == "":
+		return nil, fmt.Errorf("%w: name must not be empty", domain.ErrorInvalidInput)
+	case limit <= 0:
+		return nil, fmt.Errorf("%w: limit must be positive", domain.ErrorInvalidInput)
+	}
+
+	users, err = a.storage.Search(ctx, query, limit)
+	if errors.Is(err, domain.ErrorInvalidInput) {
+		// the storage may not be able to search, e.g. while names are encrypted
+		return nil, err
+	}
+
+	if err != nil {
+		a.logger.Error("error searching users", zap.Error(err), zap.String("name", query.Name))
+
+		return nil, hide(err, "error searching users")
+	}
+
+	return users, nil
+}
+
+func (a Application) BatchUsers(
+	ctx context.Context,
+	operations []domain.BatchOperation,
+	atomic bool,
+) (results []domain.BatchResult, err error) {
+	results = make([]domain.BatchResult, len(operations))
+	mutations := make([]domain.UserMutation, 0, len(operations))
+	// positions maps every mutation back to the operation it came from
+	positions := make([]int, 0, len(operations))
+	invalid := false
+
+	for i, operation := range operations {
+		var mutation domain.UserMutation
+
+		mutation, results[i], err = a.toMutation(ctx, operation)
+		if err != nil {
+			return nil, err
+		}
+
+		if results[i].Err != nil {
+			invalid = true
+
+			continue
+		}
+
+		mutations = append(mutations, mutation)
+		positions = append(positions, i)
+	}
+
+	if atomic && invalid {
+		abort(results)
+
+		return results, nil
+	}
+
+	if len(mutations) == 0 {
+		return results, nil
+	}
+
+	errs, err := a.storage.Batch(ctx, mutations, atomic)
+	if err != nil {
+		a.logger.Error("error applying batch", zap.Error(err), zap.Int("size", len(mutations)))
+
+		return nil, hide(err, "error applying batch")
+	}
+
+	for i, position := range positions {
+		results[position].Err = errs[i]
+	}
+
+	return results, nil
+}
+
+func (a Application) toMutation(
+	ctx context.Context,
+	operation domain.BatchOperation,
+) (mutation domain.UserMutation, result domain.BatchResult, err error) {
+	result.ID = operation.ID
+
+	switch operation.Op {
+	case domain.BatchCreate:
+		if operation.Name == "" {
+			result.Err = fmt.Errorf("%w: create needs a name", domain.ErrorInvalidInput)
+
+			return mutation, result, nil
+		}
+
+		result.ID, err = uuid.NewUUID()
+		if err != nil {
+			a.logger.Error("error generating uuid", zap.Error(err), zap.String("name", operation.Name))
+
+			return mutation, result, fmt.Errorf("error generating id")
+		}
+	case domain.BatchUpdate, domain.BatchDelete:
+		if operation.ID == uuid.Nil {
+			result.Err = fmt.Errorf("%w: %s needs an id", domain.ErrorInvalidInput, operation.Op)
+
+			return mutation, result, nil
+		}
+
+		if operation.Op == domain.BatchUpdate && operation.Name == "" {
+			result.Err = fmt.Errorf("%w: update needs a name", domain.ErrorInvalidInput)
+
+			return mutation, result, nil
+		}
+	default:
+		result.Err = fmt.Errorf("%w: unknown operation %q", domain.ErrorInvalidInput, operation.Op)
+
+		return mutation, result, nil
+	}
+
+	email, err := normalizeEmail(operation.Email)
+	if err != nil {
+		result.Err = err
+
+		return mutation, result, nil
+	}
+
+	strID := result.ID.String()
+
+	var expiresAt time.Time
+
+	switch {
+	case operation.ExpiresAt != nil:
+		expiresAt, err = validateExpiry(*operation.ExpiresAt)
+		if err != nil {
+			result.Err = err
+
+			return mutation, result, nil
+		}
+	case operation.Op == domain.BatchUpdate:
+		// like UpdateUser, an update without expiry keeps the one the user has
+		stored, readErr := a.storage.Read(ctx, strID)
+		if readErr != nil {
+			if errors.Is(readErr, domain.ErrorNotFound) {
+				result.Err = readErr
+
+				return mutation, result, nil
+			}
+
+			a.logger.Error("error applying batch", zap.Error(readErr), zap.String("id", strID))
+
+			return mutation, result, hide(readErr, "error getting user")
+		}
+
+		expiresAt = stored.ExpiresAt
+	}
+
+	mutation = domain.UserMutation{
+		Op:        operation.Op,
+		ID:        strID,
+		Name:      operation.Name,
+		Email:     email,
+		ExpiresAt: expiresAt,
+	}
+
+	switch operation.Op {
+	case domain.BatchCreate:
+		mutation.Event = domain.NewEvent(ctx, domain.EventUserCreated, strID, operation.Name)
+	case domain.BatchUpdate:
+		mutation.Event = domain.NewEvent(ctx, domain.EventUserUpdated, strID, operation.Name)
+	case domain.BatchDelete:
+		mutation.Name, mutation.Email, mutation.ExpiresAt = "", "", time.Time{}
+		mutation.Event = domain.NewEvent(ctx, domain.EventUserDeleted, strID, "")
+	}
+
+	return mutation, result, nil
+}
+
+// abort marks every operation that did not fail on its own as aborted
+func abort(results []domain.BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = domain.ErrorAborted
+		}
+	}
+}
+
+func (a Application) ExportUsers(ctx context.Context) iter.Seq2[domain.User, error] {
+	return func(yield func(domain.User, error) bool) {
+		for user, err := range domain.AllUsers(ctx, a.storage, exportPageSize) {
+			if err != nil {
+				a.logger.Error("error exporting users", zap.Error(err))
+				yield(domain.User{}, hide(err, "error exporting users"))
+
+				return
+			}
+
+			if !yield(user, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (a Application) ImportUsers(
+	ctx context.Context,
+	records iter.Seq[domain.ImportRecord],
+	report func(domain.ImportResult) error,
+) (err error) {
+	// results are held back until the chunk is stored, so they are reported in input order
+	results := make([]domain.ImportResult, 0, importChunkSize)
+	mutations := make([]domain.UserMutation, 0, importChunkSize)
+	positions := make([]int, 0, importChunkSize)
+
+	flush := func() error {
+		if len(mutations) > 0 {
+			errs, err := a.storage.Batch(ctx, mutations, false)
+			if err != nil {
+				a.logger.Error("error importing users", zap.Error(err), zap.Int("line", results[positions[0]].Line))
+
+				return hide(err, "error importing users")
+			}
+
+			for i, position := range positions {
+				results[position].Err = errs[i]
+			}
+		}
+
+		for _, result := range results {
+			err := report(result)
+			if err != nil {
+				return err
+			}
+		}
+
+		results = results[:0]
+		mutations = mutations[:0]
+		positions = positions[:0]
+
+		return nil
+	}
+
+	for record := range records {
+		user, err := validateImport(record)
+		result := domain.ImportResult{
+			Line: record.Line,
+			ID:   record.User.ID,
+			Err:  err,
+		}
+
+		if result.Err == nil {
+			strID := user.ID.String()
+			mutations = append(mutations, domain.UserMutation{
+				Op:        domain.BatchCreate,
+				ID:        strID,
+				Name:      user.Name,
+				Email:     user.Email,
+				ExpiresAt: user.ExpiresAt,
+				Event:     domain.NewEvent(ctx, domain.EventUserCreated, strID, user.Name),
+			})
+			positions = append(positions, len(results))
+		}
+
+		results = append(results, result)
+
+		if len(results) == importChunkSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+// validateImport checks the record and returns its user with the email and expiry normalized,
+// users that expired since they were exported are rejected like any expiry in the past
+func validateImport(record domain.ImportRecord) (user domain.User, err error) {
+	switch {
+	case record.Err != nil:
+		return user, record.Err
+	case record.User.ID == uuid.Nil:
+		return user, fmt.Errorf("%w: id is missing", domain.ErrorInvalidInput)
+	case record.User.Name == "":
+		return user, fmt.Errorf("%w: name is missing", domain.ErrorInvalidInput)
+	}
+
+	user = record.User
+
+	user.Email, err = normalizeEmail(user.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user.ExpiresAt, err = validateExpiry(user.ExpiresAt)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// normalizeEmail accepts a bare address or nothing, display names like "Jo <jo@example.com>" are rejected
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("%w: malformed email %q", domain.ErrorInvalidInput, email)
+	}
+
+	return email, nil
+}
+
+// validateExpiry accepts no expiry or one in the future, cut to the milliseconds the storages keep
+func validateExpiry(expiresAt time.Time) (time.Time, error) {
+	if expiresAt.IsZero() {
+		return time.Time{}, nil
+	}
+
+	if !expiresAt.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("%w: expiry must be in the future", domain.ErrorInvalidInput)
+	}
+
+	return expiresAt.UTC().Truncate(time.Millisecond), nil
+}
+
+// hide replaces a storage error with a message of its own, only an unavailable storage comes through,
+// so the drivers can ask to try again later
+func hide(err error, format string, args ...any) error {
+	var unavailable domain.UnavailableError
+	if errors.As(err, &unavailable) {
+		return fmt.Errorf(format+": %w", append(args, unavailable)...)
+	}
+
+	return fmt.Errorf(format, args...)
+}
@@ -2,8 +2,13 @@ package application
 
 import (
 	"context"
+	"fmt"
+	"iter"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
 
 	"github.com/brianvoe/gofakeit/v6"
@@ -21,41 +26,373 @@ func TestCreateGetUpdateAndDeleteUser(t *testing.T) {
 
 	t.Run("create user", func(t *testing.T) {
 		name := gofakeit.Username()
-		storage.On("Store", ctx, mock.Anything, name).Return(nil).Once()
-		id, err := app.CreateUser(ctx, name)
+		email := gofakeit.Email()
+		storage.On("Store", ctx, mock.MatchedBy(func(user domain.User) bool {
+			return user.ID != uuid.Nil && user.Name == name && user.Email == email
+		}), eventOfType(domain.EventUserCreated)).Return(nil).Once()
+		id, err := app.CreateUser(ctx, name, " "+email, time.Time{})
 		require.NoError(t, err)
 		require.NotEmpty(t, id)
 	})
 
+	t.Run("create user with malformed email", func(t *testing.T) {
+		_, err := app.CreateUser(ctx, gofakeit.Username(), "Jo <jo@example.com>", time.Time{})
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("create expiring user", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		storage.On("Store", ctx, mock.MatchedBy(func(user domain.User) bool {
+			return user.ExpiresAt.Equal(expiresAt.Truncate(time.Millisecond)) && user.ExpiresAt.Location() == time.UTC
+		}), eventOfType(domain.EventUserCreated)).Return(nil).Once()
+		_, err := app.CreateUser(ctx, gofakeit.Username(), "", expiresAt)
+		require.NoError(t, err)
+	})
+
+	t.Run("create user expiring in the past", func(t *testing.T) {
+		_, err := app.CreateUser(ctx, gofakeit.Username(), "", time.Now().Add(-time.Second))
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("create user with taken email", func(t *testing.T) {
+		name := gofakeit.Username()
+		storage.On("Store", ctx, mock.Anything, mock.Anything).Return(domain.ErrorConflict).Once()
+		_, err := app.CreateUser(ctx, name, gofakeit.Email(), time.Time{})
+		require.ErrorIs(t, err, domain.ErrorConflict)
+	})
+
 	t.Run("get user", func(t *testing.T) {
 		id, err := uuid.NewUUID()
 		require.NoError(t, err)
-		name := gofakeit.Username()
-		storage.On("Read", ctx, id.String()).Return(name, nil).Once()
-		storedName, err := app.GetUser(ctx, id)
+		user := domain.User{ID: id, Name: gofakeit.Username(), Email: gofakeit.Email()}
+		storage.On("Read", ctx, id.String()).Return(user, nil).Once()
+		stored, err := app.GetUser(ctx, id)
 		require.NoError(t, err)
-		require.Equal(t, name, storedName)
+		require.Equal(t, user, stored)
 	})
 
 	t.Run("update user", func(t *testing.T) {
 		id, err := uuid.NewUUID()
 		require.NoError(t, err)
-		name := gofakeit.Username()
-		storage.On("Read", ctx, id.String()).Return(name, nil).Once()
-		newName := gofakeit.Username()
-		storage.On("Store", ctx, id.String(), newName).Return(nil).Once()
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id, Name: gofakeit.Username()}, nil).Once()
+		updated := domain.User{ID: id, Name: gofakeit.Username(), Email: gofakeit.Email()}
+		storage.On("Store", ctx, updated, eventOfType(domain.EventUserUpdated)).Return(nil).Once()
+
+		user, err := app.UpdateUser(ctx, id, updated.Name, updated.Email, &time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, updated, user)
+	})
 
-		err = app.UpdateUser(ctx, id, newName)
+	t.Run("update user to expire", func(t *testing.T) {
+		id := uuid.New()
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id}, nil).Once()
+		updated := domain.User{ID: id, Name: gofakeit.Username(), ExpiresAt: expiresAt}
+		storage.On("Store", ctx, updated, eventOfType(domain.EventUserUpdated)).Return(nil).Once()
+
+		user, err := app.UpdateUser(ctx, id, updated.Name, "", &expiresAt)
+		require.NoError(t, err)
+		require.Equal(t, updated, user)
+	})
+
+	t.Run("update user keeping the expiry", func(t *testing.T) {
+		id := uuid.New()
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id, ExpiresAt: expiresAt}, nil).Once()
+		updated := domain.User{ID: id, Name: gofakeit.Username(), ExpiresAt: expiresAt}
+		storage.On("Store", ctx, updated, eventOfType(domain.EventUserUpdated)).Return(nil).Once()
+
+		user, err := app.UpdateUser(ctx, id, updated.Name, "", nil)
 		require.NoError(t, err)
+		require.Equal(t, updated, user)
+	})
+
+	t.Run("update user with taken email", func(t *testing.T) {
+		id := uuid.New()
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id}, nil).Once()
+		storage.On("Store", ctx, mock.Anything, mock.Anything).Return(domain.ErrorConflict).Once()
+
+		_, err := app.UpdateUser(ctx, id, gofakeit.Username(), gofakeit.Email(), nil)
+		require.ErrorIs(t, err, domain.ErrorConflict)
+	})
+
+	t.Run("get user while storage is unavailable", func(t *testing.T) {
+		id := uuid.New()
+		unavailable := fmt.Errorf("%w: connection refused", domain.UnavailableError{RetryAfter: time.Second})
+		storage.On("Read", ctx, id.String()).Return(domain.User{}, unavailable).Once()
+
+		_, err := app.GetUser(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorUnavailable)
+		require.Equal(t, time.Second, domain.RetryAfter(err))
+		require.NotContains(t, err.Error(), "connection refused")
 	})
 
 	t.Run("delete user", func(t *testing.T) {
 		id, err := uuid.NewUUID()
 		require.NoError(t, err)
-		storage.On("Delete", ctx, id.String()).Return(nil).Once()
+		storage.On("Delete", ctx, id.String(), eventOfType(domain.EventUserDeleted)).Return(nil).Once()
 		err = app.DeleteUser(ctx, id)
 		require.NoError(t, err)
 	})
 
+	t.Run("list users", func(t *testing.T) {
+		users := []domain.User{{ID: uuid.New(), Name: gofakeit.Username()}}
+		storage.On("List", ctx, "", 10).Return(users, "42", nil).Once()
+		listed, next, err := app.ListUsers(ctx, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, users, listed)
+		require.Equal(t, "42", next)
+	})
+
+	t.Run("search users", func(t *testing.T) {
+		query := domain.NameQuery{Name: gofakeit.Username(), Prefix: true}
+		users := []domain.User{{ID: uuid.New(), Name: query.Name}}
+		storage.On("Search", ctx, query, 10).Return(users, nil).Once()
+		found, err := app.SearchUsers(ctx, query, 10)
+		require.NoError(t, err)
+		require.Equal(t, users, found)
+	})
+
+	t.Run("search users without name", func(t *testing.T) {
+		_, err := app.SearchUsers(ctx, domain.NameQuery{Prefix: true}, 10)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("search users the storage cannot search", func(t *testing.T) {
+		query := domain.NameQuery{Name: gofakeit.Username()}
+		storage.On("Search", ctx, query, 10).Return(nil, domain.ErrorInvalidInput).Once()
+		_, err := app.SearchUsers(ctx, query, 10)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("list users with invalid limit", func(t *testing.T) {
+		_, _, err := app.ListUsers(ctx, "", 0)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
 	storage.AssertExpectations(t)
 }
+
+func TestBatchUsers(t *testing.T) {
+	storage := new(mocks.UserStorage)
+	logger := zaptest.NewLogger(t)
+	app := NewApplication(logger, storage)
+	ctx := context.Background()
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	t.Run("best effort batch skips invalid operations", func(t *testing.T) {
+		storage.On("Batch", ctx, mock.MatchedBy(func(mutations []domain.UserMutation) bool {
+			return len(mutations) == 2 &&
+				mutations[0].Op == domain.BatchCreate && mutations[0].Event.Type == domain.EventUserCreated &&
+				mutations[1].ID == id.String() && mutations[1].Event.Type == domain.EventUserDeleted
+		}), false).Return([]error{nil, domain.ErrorNotFound}, nil).Once()
+
+		results, err := app.BatchUsers(ctx, []domain.BatchOperation{
+			{Op: domain.BatchCreate, Name: name},
+			{Op: domain.BatchUpdate, Name: name},
+			{Op: domain.BatchDelete, ID: id},
+		}, false)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.NoError(t, results[0].Err)
+		require.NotEqual(t, uuid.Nil, results[0].ID)
+		require.ErrorIs(t, results[1].Err, domain.ErrorInvalidInput)
+		require.ErrorIs(t, results[2].Err, domain.ErrorNotFound)
+		require.Equal(t, id, results[2].ID)
+	})
+
+	t.Run("atomic batch with invalid operation is aborted", func(t *testing.T) {
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id, Name: name}, nil).Once()
+
+		results, err := app.BatchUsers(ctx, []domain.BatchOperation{
+			{Op: domain.BatchUpdate, ID: id, Name: name},
+			{Op: "rename", ID: id},
+		}, true)
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0].Err, domain.ErrorAborted)
+		require.ErrorIs(t, results[1].Err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("expiry is validated and passed on", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		storage.On("Batch", ctx, mock.MatchedBy(func(mutations []domain.UserMutation) bool {
+			return len(mutations) == 1 && mutations[0].ExpiresAt.Equal(expiresAt)
+		}), false).Return([]error{nil}, nil).Once()
+
+		expired := time.Now().Add(-time.Second)
+
+		results, err := app.BatchUsers(ctx, []domain.BatchOperation{
+			{Op: domain.BatchCreate, Name: name, ExpiresAt: &expiresAt},
+			{Op: domain.BatchUpdate, ID: id, Name: name, ExpiresAt: &expired},
+		}, false)
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		require.ErrorIs(t, results[1].Err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("update without expiry keeps the one the user has", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		missing := uuid.New()
+
+		storage.On("Read", ctx, id.String()).Return(domain.User{ID: id, Name: name, ExpiresAt: expiresAt}, nil).Once()
+		storage.On("Read", ctx, missing.String()).Return(domain.User{}, domain.ErrorNotFound).Once()
+		storage.On("Batch", ctx, mock.MatchedBy(func(mutations []domain.UserMutation) bool {
+			return len(mutations) == 2 && mutations[0].ExpiresAt.Equal(expiresAt) && mutations[1].ExpiresAt.IsZero()
+		}), false).Return([]error{nil, nil}, nil).Once()
+
+		results, err := app.BatchUsers(ctx, []domain.BatchOperation{
+			{Op: domain.BatchUpdate, ID: id, Name: name},
+			{Op: domain.BatchUpdate, ID: id, Name: name, ExpiresAt: &time.Time{}},
+			{Op: domain.BatchUpdate, ID: missing, Name: name},
+		}, false)
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		require.NoError(t, results[1].Err)
+		require.ErrorIs(t, results[2].Err, domain.ErrorNotFound)
+	})
+
+	t.Run("error in storage", func(t *testing.T) {
+		storage.On("Batch", ctx, mock.Anything, true).Return(nil, fmt.Errorf("some error")).Once()
+		_, err := app.BatchUsers(ctx, []domain.BatchOperation{{Op: domain.BatchDelete, ID: id}}, true)
+		require.Error(t, err)
+	})
+
+	storage.AssertExpectations(t)
+}
+
+func TestExportUsers(t *testing.T) {
+	storage := new(mocks.UserStorage)
+	logger := zaptest.NewLogger(t)
+	app := NewApplication(logger, storage)
+	ctx := context.Background()
+	first := []domain.User{{ID: uuid.New(), Name: gofakeit.Username()}}
+	second := []domain.User{{ID: uuid.New(), Name: gofakeit.Username()}}
+
+	t.Run("walks every page", func(t *testing.T) {
+		storage.On("List", ctx, "", exportPageSize).Return(first, "7", nil).Once()
+		storage.On("List", ctx, "7", exportPageSize).Return(second, "", nil).Once()
+
+		var users []domain.User
+
+		for user, err := range app.ExportUsers(ctx) {
+			require.NoError(t, err)
+
+			users = append(users, user)
+		}
+
+		require.Equal(t, append(first, second...), users)
+	})
+
+	t.Run("stops at error in storage", func(t *testing.T) {
+		storage.On("List", ctx, "", exportPageSize).Return(first, "7", nil).Once()
+		storage.On("List", ctx, "7", exportPageSize).Return(nil, "", fmt.Errorf("some error")).Once()
+
+		var errs []error
+
+		for _, err := range app.ExportUsers(ctx) {
+			errs = append(errs, err)
+		}
+
+		require.Len(t, errs, 2)
+		require.NoError(t, errs[0])
+		require.Error(t, errs[1])
+	})
+
+	storage.AssertExpectations(t)
+}
+
+func TestImportUsers(t *testing.T) {
+	storage := new(mocks.UserStorage)
+	logger := zaptest.NewLogger(t)
+	app := NewApplication(logger, storage)
+	ctx := context.Background()
+	user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+	records := func(records ...domain.ImportRecord) iter.Seq[domain.ImportRecord] {
+		return slices.Values(records)
+	}
+
+	t.Run("reports every record in order", func(t *testing.T) {
+		storage.On("Batch", ctx, mock.MatchedBy(func(mutations []domain.UserMutation) bool {
+			return len(mutations) == 1 && mutations[0].ID == user.ID.String() && mutations[0].Name == user.Name &&
+				mutations[0].Event.Type == domain.EventUserCreated
+		}), false).Return([]error{nil}, nil).Once()
+
+		var results []domain.ImportResult
+
+		err := app.ImportUsers(ctx, records(
+			domain.ImportRecord{Line: 1, Err: domain.ErrorInvalidInput},
+			domain.ImportRecord{Line: 2, User: user},
+			domain.ImportRecord{Line: 3, User: domain.User{ID: user.ID}},
+		), func(result domain.ImportResult) error {
+			results = append(results, result)
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.Equal(t, []int{1, 2, 3}, []int{results[0].Line, results[1].Line, results[2].Line})
+		require.ErrorIs(t, results[0].Err, domain.ErrorInvalidInput)
+		require.NoError(t, results[1].Err)
+		require.Equal(t, user.ID, results[1].ID)
+		require.ErrorIs(t, results[2].Err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("stores in chunks", func(t *testing.T) {
+		storage.On("Batch", ctx, mock.Anything, false).Return(make([]error, importChunkSize), nil).Once()
+		storage.On("Batch", ctx, mock.Anything, false).Return([]error{nil}, nil).Once()
+
+		all := make([]domain.ImportRecord, importChunkSize+1)
+		for i := range all {
+			all[i] = domain.ImportRecord{Line: i + 1, User: domain.User{ID: uuid.New(), Name: gofakeit.Username()}}
+		}
+
+		reported := 0
+		err := app.ImportUsers(ctx, records(all...), func(domain.ImportResult) error {
+			reported++
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, importChunkSize+1, reported)
+	})
+
+	t.Run("keeps the expiry", func(t *testing.T) {
+		expiring := domain.User{ID: uuid.New(), Name: gofakeit.Username(), ExpiresAt: time.Now().Add(time.Hour)}
+		storage.On("Batch", ctx, mock.MatchedBy(func(mutations []domain.UserMutation) bool {
+			return len(mutations) == 1 && mutations[0].ExpiresAt.Equal(expiring.ExpiresAt.Truncate(time.Millisecond))
+		}), false).Return([]error{nil}, nil).Once()
+
+		var results []domain.ImportResult
+
+		err := app.ImportUsers(ctx, records(
+			domain.ImportRecord{Line: 1, User: expiring},
+			domain.ImportRecord{Line: 2, User: domain.User{ID: uuid.New(), Name: gofakeit.Username(), ExpiresAt: time.Now().Add(-time.Hour)}},
+		), func(result domain.ImportResult) error {
+			results = append(results, result)
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.NoError(t, results[0].Err)
+		require.ErrorIs(t, results[1].Err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("error in storage", func(t *testing.T) {
+		storage.On("Batch", ctx, mock.Anything, false).Return(nil, fmt.Errorf("some error")).Once()
+		err := app.ImportUsers(ctx, records(domain.ImportRecord{Line: 1, User: user}), func(domain.ImportResult) error {
+			return nil
+		})
+		require.Error(t, err)
+	})
+
+	storage.AssertExpectations(t)
+}
+
+func eventOfType(eventType domain.EventType) interface{} {
+	return mock.MatchedBy(func(event domain.Event) bool {
+		return event.Type == eventType && event.ID != ""
+	})
+}
@@ -0,0 +1,95 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+)
+
+// ConflictPolicy is what a restore does with a user that exists already
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch ConflictPolicy(policy) {
+	case ConflictOverwrite, ConflictSkip, ConflictFail:
+		return ConflictPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("%w: unknown conflict policy %q, expected %s, %s or %s",
+		domain.ErrorInvalidInput, policy, ConflictOverwrite, ConflictSkip, ConflictFail)
+}
+
+// RestoreReport counts what happened to the users of a restore, Expired users expired while they were backed up
+type RestoreReport struct {
+	Restored int
+	Skipped  int
+	Expired  int
+	Failed   int
+}
+
+// RestoreUsers writes the users straight into the storage, as they were backed up. A restore brings back a state
+// rather than changing users, so no events are sent. Users whose email another user has taken meanwhile
+// are handed to failed, with ConflictFail they stop the restore like users that exist, the users restored before stay.
+func RestoreUsers(
+	ctx context.Context,
+	storage domain.UserStorage,
+	users iter.Seq2[domain.User, error],
+	policy ConflictPolicy,
+	failed func(user domain.User, err error),
+) (report RestoreReport, err error) {
+	for user, err := range users {
+		if err != nil {
+			return report, err
+		}
+
+		if !user.ExpiresAt.IsZero() && !user.ExpiresAt.After(time.Now()) {
+			report.Expired++
+
+			continue
+		}
+
+		if policy != ConflictOverwrite {
+			_, err = storage.Read(ctx, user.ID.String())
+
+			switch {
+			case err == nil && policy == ConflictSkip:
+				report.Skipped++
+
+				continue
+			case err == nil:
+				return report, fmt.Errorf("%w: user %s exists", domain.ErrorConflict, user.ID)
+			case !errors.Is(err, domain.ErrorNotFound):
+				return report, fmt.Errorf("error reading user %s: %w", user.ID, err)
+			}
+		}
+
+		err = storage.Store(ctx, user)
+
+		switch {
+		case err == nil:
+			report.Restored++
+		case errors.Is(err, domain.ErrorConflict):
+			// a taken email or a full tenant
+			if policy == ConflictFail {
+				return report, fmt.Errorf("error restoring user %s: %w", user.ID, err)
+			}
+
+			report.Failed++
+			failed(user, err)
+		default:
+			return report, fmt.Errorf("error restoring user %s: %w", user.ID, err)
+		}
+	}
+
+	return report, nil
+}
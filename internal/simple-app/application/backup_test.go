@@ -0,0 +1,100 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreUsers(t *testing.T) {
+	ctx := context.Background()
+	existing := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+	missing := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()}
+	expired := domain.User{ID: uuid.New(), Name: gofakeit.Username(), ExpiresAt: time.Now().Add(-time.Second)}
+
+	backup := func(users ...domain.User) iter.Seq2[domain.User, error] {
+		return func(yield func(domain.User, error) bool) {
+			for _, user := range users {
+				if !yield(user, nil) {
+					return
+				}
+			}
+		}
+	}
+
+	noFailures := func(t *testing.T) func(domain.User, error) {
+		return func(user domain.User, err error) {
+			t.Errorf("user %s failed: %s", user.ID, err)
+		}
+	}
+
+	t.Run("overwrite", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Store", ctx, existing).Return(nil).Once()
+		storage.On("Store", ctx, missing).Return(nil).Once()
+
+		report, err := RestoreUsers(ctx, storage, backup(existing, missing, expired), ConflictOverwrite, noFailures(t))
+		require.NoError(t, err)
+		require.Equal(t, RestoreReport{Restored: 2, Expired: 1}, report)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", ctx, existing.ID.String()).Return(existing, nil).Once()
+		storage.On("Read", ctx, missing.ID.String()).Return(domain.User{}, domain.ErrorNotFound).Once()
+		storage.On("Store", ctx, missing).Return(nil).Once()
+
+		report, err := RestoreUsers(ctx, storage, backup(existing, missing), ConflictSkip, noFailures(t))
+		require.NoError(t, err)
+		require.Equal(t, RestoreReport{Restored: 1, Skipped: 1}, report)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", ctx, missing.ID.String()).Return(domain.User{}, domain.ErrorNotFound).Once()
+		storage.On("Store", ctx, missing).Return(nil).Once()
+		storage.On("Read", ctx, existing.ID.String()).Return(existing, nil).Once()
+
+		report, err := RestoreUsers(ctx, storage, backup(missing, existing, expired), ConflictFail, noFailures(t))
+		require.ErrorIs(t, err, domain.ErrorConflict)
+		require.Equal(t, RestoreReport{Restored: 1}, report)
+	})
+
+	t.Run("taken email", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Store", ctx, missing).Return(domain.ErrorConflict).Once()
+
+		var failed []uuid.UUID
+
+		report, err := RestoreUsers(ctx, storage, backup(missing), ConflictOverwrite, func(user domain.User, err error) {
+			require.ErrorIs(t, err, domain.ErrorConflict)
+
+			failed = append(failed, user.ID)
+		})
+		require.NoError(t, err)
+		require.Equal(t, RestoreReport{Failed: 1}, report)
+		require.Equal(t, []uuid.UUID{missing.ID}, failed)
+	})
+
+	t.Run("error in storage", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Store", ctx, missing).Return(errors.New("some error")).Once()
+
+		_, err := RestoreUsers(ctx, storage, backup(missing), ConflictOverwrite, noFailures(t))
+		require.Error(t, err)
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, err := ParseConflictPolicy("merge")
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+}
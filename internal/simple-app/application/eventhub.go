@@ -0,0 +1,292 @@
+package application
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var _ domain.EventSubscriber = (*EventHub)(nil)
+
+var errEventHubStopped = errors.New("event hub is stopped")
+
+// EventHub tails the event stream once per replica and fans the events out to its subscribers.
+// Every replica reads the shared stream, so subscribers see changes made through any of them.
+type EventHub struct {
+	logger *zap.Logger
+	stream domain.EventStream
+	cfg    config.EventsConfig
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	stopped     bool
+}
+
+type subscriber struct {
+	live chan domain.StreamEvent
+}
+
+func NewEventHub(lc fx.Lifecycle, cfg *config.Config, logger *zap.Logger, stream domain.EventStream) *EventHub {
+	h := &EventHub{
+		logger:      logger,
+		stream:      stream,
+		cfg:         cfg.Events,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				h.run(ctx)
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			h.stop()
+
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return fmt.Errorf("error stopping event hub: %w", stopCtx.Err())
+			}
+		},
+	})
+
+	return h
+}
+
+func (h *EventHub) Subscribe(ctx context.Context, lastEventID string) (<-chan domain.StreamEvent, error) {
+	if lastEventID != "" {
+		if _, _, err := parseStreamID(lastEventID); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &subscriber{
+		live: make(chan domain.StreamEvent, h.cfg.Buffer),
+	}
+
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+
+		return nil, errEventHubStopped
+	}
+
+	// registered before the replay, so nothing added in the meantime is missed
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	events := make(chan domain.StreamEvent)
+
+	go h.pump(ctx, sub, lastEventID, events)
+
+	return events, nil
+}
+
+func (h *EventHub) pump(ctx context.Context, sub *subscriber, lastEventID string, events chan<- domain.StreamEvent) {
+	defer close(events)
+	defer h.unsubscribe(sub)
+
+	tenant := domain.TenantFromContext(ctx)
+
+	send := func(event domain.StreamEvent) bool {
+		// the stream is shared, subscribers only see the events of their own tenant
+		if event.Event.Tenant != tenant {
+			return true
+		}
+
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	last := lastEventID
+
+	for last != "" {
+		replayed, err := h.stream.RangeEvents(ctx, last, h.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Error("error replaying events", zap.Error(err), zap.String("last_event_id", last))
+			}
+
+			return
+		}
+
+		for _, event := range replayed {
+			if !send(event) {
+				return
+			}
+
+			last = event.StreamID
+		}
+
+		if len(replayed) < h.cfg.BatchSize {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.live:
+			if !ok {
+				return
+			}
+
+			if last != "" && compareStreamIDs(event.StreamID, last) <= 0 {
+				continue
+			}
+
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+func (h *EventHub) run(ctx context.Context) {
+	// "$" would be read afresh on every call, losing the events added between two reads
+	lastID, ok := h.lastEventID(ctx)
+	if !ok {
+		return
+	}
+
+	for ctx.Err() == nil {
+		events, err := h.stream.ReadEvents(ctx, lastID, h.cfg.BatchSize, h.cfg.Block)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			h.logger.Error("error reading event stream", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(h.cfg.Block):
+			}
+
+			continue
+		}
+
+		for _, event := range events {
+			h.broadcast(event)
+			lastID = event.StreamID
+		}
+	}
+}
+
+// lastEventID finds where the stream ends when the hub starts, retrying until it does or ctx is done
+func (h *EventHub) lastEventID(ctx context.Context) (string, bool) {
+	for {
+		id, err := h.stream.LastEventID(ctx)
+		if err == nil {
+			return id, true
+		}
+
+		if ctx.Err() != nil {
+			return "", false
+		}
+
+		h.logger.Error("error reading event stream", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-time.After(h.cfg.Block):
+		}
+	}
+}
+
+func (h *EventHub) broadcast(event domain.StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.live <- event:
+		default:
+			// a slow subscriber is cut off instead of stalling everyone, it resumes from its last event id
+			h.logger.Warn("dropping slow event subscriber", zap.String("stream_id", event.StreamID))
+			delete(h.subscribers, sub)
+			close(sub.live)
+		}
+	}
+}
+
+func (h *EventHub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.live)
+	}
+}
+
+func (h *EventHub) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stopped = true
+
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.live)
+	}
+}
+
+// parseStreamID splits a stream id of the form <milliseconds>-<sequence>
+func parseStreamID(id string) (ms, seq uint64, err error) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+
+	ms, msErr := strconv.ParseUint(msPart, 10, 64)
+	if msErr != nil {
+		return 0, 0, fmt.Errorf("%w: malformed event id %q", domain.ErrorInvalidInput, id)
+	}
+
+	if !found {
+		return ms, 0, nil
+	}
+
+	seq, seqErr := strconv.ParseUint(seqPart, 10, 64)
+	if seqErr != nil {
+		return 0, 0, fmt.Errorf("%w: malformed event id %q", domain.ErrorInvalidInput, id)
+	}
+
+	return ms, seq, nil
+}
+
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq, _ := parseStreamID(a)
+	bMs, bSeq, _ := parseStreamID(b)
+
+	if c := cmp.Compare(aMs, bMs); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(aSeq, bSeq)
+}
@@ -0,0 +1,156 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEventHub(t *testing.T) {
+	cfg := &config.Config{
+		Events: config.EventsConfig{
+			Block:     10 * time.Millisecond,
+			BatchSize: 10,
+			Buffer:    2,
+		},
+	}
+
+	newStreamEvent := func(streamID string) domain.StreamEvent {
+		return domain.StreamEvent{
+			StreamID: streamID,
+			Event:    domain.NewEvent(context.Background(), domain.EventUserUpdated, gofakeit.UUID(), gofakeit.Username()),
+		}
+	}
+
+	receive := func(t *testing.T, events <-chan domain.StreamEvent) domain.StreamEvent {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "subscription ended")
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "no event received")
+		}
+
+		return domain.StreamEvent{}
+	}
+
+	t.Run("fans out the stream", func(t *testing.T) {
+		ctx := context.Background()
+		lc := fxtest.NewLifecycle(t)
+		stream := mocks.NewEventStream(t)
+		hub := NewEventHub(lc, cfg, zaptest.NewLogger(t), stream)
+		event := newStreamEvent("1700000000000-0")
+
+		stream.On("LastEventID", mock.Anything).Return("1699999999999-0", nil).Once()
+		stream.On("ReadEvents", mock.Anything, "1699999999999-0", 10, cfg.Events.Block).Return([]domain.StreamEvent{event}, nil).Once()
+		stream.On("ReadEvents", mock.Anything, event.StreamID, 10, cfg.Events.Block).
+			Return(nil, nil).After(cfg.Events.Block).Maybe()
+
+		first, err := hub.Subscribe(ctx, "")
+		require.NoError(t, err)
+		second, err := hub.Subscribe(ctx, "")
+		require.NoError(t, err)
+
+		lc.RequireStart()
+
+		require.Equal(t, event, receive(t, first))
+		require.Equal(t, event, receive(t, second))
+
+		lc.RequireStop()
+
+		_, ok := <-first
+		require.False(t, ok)
+
+		_, err = hub.Subscribe(ctx, "")
+		require.ErrorIs(t, err, errEventHubStopped)
+	})
+
+	t.Run("replays before following", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream := mocks.NewEventStream(t)
+		hub := NewEventHub(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), stream)
+		missed := newStreamEvent("1700000000001-0")
+		next := newStreamEvent("1700000000001-1")
+
+		stream.On("RangeEvents", mock.Anything, "1700000000000-0", 10).Return([]domain.StreamEvent{missed}, nil).Once()
+
+		events, err := hub.Subscribe(ctx, "1700000000000-0")
+		require.NoError(t, err)
+
+		// the replayed event also arrives live and must not be sent twice
+		hub.broadcast(missed)
+		hub.broadcast(next)
+
+		require.Equal(t, missed, receive(t, events))
+		require.Equal(t, next, receive(t, events))
+	})
+
+	t.Run("keeps tenants apart", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(domain.WithTenant(context.Background(), "acme"))
+		defer cancel()
+
+		stream := mocks.NewEventStream(t)
+		hub := NewEventHub(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), stream)
+		other := domain.StreamEvent{
+			StreamID: "1700000000002-0",
+			Event:    domain.NewEvent(domain.WithTenant(context.Background(), "globex"), domain.EventUserCreated, gofakeit.UUID(), ""),
+		}
+		own := domain.StreamEvent{
+			StreamID: "1700000000002-1",
+			Event:    domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), ""),
+		}
+
+		events, err := hub.Subscribe(ctx, "")
+		require.NoError(t, err)
+
+		hub.broadcast(other)
+		hub.broadcast(own)
+
+		require.Equal(t, own, receive(t, events))
+	})
+
+	t.Run("malformed last event id", func(t *testing.T) {
+		hub := NewEventHub(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), mocks.NewEventStream(t))
+
+		_, err := hub.Subscribe(context.Background(), "yesterday")
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("drops slow subscriber", func(t *testing.T) {
+		hub := NewEventHub(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), mocks.NewEventStream(t))
+
+		events, err := hub.Subscribe(context.Background(), "")
+		require.NoError(t, err)
+
+		for i := range 10 {
+			hub.broadcast(newStreamEvent(fmt.Sprintf("1700000000000-%d", i)))
+		}
+
+		received := 0
+		for range events {
+			received++
+		}
+
+		require.Less(t, received, 10)
+	})
+}
+
+func TestCompareStreamIDs(t *testing.T) {
+	require.Equal(t, -1, compareStreamIDs("1-9", "2-0"))
+	require.Equal(t, -1, compareStreamIDs("1-2", "1-10"))
+	require.Equal(t, 0, compareStreamIDs("5", "5-0"))
+	require.Equal(t, 1, compareStreamIDs("10-0", "9-99"))
+}
@@ -0,0 +1,103 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ExpirySweeper deletes the users whose expiry has passed and emits a user.expired event for each of them.
+// The storages hide expired users right away, the sweeper only cleans up after them, so a late sweep delays the events,
+// not the expiry. Sweepers of several replicas may run at once, every user is expired by one of them.
+type ExpirySweeper struct {
+	logger    *zap.Logger
+	storage   domain.UserExpiry
+	interval  time.Duration
+	batchSize int
+}
+
+func NewExpirySweeper(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	logger *zap.Logger,
+	storage domain.UserExpiry,
+) *ExpirySweeper {
+	s := &ExpirySweeper{
+		logger:    logger,
+		storage:   storage,
+		interval:  cfg.Expiry.Interval,
+		batchSize: cfg.Expiry.BatchSize,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				s.run(ctx)
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return fmt.Errorf("error stopping expiry sweeper: %w", stopCtx.Err())
+			}
+		},
+	})
+
+	return s
+}
+
+func (s *ExpirySweeper) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			expired, err := s.Sweep(ctx)
+			if err != nil {
+				s.logger.Error("error sweeping expired users", zap.Error(err))
+				break
+			}
+
+			if expired < s.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// Sweep expires one batch of users
+func (s *ExpirySweeper) Sweep(ctx context.Context) (expired int, err error) {
+	expired, err = s.storage.ExpireUsers(ctx, time.Now(), s.batchSize, expiredEvent)
+	if err != nil {
+		return 0, fmt.Errorf("error expiring users: %w", err)
+	}
+
+	return expired, nil
+}
+
+// expiredEvent carries no name, like the events of deleted users
+func expiredEvent(ctx context.Context, id string) domain.Event {
+	return domain.NewEvent(ctx, domain.EventUserExpired, id, "")
+}
@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExpirySweeper(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Expiry: config.ExpiryConfig{
+			Interval:  time.Hour,
+			BatchSize: 10,
+		},
+	}
+
+	t.Run("expires users with expiry events", func(t *testing.T) {
+		storage := mocks.NewUserExpiry(t)
+		sweeper := NewExpirySweeper(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), storage)
+		id := gofakeit.UUID()
+
+		storage.On("ExpireUsers", ctx, mock.AnythingOfType("time.Time"), 10, mock.Anything).
+			Run(func(args mock.Arguments) {
+				event := args.Get(3).(domain.ExpiryEvent)(domain.WithTenant(ctx, "acme"), id)
+				require.Equal(t, domain.EventUserExpired, event.Type)
+				require.Equal(t, id, event.UserID)
+				require.Equal(t, "acme", event.Tenant)
+				require.Empty(t, event.Name)
+			}).Return(1, nil).Once()
+
+		expired, err := sweeper.Sweep(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, expired)
+	})
+
+	t.Run("error in storage", func(t *testing.T) {
+		storage := mocks.NewUserExpiry(t)
+		sweeper := NewExpirySweeper(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), storage)
+
+		storage.On("ExpireUsers", ctx, mock.Anything, 10, mock.Anything).Return(0, errors.New("some error")).Once()
+
+		_, err := sweeper.Sweep(ctx)
+		require.Error(t, err)
+	})
+
+	t.Run("sweeps in background until a batch is not full", func(t *testing.T) {
+		storage := mocks.NewUserExpiry(t)
+		lc := fxtest.NewLifecycle(t)
+		NewExpirySweeper(lc, &config.Config{
+			Expiry: config.ExpiryConfig{
+				Interval:  10 * time.Millisecond,
+				BatchSize: 10,
+			},
+		}, zaptest.NewLogger(t), storage)
+
+		swept := make(chan struct{})
+
+		storage.On("ExpireUsers", mock.Anything, mock.Anything, 10, mock.Anything).Return(10, nil).Once()
+		storage.On("ExpireUsers", mock.Anything, mock.Anything, 10, mock.Anything).
+			Run(func(mock.Arguments) { close(swept) }).Return(3, nil).Once()
+		storage.On("ExpireUsers", mock.Anything, mock.Anything, 10, mock.Anything).Return(0, nil)
+
+		lc.RequireStart()
+
+		select {
+		case <-swept:
+		case <-time.After(time.Second):
+			t.Fatal("users were not swept")
+		}
+
+		lc.RequireStop()
+	})
+}
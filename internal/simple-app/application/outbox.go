@@ -0,0 +1,148 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// OutboxRelay moves events from the outbox to the publishers.
+// Delivery is at-least-once: an event is acked only after every publisher accepted it,
+// so publishers may see an event again if another one failed.
+// Every replica runs a relay, only the one holding the lease of the outbox relays it.
+type OutboxRelay struct {
+	logger     *zap.Logger
+	outbox     domain.Outbox
+	publishers []domain.EventPublisher
+	owner      string
+	interval   time.Duration
+	batchSize  int
+	lease      time.Duration
+}
+
+func NewOutboxRelay(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	logger *zap.Logger,
+	outbox domain.Outbox,
+	publishers []domain.EventPublisher,
+) *OutboxRelay {
+	r := &OutboxRelay{
+		logger:     logger,
+		outbox:     outbox,
+		publishers: publishers,
+		owner:      uuid.NewString(),
+		interval:   cfg.Outbox.Interval,
+		batchSize:  cfg.Outbox.BatchSize,
+		lease:      cfg.Outbox.Lease,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				r.run(ctx)
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return fmt.Errorf("error stopping outbox relay: %w", stopCtx.Err())
+			}
+		},
+	})
+
+	return r
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			delivered, err := r.Relay(ctx)
+			if err != nil {
+				r.logger.Error("error relaying events", zap.Error(err))
+				break
+			}
+
+			if delivered < r.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// Relay delivers one batch of pending events in order and stops at the first failed one.
+// It delivers nothing while the relay of another replica holds the lease.
+func (r *OutboxRelay) Relay(ctx context.Context) (delivered int, err error) {
+	held, err := r.outbox.LeaseRelay(ctx, r.owner, r.lease)
+	if err != nil {
+		return 0, fmt.Errorf("error leasing outbox: %w", err)
+	}
+
+	if !held {
+		return 0, nil
+	}
+
+	events, err := r.outbox.Pending(ctx, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error reading outbox: %w", err)
+	}
+
+	ids := make([]string, 0, len(events))
+
+	var deliverErr error
+
+	for _, event := range events {
+		deliverErr = r.deliver(ctx, event)
+		if deliverErr != nil {
+			break
+		}
+
+		ids = append(ids, event.ID)
+	}
+
+	if len(ids) > 0 {
+		err = r.outbox.Ack(ctx, ids...)
+		if err != nil {
+			return 0, fmt.Errorf("error acking events: %w", err)
+		}
+	}
+
+	return len(ids), deliverErr
+}
+
+func (r *OutboxRelay) deliver(ctx context.Context, event domain.Event) error {
+	for _, publisher := range r.publishers {
+		err := publisher.Publish(ctx, event)
+		if err != nil {
+			return fmt.Errorf("error publishing event %s: %w", event.ID, err)
+		}
+	}
+
+	return nil
+}
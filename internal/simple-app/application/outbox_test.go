@@ -0,0 +1,107 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Outbox: config.OutboxConfig{
+			Interval:  time.Hour,
+			BatchSize: 10,
+		},
+	}
+
+	created := domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), gofakeit.Username())
+	deleted := domain.NewEvent(ctx, domain.EventUserDeleted, gofakeit.UUID(), "")
+
+	t.Run("delivers and acks events", func(t *testing.T) {
+		outbox := mocks.NewOutbox(t)
+		publisher := mocks.NewEventPublisher(t)
+		relay := NewOutboxRelay(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), outbox, []domain.EventPublisher{publisher})
+
+		outbox.On("LeaseRelay", ctx, relay.owner, cfg.Outbox.Lease).Return(true, nil).Once()
+		outbox.On("Pending", ctx, 10).Return([]domain.Event{created, deleted}, nil).Once()
+		publisher.On("Publish", ctx, created).Return(nil).Once()
+		publisher.On("Publish", ctx, deleted).Return(nil).Once()
+		outbox.On("Ack", ctx, created.ID, deleted.ID).Return(nil).Once()
+
+		delivered, err := relay.Relay(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, delivered)
+	})
+
+	t.Run("leaves the outbox to the lease holder", func(t *testing.T) {
+		outbox := mocks.NewOutbox(t)
+		publisher := mocks.NewEventPublisher(t)
+		relay := NewOutboxRelay(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), outbox, []domain.EventPublisher{publisher})
+
+		outbox.On("LeaseRelay", ctx, relay.owner, cfg.Outbox.Lease).Return(false, nil).Once()
+
+		delivered, err := relay.Relay(ctx)
+		require.NoError(t, err)
+		require.Zero(t, delivered)
+	})
+
+	t.Run("stops at first failed event", func(t *testing.T) {
+		outbox := mocks.NewOutbox(t)
+		publisher := mocks.NewEventPublisher(t)
+		relay := NewOutboxRelay(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), outbox, []domain.EventPublisher{publisher})
+
+		outbox.On("LeaseRelay", ctx, relay.owner, cfg.Outbox.Lease).Return(true, nil).Once()
+		outbox.On("Pending", ctx, 10).Return([]domain.Event{created, deleted}, nil).Once()
+		publisher.On("Publish", ctx, created).Return(nil).Once()
+		publisher.On("Publish", ctx, deleted).Return(errors.New("sink is down")).Once()
+		outbox.On("Ack", ctx, created.ID).Return(nil).Once()
+
+		delivered, err := relay.Relay(ctx)
+		require.Error(t, err)
+		require.Equal(t, 1, delivered)
+	})
+
+	t.Run("relays in background", func(t *testing.T) {
+		outbox := mocks.NewOutbox(t)
+		publisher := mocks.NewEventPublisher(t)
+		lc := fxtest.NewLifecycle(t)
+		NewOutboxRelay(lc, &config.Config{
+			Outbox: config.OutboxConfig{
+				Interval:  10 * time.Millisecond,
+				BatchSize: 10,
+			},
+		}, zaptest.NewLogger(t), outbox, []domain.EventPublisher{publisher})
+
+		published := make(chan struct{})
+
+		outbox.On("LeaseRelay", mock.Anything, mock.Anything, time.Duration(0)).Return(true, nil)
+		outbox.On("Pending", mock.Anything, 10).Return([]domain.Event{created}, nil).Once()
+		publisher.On("Publish", mock.Anything, created).Return(nil).Once().Run(func(mock.Arguments) {
+			close(published)
+		})
+		outbox.On("Ack", mock.Anything, created.ID).Return(nil).Once()
+		outbox.On("Pending", mock.Anything, 10).Return(nil, nil)
+
+		lc.RequireStart()
+
+		select {
+		case <-published:
+		case <-time.After(time.Second):
+			require.Fail(t, "event was not published")
+		}
+
+		lc.RequireStop()
+	})
+}
@@ -0,0 +1,57 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"go.uber.org/zap"
+)
+
+var _ domain.TenantApplicationInterface = (*TenantApplication)(nil)
+
+type TenantApplication struct {
+	logger  *zap.Logger
+	storage domain.TenantStorage
+}
+
+func NewTenantApplication(logger *zap.Logger, storage domain.TenantStorage) *TenantApplication {
+	return &TenantApplication{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+func (a TenantApplication) ListTenants(ctx context.Context) ([]domain.TenantInfo, error) {
+	tenants, err := a.storage.Tenants(ctx)
+	if err != nil {
+		a.logger.Error("error listing tenants", zap.Error(err))
+
+		return nil, hide(err, "error listing tenants")
+	}
+
+	return tenants, nil
+}
+
+func (a TenantApplication) PurgeTenant(ctx context.Context, tenant string) (int64, error) {
+	err := domain.ValidateTenant(tenant)
+	if err != nil {
+		return 0, err
+	}
+
+	users, err := a.storage.PurgeTenant(ctx, tenant)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return 0, err
+		}
+
+		a.logger.Error("error purging tenant", zap.Error(err), zap.String("tenant", tenant))
+
+		return 0, hide(err, "error purging tenant %s", tenant)
+	}
+
+	a.logger.Info("purged tenant", zap.String("tenant", tenant), zap.Int64("users", users))
+
+	return users, nil
+}
@@ -0,0 +1,57 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTenantApplication(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewTenantStorage(t)
+	app := NewTenantApplication(zaptest.NewLogger(t), storage)
+
+	t.Run("list tenants", func(t *testing.T) {
+		tenants := []domain.TenantInfo{{Name: "acme", Users: 3, Quota: 10}}
+		storage.On("Tenants", ctx).Return(tenants, nil).Once()
+
+		listed, err := app.ListTenants(ctx)
+		require.NoError(t, err)
+		require.Equal(t, tenants, listed)
+	})
+
+	t.Run("list error is hidden", func(t *testing.T) {
+		storageErr := errors.New("connection reset by peer")
+		storage.On("Tenants", ctx).Return(nil, storageErr).Once()
+
+		_, err := app.ListTenants(ctx)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, storageErr)
+	})
+
+	t.Run("purge tenant", func(t *testing.T) {
+		storage.On("PurgeTenant", ctx, "acme").Return(int64(3), nil).Once()
+
+		users, err := app.PurgeTenant(ctx, "acme")
+		require.NoError(t, err)
+		require.EqualValues(t, 3, users)
+	})
+
+	t.Run("purge unknown tenant", func(t *testing.T) {
+		storage.On("PurgeTenant", ctx, "globex").Return(int64(0), domain.ErrorNotFound).Once()
+
+		_, err := app.PurgeTenant(ctx, "globex")
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+	})
+
+	t.Run("malformed tenant", func(t *testing.T) {
+		_, err := app.PurgeTenant(ctx, "acme::*")
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+}
@@ -0,0 +1,211 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var _ domain.EventPublisher = (*WebhookPublisher)(nil)
+
+// WebhookPublisher queues a delivery for every webhook subscribed to the event
+type WebhookPublisher struct {
+	storage domain.WebhookStorage
+}
+
+func NewWebhookPublisher(storage domain.WebhookStorage) *WebhookPublisher {
+	return &WebhookPublisher{
+		storage: storage,
+	}
+}
+
+func (p WebhookPublisher) Publish(ctx context.Context, event domain.Event) error {
+	webhooks, err := p.storage.ListWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing webhooks: %w", err)
+	}
+
+	now := time.Now()
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(event.Type) {
+			continue
+		}
+
+		// the id is derived from the event, so a republished event does not queue a second delivery
+		err = p.storage.ScheduleDelivery(ctx, domain.WebhookDelivery{
+			ID:        event.ID + ":" + webhook.ID.String(),
+			WebhookID: webhook.ID.String(),
+			Event:     event,
+		}, now)
+		if err != nil {
+			return fmt.Errorf("error scheduling delivery to webhook %s: %w", webhook.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// WebhookDispatcher sends queued deliveries, retrying failed ones with exponential backoff
+// until they run out of attempts and are dead-lettered
+type WebhookDispatcher struct {
+	logger  *zap.Logger
+	storage domain.WebhookStorage
+	sender  domain.WebhookSender
+	cfg     config.WebhookConfig
+}
+
+func NewWebhookDispatcher(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	logger *zap.Logger,
+	storage domain.WebhookStorage,
+	sender domain.WebhookSender,
+) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		logger:  logger,
+		storage: storage,
+		sender:  sender,
+		cfg:     cfg.Webhook,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				d.run(ctx)
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return fmt.Errorf("error stopping webhook dispatcher: %w", stopCtx.Err())
+			}
+		},
+	})
+
+	return d
+}
+
+func (d *WebhookDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			claimed, err := d.Dispatch(ctx)
+			if err != nil {
+				d.logger.Error("error dispatching webhooks", zap.Error(err))
+				break
+			}
+
+			if claimed < d.cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// Dispatch claims one batch of due deliveries and sends them concurrently
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) (claimed int, err error) {
+	deliveries, err := d.storage.ClaimDeliveries(ctx, time.Now(), d.cfg.Lease, d.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error claiming deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			deliverErr := d.deliver(ctx, delivery)
+			if deliverErr != nil {
+				d.logger.Error("error delivering webhook", zap.Error(deliverErr),
+					zap.String("delivery_id", delivery.ID), zap.String("webhook_id", delivery.WebhookID))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery domain.WebhookDelivery) error {
+	webhook, err := d.storage.ReadWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			err = d.storage.DropDelivery(ctx, delivery.ID)
+			if err != nil {
+				return fmt.Errorf("error dropping delivery to deleted webhook: %w", err)
+			}
+
+			return nil
+		}
+
+		return fmt.Errorf("error reading webhook: %w", err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	statusCode, sendErr := d.sender.Send(sendCtx, webhook, delivery.Event)
+
+	cancel()
+
+	delivery.Attempt++
+	attempt := domain.DeliveryAttempt{
+		DeliveryID: delivery.ID,
+		EventID:    delivery.Event.ID,
+		EventType:  delivery.Event.Type,
+		Attempt:    delivery.Attempt,
+		StatusCode: statusCode,
+		Status:     domain.DeliverySucceeded,
+		At:         time.Now().UTC(),
+	}
+
+	var retryAt time.Time
+
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+		delivery.LastError = sendErr.Error()
+
+		if delivery.Attempt >= d.cfg.MaxAttempts {
+			attempt.Status = domain.DeliveryDead
+		} else {
+			attempt.Status = domain.DeliveryRetrying
+			retryAt = attempt.At.Add(domain.Backoff(d.cfg.BackoffBase, d.cfg.BackoffMax, delivery.Attempt))
+		}
+	}
+
+	err = d.storage.RecordAttempt(ctx, delivery, attempt, retryAt)
+	if err != nil {
+		return fmt.Errorf("error recording delivery attempt: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const webhookSecretSize = 32
+
+var _ domain.WebhookApplicationInterface = (*WebhookApplication)(nil)
+
+type WebhookApplication struct {
+	logger  *zap.Logger
+	storage domain.WebhookStorage
+}
+
+func NewWebhookApplication(logger *zap.Logger, storage domain.WebhookStorage) *WebhookApplication {
+	return &WebhookApplication{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+func (a WebhookApplication) CreateWebhook(ctx context.Context, webhookURL string, events []domain.EventType) (webhook domain.Webhook, err error) {
+	err = validateWebhook(webhookURL, events)
+	if err != nil {
+		return
+	}
+
+	secret := make([]byte, webhookSecretSize)
+
+	_, err = rand.Read(secret)
+	if err != nil {
+		a.logger.Error("error generating webhook secret", zap.Error(err))
+		return webhook, fmt.Errorf("error generating webhook secret")
+	}
+
+	webhook = domain.Webhook{
+		ID:        uuid.New(),
+		URL:       webhookURL,
+		Secret:    hex.EncodeToString(secret),
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = a.storage.StoreWebhook(ctx, webhook)
+	if err != nil {
+		a.logger.Error("error creating webhook", zap.Error(err), zap.String("url", webhookURL))
+		return webhook, fmt.Errorf("error creating webhook")
+	}
+
+	return
+}
+
+func (a WebhookApplication) GetWebhook(ctx context.Context, id uuid.UUID) (webhook domain.Webhook, err error) {
+	webhook, err = a.storage.ReadWebhook(ctx, id.String())
+	if err == nil || errors.Is(err, domain.ErrorNotFound) {
+		return
+	}
+
+	a.logger.Error("error getting webhook", zap.String("id", id.String()), zap.Error(err))
+
+	return webhook, fmt.Errorf("error getting webhook: %s", id)
+}
+
+func (a WebhookApplication) ListWebhooks(ctx context.Context) (webhooks []domain.Webhook, err error) {
+	webhooks, err = a.storage.ListWebhooks(ctx)
+	if err != nil {
+		a.logger.Error("error listing webhooks", zap.Error(err))
+		return nil, fmt.Errorf("error listing webhooks")
+	}
+
+	return
+}
+
+func (a WebhookApplication) UpdateWebhook(ctx context.Context, id uuid.UUID, webhookURL string, events []domain.EventType) (webhook domain.Webhook, err error) {
+	err = validateWebhook(webhookURL, events)
+	if err != nil {
+		return
+	}
+
+	webhook, err = a.GetWebhook(ctx, id)
+	if err != nil {
+		return
+	}
+
+	webhook.URL = webhookURL
+	webhook.Events = events
+
+	err = a.storage.StoreWebhook(ctx, webhook)
+	if err != nil {
+		a.logger.Error("error updating webhook", zap.Error(err), zap.String("id", webhook.ID.String()), zap.String("url", webhookURL))
+		return webhook, fmt.Errorf("error updating webhook")
+	}
+
+	return
+}
+
+func (a WebhookApplication) DeleteWebhook(ctx context.Context, id uuid.UUID) (err error) {
+	err = a.storage.DeleteWebhook(ctx, id.String())
+	if err == nil || errors.Is(err, domain.ErrorNotFound) {
+		return
+	}
+
+	a.logger.Error("error deleting webhook", zap.Error(err), zap.String("id", id.String()))
+
+	return fmt.Errorf("error deleting webhook")
+}
+
+func (a WebhookApplication) ListDeliveryAttempts(ctx context.Context, id uuid.UUID) (attempts []domain.DeliveryAttempt, err error) {
+	_, err = a.GetWebhook(ctx, id)
+	if err != nil {
+		return
+	}
+
+	attempts, err = a.storage.ListDeliveryAttempts(ctx, id.String())
+	if err != nil {
+		a.logger.Error("error listing webhook delivery attempts", zap.Error(err), zap.String("id", id.String()))
+		return nil, fmt.Errorf("error listing webhook delivery attempts")
+	}
+
+	return
+}
+
+func (a WebhookApplication) ListDeadLetters(ctx context.Context, id uuid.UUID) (deliveries []domain.WebhookDelivery, err error) {
+	_, err = a.GetWebhook(ctx, id)
+	if err != nil {
+		return
+	}
+
+	deliveries, err = a.storage.ListDeadLetters(ctx, id.String())
+	if err != nil {
+		a.logger.Error("error listing webhook dead letters", zap.Error(err), zap.String("id", id.String()))
+		return nil, fmt.Errorf("error listing webhook dead letters")
+	}
+
+	return
+}
+
+func validateWebhook(rawURL string, events []domain.EventType) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: webhook url must be an absolute http or https url", domain.ErrorInvalidInput)
+	}
+
+	for _, eventType := range events {
+		if !eventType.IsValid() {
+			return fmt.Errorf("%w: unknown event type %q", domain.ErrorInvalidInput, eventType)
+		}
+	}
+
+	return nil
+}
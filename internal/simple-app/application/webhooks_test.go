@@ -0,0 +1,178 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWebhookApplication(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewWebhookStorage(t)
+	app := NewWebhookApplication(zaptest.NewLogger(t), storage)
+
+	t.Run("create webhook", func(t *testing.T) {
+		url := gofakeit.URL()
+		storage.On("StoreWebhook", ctx, mock.MatchedBy(func(webhook domain.Webhook) bool {
+			return webhook.URL == url && len(webhook.Secret) == 2*webhookSecretSize
+		})).Return(nil).Once()
+
+		webhook, err := app.CreateWebhook(ctx, url, []domain.EventType{domain.EventUserCreated})
+		require.NoError(t, err)
+		require.NotEqual(t, uuid.Nil, webhook.ID)
+		require.NotEmpty(t, webhook.Secret)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := app.CreateWebhook(ctx, "ftp://"+gofakeit.DomainName(), nil)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("unknown event type", func(t *testing.T) {
+		_, err := app.CreateWebhook(ctx, gofakeit.URL(), []domain.EventType{"user.renamed"})
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("update webhook", func(t *testing.T) {
+		webhook := domain.Webhook{ID: uuid.New(), URL: gofakeit.URL(), Secret: gofakeit.Password(true, true, true, false, false, 32)}
+		url := gofakeit.URL()
+		storage.On("ReadWebhook", ctx, webhook.ID.String()).Return(webhook, nil).Once()
+		storage.On("StoreWebhook", ctx, mock.MatchedBy(func(updated domain.Webhook) bool {
+			return updated.ID == webhook.ID && updated.URL == url && updated.Secret == webhook.Secret
+		})).Return(nil).Once()
+
+		updated, err := app.UpdateWebhook(ctx, webhook.ID, url, nil)
+		require.NoError(t, err)
+		require.Equal(t, url, updated.URL)
+	})
+
+	t.Run("attempts of unknown webhook", func(t *testing.T) {
+		id := uuid.New()
+		storage.On("ReadWebhook", ctx, id.String()).Return(domain.Webhook{}, domain.ErrorNotFound).Once()
+
+		_, err := app.ListDeliveryAttempts(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+	})
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewWebhookStorage(t)
+	publisher := NewWebhookPublisher(storage)
+	event := domain.NewEvent(ctx, domain.EventUserDeleted, gofakeit.UUID(), "")
+
+	all := domain.Webhook{ID: uuid.New()}
+	deletes := domain.Webhook{ID: uuid.New(), Events: []domain.EventType{domain.EventUserDeleted}}
+	creates := domain.Webhook{ID: uuid.New(), Events: []domain.EventType{domain.EventUserCreated}}
+
+	storage.On("ListWebhooks", ctx).Return([]domain.Webhook{all, deletes, creates}, nil).Once()
+	storage.On("ScheduleDelivery", ctx, mock.MatchedBy(func(delivery domain.WebhookDelivery) bool {
+		return delivery.WebhookID == all.ID.String() && delivery.Event.ID == event.ID
+	}), mock.Anything).Return(nil).Once()
+	storage.On("ScheduleDelivery", ctx, mock.MatchedBy(func(delivery domain.WebhookDelivery) bool {
+		return delivery.WebhookID == deletes.ID.String() && delivery.Event.ID == event.ID
+	}), mock.Anything).Return(nil).Once()
+
+	err := publisher.Publish(ctx, event)
+	require.NoError(t, err)
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Webhook: config.WebhookConfig{
+			Interval:    time.Hour,
+			BatchSize:   10,
+			Timeout:     time.Second,
+			Lease:       time.Minute,
+			MaxAttempts: 3,
+			BackoffBase: time.Second,
+			BackoffMax:  time.Minute,
+		},
+	}
+	webhook := domain.Webhook{ID: uuid.New(), URL: gofakeit.URL(), Secret: gofakeit.Word()}
+	event := domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), gofakeit.Username())
+
+	newDelivery := func(attempt int) domain.WebhookDelivery {
+		return domain.WebhookDelivery{
+			ID:        event.ID + ":" + webhook.ID.String(),
+			WebhookID: webhook.ID.String(),
+			Event:     event,
+			Attempt:   attempt,
+		}
+	}
+
+	setup := func(t *testing.T) (*WebhookDispatcher, *mocks.WebhookStorage, *mocks.WebhookSender) {
+		storage := mocks.NewWebhookStorage(t)
+		sender := mocks.NewWebhookSender(t)
+
+		return NewWebhookDispatcher(fxtest.NewLifecycle(t), cfg, zaptest.NewLogger(t), storage, sender), storage, sender
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		dispatcher, storage, sender := setup(t)
+		storage.On("ClaimDeliveries", ctx, mock.Anything, time.Minute, 10).Return([]domain.WebhookDelivery{newDelivery(0)}, nil).Once()
+		storage.On("ReadWebhook", ctx, webhook.ID.String()).Return(webhook, nil).Once()
+		sender.On("Send", mock.Anything, webhook, event).Return(200, nil).Once()
+		storage.On("RecordAttempt", ctx, newDelivery(1), mock.MatchedBy(func(attempt domain.DeliveryAttempt) bool {
+			return attempt.Status == domain.DeliverySucceeded && attempt.Attempt == 1 && attempt.StatusCode == 200
+		}), time.Time{}).Return(nil).Once()
+
+		claimed, err := dispatcher.Dispatch(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, claimed)
+	})
+
+	t.Run("retried with backoff", func(t *testing.T) {
+		dispatcher, storage, sender := setup(t)
+		storage.On("ClaimDeliveries", ctx, mock.Anything, time.Minute, 10).Return([]domain.WebhookDelivery{newDelivery(1)}, nil).Once()
+		storage.On("ReadWebhook", ctx, webhook.ID.String()).Return(webhook, nil).Once()
+		sender.On("Send", mock.Anything, webhook, event).Return(500, errors.New("webhook responded with status 500")).Once()
+		storage.On("RecordAttempt", ctx, mock.MatchedBy(func(delivery domain.WebhookDelivery) bool {
+			return delivery.Attempt == 2 && delivery.LastError != ""
+		}), mock.MatchedBy(func(attempt domain.DeliveryAttempt) bool {
+			return attempt.Status == domain.DeliveryRetrying && attempt.StatusCode == 500
+		}), mock.MatchedBy(func(retryAt time.Time) bool {
+			// second attempt backs off between 1s and 2s
+			return retryAt.After(time.Now().Add(900*time.Millisecond)) && retryAt.Before(time.Now().Add(2100*time.Millisecond))
+		})).Return(nil).Once()
+
+		_, err := dispatcher.Dispatch(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("dead-lettered after max attempts", func(t *testing.T) {
+		dispatcher, storage, sender := setup(t)
+		storage.On("ClaimDeliveries", ctx, mock.Anything, time.Minute, 10).Return([]domain.WebhookDelivery{newDelivery(2)}, nil).Once()
+		storage.On("ReadWebhook", ctx, webhook.ID.String()).Return(webhook, nil).Once()
+		sender.On("Send", mock.Anything, webhook, event).Return(0, errors.New("connection refused")).Once()
+		storage.On("RecordAttempt", ctx, mock.Anything, mock.MatchedBy(func(attempt domain.DeliveryAttempt) bool {
+			return attempt.Status == domain.DeliveryDead && attempt.Attempt == 3
+		}), time.Time{}).Return(nil).Once()
+
+		_, err := dispatcher.Dispatch(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("dropped for deleted webhook", func(t *testing.T) {
+		dispatcher, storage, _ := setup(t)
+		storage.On("ClaimDeliveries", ctx, mock.Anything, time.Minute, 10).Return([]domain.WebhookDelivery{newDelivery(0)}, nil).Once()
+		storage.On("ReadWebhook", ctx, webhook.ID.String()).Return(domain.Webhook{}, domain.ErrorNotFound).Once()
+		storage.On("DropDelivery", ctx, newDelivery(0).ID).Return(nil).Once()
+
+		_, err := dispatcher.Dispatch(ctx)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/application"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver"
+
+	"go.uber.org/fx"
+)
+
+type command func(ctx context.Context, deps commandDeps, args []string) error
+
+// commandDeps is what the commands get from the core, Storage is the storage without the decorators.
+// App is nil for the storage commands, Redis is nil unless it is the storage and Keys is nil while encryption is disabled
+type commandDeps struct {
+	fx.In
+
+	Config  *config.Config
+	App     domain.ApplicationInterface `optional:"true"`
+	Storage userStorage
+	Redis   *driven.RedisStorage
+	Keys    *driven.KeyRing
+}
+
+// commands go through the application like the requests to the service
+var commands = map[string]command{
+	"export": exportCommand,
+	"import": importCommand,
+}
+
+// storageCommands work on the storage alone, they do without the application and the decorators in front of the storage
+var storageCommands = map[string]command{
+	"backup":         backupCommand,
+	"migrate":        migrateCommand,
+	"migrate-schema": migrateSchemaCommand,
+	"restore":        restoreCommand,
+	"rotate-keys":    rotateKeysCommand,
+}
+
+type tool func(ctx context.Context, args []string) error
+
+// tools are the commands that do without the storage, so they work while it cannot be reached
+var tools = map[string]tool{
+	"config":      configCommand,
+	"healthcheck": healthcheckCommand,
+	"serve":       serveCommand,
+	"version":     versionCommand,
+}
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// runCommand runs a command and returns the exit code, the commands other than the tools run against the storage
+func runCommand(name string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+
+	if run, ok := tools[name]; ok {
+		err = run(ctx, args)
+	} else if cmd, ok := commands[name]; ok {
+		err = runCoreCommand(ctx, createCore(), cmd, args)
+	} else if cmd, ok := storageCommands[name]; ok {
+		err = runCoreCommand(ctx, createStorage(), cmd, args)
+	} else {
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected %s\n", name, strings.Join(commandNames(), ", "))
+
+		return 2
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error running %s: %s\n", name, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// runCoreCommand runs the command with the storage, and the application of the service when core provides it
+func runCoreCommand(ctx context.Context, core fx.Option, cmd command, args []string) error {
+	var deps commandDeps
+
+	fxApp := fx.New(core, fx.Populate(&deps), fx.NopLogger)
+
+	err := fxApp.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting: %w", err)
+	}
+
+	defer func() {
+		_ = fxApp.Stop(context.Background())
+	}()
+
+	return cmd(ctx, deps, args)
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(tools)+len(commands)+len(storageCommands))
+
+	for name := range tools {
+		names = append(names, name)
+	}
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	for name := range storageCommands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// serveCommand runs the service until it is interrupted, it is what the binary does without a command
+func serveCommand(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	fx.New(createService()).Run()
+
+	return nil
+}
+
+// healthcheckCommand asks the health endpoint of the service whether it is ready, for a HEALTHCHECK of an image
+// without a shell or curl
+func healthcheckCommand(ctx context.Context, args []string) error {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	url := flags.String("url", "http://127.0.0.1:"+cfg.Port+"/", "health endpoint to ask")
+	timeout := flags.Duration("timeout", 3*time.Second, "time to wait for the answer")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error asking the service: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return fmt.Errorf("service is not healthy: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// configCommand prints the config the service would run with, secrets redacted
+func configCommand(_ context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("expected config print")
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, variable := range cfg.Environment() {
+		fmt.Println(variable)
+	}
+
+	return nil
+}
+
+// versionCommand prints the version of the binary and the commit it was built from
+func versionCommand(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	revision := "unknown"
+
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+
+	fmt.Printf("simple-app %s, commit %s, %s\n", version, revision, runtime.Version())
+
+	return nil
+}
+
+func exportCommand(ctx context.Context, deps commandDeps, args []string) (err error) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", string(driver.Ndjson), "output format, ndjson or csv")
+	output := flags.String("output", "-", "file to write, - for stdout")
+	tenant := flags.String("tenant", "", "tenant to export the users of")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	transferFormat, err := driver.ParseTransferFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating output: %w", err)
+		}
+
+		defer func() {
+			closeErr := file.Close()
+			if err == nil && closeErr != nil {
+				err = fmt.Errorf("error closing output: %w", closeErr)
+			}
+		}()
+
+		w = file
+	}
+
+	return driver.WriteUsers(ctx, deps.App, w, transferFormat)
+}
+
+func importCommand(ctx context.Context, deps commandDeps, args []string) (err error) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", string(driver.Ndjson), "input format, ndjson or csv")
+	input := flags.String("input", "-", "file to read, - for stdin")
+	tenant := flags.String("tenant", "", "tenant to import the users into")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	transferFormat, err := driver.ParseTransferFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("error opening input: %w", err)
+		}
+
+		defer file.Close()
+
+		r = file
+	}
+
+	report, err := driver.ReadUsers(ctx, deps.App, r, transferFormat)
+	if err != nil {
+		return err
+	}
+
+	for _, importError := range report.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", importError.Line, importError.Error)
+	}
+
+	if report.Truncated != nil && *report.Truncated {
+		fmt.Fprintf(os.Stderr, "only the first %d errors are listed\n", len(report.Errors))
+	}
+
+	fmt.Fprintf(os.Stderr, "imported %d users, %d failed\n", report.Imported, report.Failed)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d users failed to import", report.Failed)
+	}
+
+	return nil
+}
+
+// backupCommand writes every user of the storage to a backup, names and emails encrypted at rest stay encrypted in it
+func backupCommand(ctx context.Context, deps commandDeps, args []string) (err error) {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("output", "", "file to write the backup to")
+	pageSize := flags.Int("page-size", 100, "users to read at a time")
+	tenant := flags.String("tenant", "", "tenant to back up the users of")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return errors.New("output is missing")
+	}
+
+	if *pageSize <= 0 {
+		return errors.New("page size must be positive")
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	// the backup only takes the place of the output once it is complete
+	partial := *output + ".partial"
+
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("error creating output: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(partial)
+		}
+	}()
+
+	count, err := driver.WriteBackup(file, domain.AllUsers(ctx, deps.Storage, *pageSize), deps.Config.Storage, *tenant)
+
+	closeErr := file.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("error closing output: %w", closeErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(partial, *output)
+	if err != nil {
+		return fmt.Errorf("error renaming output: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "backed up %d users\n", count)
+
+	return nil
+}
+
+// restoreCommand loads a backup into the storage, the backup is verified completely before the first user is written.
+// The users are written past the caches of the replicas, with the redis storage the replicas are told to drop
+// the users of the tenant. Other storages have no channel to the replicas, their caches serve the users
+// they hold until CACHE_TTL has passed, unless the replicas are restarted
+func restoreCommand(ctx context.Context, deps commandDeps, args []string) (err error) {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("input", "", "backup file to restore")
+	onConflict := flags.String("on-conflict", string(application.ConflictFail), "what to do with users that exist, overwrite, skip or fail")
+	tenant := flags.String("tenant", "", "tenant to restore the users into")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *input == "" {
+		return errors.New("input is missing")
+	}
+
+	policy, err := application.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("error opening input: %w", err)
+	}
+
+	defer file.Close()
+
+	info, err := driver.VerifyBackup(file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "restoring %d users backed up from %s at %s\n", info.Users, info.Storage, info.CreatedAt.Format(time.RFC3339))
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	report, err := application.RestoreUsers(ctx, deps.Storage, driver.ReadBackup(file), policy, func(user domain.User, err error) {
+		fmt.Fprintf(os.Stderr, "user %s: %s\n", user.ID, err)
+	})
+
+	fmt.Fprintf(os.Stderr, "restored %d users, skipped %d existing and %d expired, %d failed\n",
+		report.Restored, report.Skipped, report.Expired, report.Failed)
+
+	if report.Restored > 0 {
+		err = errors.Join(err, invalidateCaches(ctx, deps, *tenant))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d users failed to restore", report.Failed)
+	}
+
+	return nil
+}
+
+// invalidateCaches drops the users of the tenant from the caches of the replicas after they were written past them
+func invalidateCaches(ctx context.Context, deps commandDeps, tenant string) error {
+	if deps.Redis == nil {
+		if deps.Config.Cache.Enabled {
+			fmt.Fprintf(os.Stderr, "replicas serve the users they cached for up to %s, restart them to serve the restored users\n",
+				deps.Config.Cache.TTL)
+		}
+
+		return nil
+	}
+
+	err := driven.PublishCacheInvalidation(ctx, deps.Config, deps.Redis, driven.TenantInvalidation(tenant))
+	if err != nil {
+		return fmt.Errorf("error dropping the restored users from the caches, they are served for up to %s: %w",
+			deps.Config.Cache.TTL, err)
+	}
+
+	return nil
+}
+
+// withTenant scopes the command to the tenant, without one it works on the users outside of any tenant
+func withTenant(ctx context.Context, tenant string) (context.Context, error) {
+	if tenant == "" {
+		return ctx, nil
+	}
+
+	err := domain.ValidateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.WithTenant(ctx, tenant), nil
+}
+
+// migrateSchemaCommand applies the postgres schema migrations, for deployments that do not migrate at startup
+func migrateSchemaCommand(ctx context.Context, deps commandDeps, args []string) error {
+	flags := flag.NewFlagSet("migrate-schema", flag.ContinueOnError)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if deps.Config.Storage != config.StoragePostgres {
+		return fmt.Errorf("storage is %s, schema migrations are only needed for %s", deps.Config.Storage, config.StoragePostgres)
+	}
+
+	applied, err := driven.MigratePostgres(ctx, deps.Config)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range applied {
+		fmt.Fprintf(os.Stderr, "applied %s\n", version)
+	}
+
+	fmt.Fprintf(os.Stderr, "applied %d migrations\n", len(applied))
+
+	return nil
+}
+
+// migrateCommand rewrites the users stored in an older version of the encoding, while the service keeps running.
+// Every batch reports the cursor to resume at, a migration that was stopped picks up there with -cursor.
+func migrateCommand(ctx context.Context, deps commandDeps, args []string) (err error) {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	batchSize := flags.Int("batch-size", 100, "keys to scan at a time")
+	dryRun := flags.Bool("dry-run", false, "only count the users that need an upgrade")
+	cursor := flags.String("cursor", "", "cursor to resume a stopped migration at")
+	tenant := flags.String("tenant", "", "tenant to migrate the users of")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if deps.Config.Storage != config.StorageRedis {
+		return fmt.Errorf("storage is %s, only %s values are migrated", deps.Config.Storage, config.StorageRedis)
+	}
+
+	if *batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	var total driven.ValueMigration
+
+	for {
+		migration, err := deps.Redis.MigrateValues(ctx, *cursor, *batchSize, *dryRun)
+		if err != nil {
+			if *cursor != "" {
+				fmt.Fprintf(os.Stderr, "resume with -cursor %s\n", *cursor)
+			}
+
+			return err
+		}
+
+		total.Scanned += migration.Scanned
+		total.Outdated += migration.Outdated
+		total.Upgraded += migration.Upgraded
+		*cursor = migration.Cursor
+
+		if *cursor == "" {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "scanned %d users, cursor %s\n", total.Scanned, *cursor)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "scanned %d users, %d need an upgrade\n", total.Scanned, total.Outdated)
+
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "scanned %d users, upgraded %d of %d outdated\n", total.Scanned, total.Upgraded, total.Outdated)
+
+	return nil
+}
+
+// rotateKeysCommand encrypts the names that are not encrypted with the active key again, while the service keeps running
+func rotateKeysCommand(ctx context.Context, deps commandDeps, args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	pageSize := flags.Int("page-size", 100, "users to read at a time")
+	tenant := flags.String("tenant", "", "tenant to rotate the users of")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if deps.Keys == nil {
+		return errors.New("encryption is disabled, there are no keys to rotate")
+	}
+
+	if *pageSize <= 0 {
+		return errors.New("page size must be positive")
+	}
+
+	ctx, err = withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	checked, rotated, err := driven.NewEncryptedStorage(deps.Keys, deps.Storage).Rotate(ctx, *pageSize)
+
+	fmt.Fprintf(os.Stderr, "checked %d users, encrypted %d with key %s\n", checked, rotated, deps.Keys.Active())
+
+	return err
+}
@@ -3,18 +3,214 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 )
 
+// how to reach redis, sentinel and cluster take their nodes from Addrs instead of URL.
+// A cluster keeps every key of the app in the slot of Prefix, so it is served by a single node and adds failover
+// but no capacity, use a Prefix per app to spread several apps over the nodes.
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+)
+
+// how redis is checked at startup, read only touches keys that exist anyway, for users without write access
+const (
+	RedisCheckPing = "ping"
+	RedisCheckRead = "read"
+)
+
+// RedisTLSConfig secures the connection to redis, CAFile trusts a private CA and the key pair authenticates the client
+type RedisTLSConfig struct {
+	Enabled    bool   `env:"ENABLED" envDefault:"false"`
+	CAFile     string `env:"CA_FILE"`
+	CertFile   string `env:"CERT_FILE"`
+	KeyFile    string `env:"KEY_FILE"`
+	ServerName string `env:"SERVER_NAME"`
+}
+
+// RedisConfig reaches redis, Username and Password take precedence over the credentials in URL.
+// Zero PoolSize and MinIdleConns leave the defaults of go-redis, a negative MaxRetries disables retries.
+// The startup check is retried until StartupTimeout, StartupDegraded starts anyway and holds readiness until redis answers.
+// UpgradeOnRead rewrites the users read in an older version of the encoding, users without write access turn it off.
 type RedisConfig struct {
-	URL    string `env:"URL,notEmpty"`
-	Prefix string `env:"PREFIX" envDefault:"simple-app"`
+	Mode            string         `env:"MODE" envDefault:"single"`
+	URL             string         `env:"URL" secret:"url"`
+	Addrs           []string       `env:"ADDRS"`
+	MasterName      string         `env:"MASTER_NAME"`
+	Username        string         `env:"USERNAME"`
+	Password        string         `env:"PASSWORD" secret:"true"`
+	PoolSize        int            `env:"POOL_SIZE"`
+	MinIdleConns    int            `env:"MIN_IDLE_CONNS"`
+	DialTimeout     time.Duration  `env:"DIAL_TIMEOUT" envDefault:"5s"`
+	ReadTimeout     time.Duration  `env:"READ_TIMEOUT" envDefault:"3s"`
+	WriteTimeout    time.Duration  `env:"WRITE_TIMEOUT" envDefault:"3s"`
+	MaxRetries      int            `env:"MAX_RETRIES" envDefault:"3"`
+	MinRetryBackoff time.Duration  `env:"MIN_RETRY_BACKOFF" envDefault:"8ms"`
+	MaxRetryBackoff time.Duration  `env:"MAX_RETRY_BACKOFF" envDefault:"512ms"`
+	TLS             RedisTLSConfig `envPrefix:"TLS_"`
+	StartupCheck    string         `env:"STARTUP_CHECK" envDefault:"ping"`
+	StartupTimeout  time.Duration  `env:"STARTUP_TIMEOUT" envDefault:"10s"`
+	StartupDegraded bool           `env:"STARTUP_DEGRADED" envDefault:"false"`
+	UpgradeOnRead   bool           `env:"UPGRADE_ON_READ" envDefault:"true"`
+	Prefix          string         `env:"PREFIX" envDefault:"simple-app"`
+	Stream          string         `env:"STREAM" envDefault:"events"`
+	StreamMaxLen    int64          `env:"STREAM_MAXLEN" envDefault:"100000"`
+}
+
+// PostgresConfig is used when the users are stored in postgres, Migrate applies the schema migrations at startup
+type PostgresConfig struct {
+	URL     string `env:"URL" secret:"url"`
+	Migrate bool   `env:"MIGRATE" envDefault:"true"`
+}
+
+// BoltConfig is used when the users are stored in a local file, Timeout bounds the wait for another process to release it
+type BoltConfig struct {
+	Path    string        `env:"PATH" envDefault:"simple-app.db"`
+	Timeout time.Duration `env:"TIMEOUT" envDefault:"5s"`
+}
+
+// CacheConfig puts an in-process cache in front of the user storage, replicas tell each other about changed users over Channel.
+// The channel is a redis one, with another storage every replica only drops the users it changed itself.
+type CacheConfig struct {
+	Enabled     bool          `env:"ENABLED" envDefault:"false"`
+	Size        int           `env:"SIZE" envDefault:"10000"`
+	TTL         time.Duration `env:"TTL" envDefault:"1m"`
+	NegativeTTL time.Duration `env:"NEGATIVE_TTL" envDefault:"5s"`
+	Channel     string        `env:"CHANNEL" envDefault:"cache::invalidate"`
+}
+
+// ResilienceConfig retries failing storage calls, after FailureThreshold failures in a row the circuit breaker opens
+// and fails calls fast for OpenTimeout, then lets a single call through to probe the storage
+type ResilienceConfig struct {
+	Enabled          bool          `env:"ENABLED" envDefault:"true"`
+	MaxAttempts      int           `env:"MAX_ATTEMPTS" envDefault:"3"`
+	BackoffBase      time.Duration `env:"BACKOFF_BASE" envDefault:"50ms"`
+	BackoffMax       time.Duration `env:"BACKOFF_MAX" envDefault:"1s"`
+	FailureThreshold int           `env:"FAILURE_THRESHOLD" envDefault:"5"`
+	OpenTimeout      time.Duration `env:"OPEN_TIMEOUT" envDefault:"30s"`
+}
+
+// where the tenant of a request is taken from
+const (
+	TenantFromHeader    = "header"
+	TenantFromSubdomain = "subdomain"
+	TenantFromJWT       = "jwt"
+)
+
+// TenantConfig keeps the users of every tenant in a key namespace of their own, Default serves requests naming no tenant.
+// The JWT is a bearer token signed with JWTSecret (HS256), Domain is the parent domain of the tenant subdomains.
+// MaxUsers caps the users of every tenant, Quotas overrides it per tenant as tenant:users pairs, zero means no cap.
+// The admin endpoints and, as webhooks receive the events of every tenant, the webhook endpoints need AdminToken.
+type TenantConfig struct {
+	Enabled    bool           `env:"ENABLED" envDefault:"false"`
+	Source     string         `env:"SOURCE" envDefault:"header"`
+	Header     string         `env:"HEADER" envDefault:"X-Tenant-ID"`
+	Domain     string         `env:"DOMAIN"`
+	JWTSecret  string         `env:"JWT_SECRET" secret:"true"`
+	JWTClaim   string         `env:"JWT_CLAIM" envDefault:"tenant"`
+	Default    string         `env:"DEFAULT"`
+	MaxUsers   int            `env:"MAX_USERS" envDefault:"0"`
+	Quotas     map[string]int `env:"QUOTAS" envKeyValSeparator:":"`
+	AdminToken string         `env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// Quota is the cap on the users of the tenant, zero when there is none
+func (c TenantConfig) Quota(tenant string) int {
+	if quota, ok := c.Quotas[tenant]; ok {
+		return quota
+	}
+
+	return c.MaxUsers
+}
+
+// EncryptionConfig encrypts the names and emails of the users at rest with the keys of a key ring, taken from KeyFile
+// when it is set and from Keys as id:base64 pairs otherwise. New values are encrypted with ActiveKey, the other keys
+// only decrypt. IndexKey, base64 as well, makes the blind index that keeps emails unique, it cannot be rotated.
+type EncryptionConfig struct {
+	Enabled   bool              `env:"ENABLED" envDefault:"false"`
+	KeyFile   string            `env:"KEY_FILE"`
+	Keys      map[string]string `env:"KEYS" envKeyValSeparator:":" secret:"true"`
+	ActiveKey string            `env:"ACTIVE_KEY"`
+	IndexKey  string            `env:"INDEX_KEY" secret:"true"`
 }
 
+// OutboxConfig relays the outbox every Interval, BatchSize at a time. One replica relays while it holds the Lease,
+// the others take over once it has not been renewed for that long.
+type OutboxConfig struct {
+	Interval  time.Duration `env:"INTERVAL" envDefault:"1s"`
+	BatchSize int           `env:"BATCH_SIZE" envDefault:"100"`
+	Lease     time.Duration `env:"LEASE" envDefault:"10s"`
+}
+
+// ExpiryConfig sweeps the expired users every Interval, BatchSize at a time
+type ExpiryConfig struct {
+	Interval  time.Duration `env:"INTERVAL" envDefault:"1s"`
+	BatchSize int           `env:"BATCH_SIZE" envDefault:"100"`
+}
+
+type WebhookConfig struct {
+	Interval    time.Duration `env:"INTERVAL" envDefault:"1s"`
+	BatchSize   int           `env:"BATCH_SIZE" envDefault:"50"`
+	Timeout     time.Duration `env:"TIMEOUT" envDefault:"10s"`
+	Lease       time.Duration `env:"LEASE" envDefault:"1m"`
+	MaxAttempts int           `env:"MAX_ATTEMPTS" envDefault:"8"`
+	BackoffBase time.Duration `env:"BACKOFF_BASE" envDefault:"1s"`
+	BackoffMax  time.Duration `env:"BACKOFF_MAX" envDefault:"1h"`
+}
+
+// EventsConfig streams the events to subscribers, MemoryLen is how many events are kept for replays
+// when redis is not the storage and the events only live in the memory of each replica
+type EventsConfig struct {
+	Heartbeat time.Duration `env:"HEARTBEAT" envDefault:"15s"`
+	Block     time.Duration `env:"BLOCK" envDefault:"5s"`
+	BatchSize int           `env:"BATCH_SIZE" envDefault:"100"`
+	Buffer    int           `env:"BUFFER" envDefault:"256"`
+	MemoryLen int           `env:"MEMORY_LEN" envDefault:"10000"`
+}
+
+type WebSocketConfig struct {
+	PingInterval     time.Duration `env:"PING_INTERVAL" envDefault:"30s"`
+	PongTimeout      time.Duration `env:"PONG_TIMEOUT" envDefault:"60s"`
+	WriteTimeout     time.Duration `env:"WRITE_TIMEOUT" envDefault:"10s"`
+	Buffer           int           `env:"BUFFER" envDefault:"16"`
+	MaxSubscriptions int           `env:"MAX_SUBSCRIPTIONS" envDefault:"1000"`
+	MaxMessageSize   int64         `env:"MAX_MESSAGE_SIZE" envDefault:"65536"`
+}
+
+type GraphQLConfig struct {
+	MaxDepth      int `env:"MAX_DEPTH" envDefault:"8"`
+	MaxComplexity int `env:"MAX_COMPLEXITY" envDefault:"1000"`
+}
+
+// the system of record for users, redis is only reached when it is the storage.
+// Webhooks and tenants need the redis storage, the events of the other storages are kept in memory
+const (
+	StorageRedis    = "redis"
+	StoragePostgres = "postgres"
+	StorageBolt     = "bolt"
+)
+
 type Config struct {
-	Port  string      `env:"PORT" envDefault:"8080"`
-	Redis RedisConfig `envPrefix:"REDIS_"`
+	Port       string           `env:"PORT" envDefault:"8080"`
+	GRPCPort   string           `env:"GRPC_PORT" envDefault:"9090"`
+	Storage    string           `env:"STORAGE" envDefault:"redis"`
+	Redis      RedisConfig      `envPrefix:"REDIS_"`
+	Postgres   PostgresConfig   `envPrefix:"POSTGRES_"`
+	Bolt       BoltConfig       `envPrefix:"BOLT_"`
+	Cache      CacheConfig      `envPrefix:"CACHE_"`
+	Resilience ResilienceConfig `envPrefix:"RESILIENCE_"`
+	Tenant     TenantConfig     `envPrefix:"TENANT_"`
+	Encryption EncryptionConfig `envPrefix:"ENCRYPTION_"`
+	Outbox     OutboxConfig     `envPrefix:"OUTBOX_"`
+	Expiry     ExpiryConfig     `envPrefix:"EXPIRY_"`
+	Webhook    WebhookConfig    `envPrefix:"WEBHOOK_"`
+	Events     EventsConfig     `envPrefix:"EVENTS_"`
+	WebSocket  WebSocketConfig  `envPrefix:"WS_"`
+	GraphQL    GraphQLConfig    `envPrefix:"GRAPHQL_"`
 }
 
 func NewConfig() (*Config, error) {
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// Environment is the config as the environment variables that set it, in the order of the fields.
+// Fields tagged secret are redacted when they are set, secret:"url" only redacts the password of the url.
+func (c *Config) Environment() []string {
+	return environment(reflect.ValueOf(*c), "")
+}
+
+func environment(value reflect.Value, prefix string) (variables []string) {
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			variables = append(variables, environment(value.Field(i), prefix+field.Tag.Get("envPrefix"))...)
+
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		variables = append(variables, prefix+name+"="+redact(format(value.Field(i), field.Tag), field.Tag.Get("secret")))
+	}
+
+	return variables
+}
+
+// format writes the value the way the environment variable is parsed
+func format(value reflect.Value, tag reflect.StructTag) string {
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(value.Index(i))
+		}
+
+		return strings.Join(items, ",")
+	case reflect.Map:
+		separator := tag.Get("envKeyValSeparator")
+		if separator == "" {
+			separator = ":"
+		}
+
+		items := make([]string, 0, value.Len())
+		for iter := value.MapRange(); iter.Next(); {
+			items = append(items, fmt.Sprint(iter.Key())+separator+fmt.Sprint(iter.Value()))
+		}
+
+		sort.Strings(items)
+
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func redact(value, secret string) string {
+	switch {
+	case value == "" || secret == "":
+		return value
+	case secret == "url":
+		parsed, err := url.Parse(value)
+		if err == nil && parsed.Scheme != "" {
+			// postgres takes the password from the query as well
+			query := parsed.Query()
+			if query.Has("password") {
+				query.Set("password", redacted)
+				parsed.RawQuery = query.Encode()
+			}
+
+			return parsed.Redacted()
+		}
+	}
+
+	// urls that do not parse are redacted completely, their password cannot be told apart
+	return redacted
+}
@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff doubles base for every attempt up to maxDelay and picks a random point in the upper half of the delay
+func Backoff(base, maxDelay time.Duration, attempt int) time.Duration {
+	delay := maxDelay
+
+	if shift := attempt - 1; shift < 32 {
+		if exp := base << shift; exp > 0 && exp < delay {
+			delay = exp
+		}
+	}
+
+	half := delay / 2
+
+	return half + rand.N(half+1) //nolint:gosec // jitter does not need a secure source
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Run("grows with the attempts", func(t *testing.T) {
+		for attempt := 1; attempt < 5; attempt++ {
+			delay := Backoff(time.Second, time.Hour, attempt)
+			require.GreaterOrEqual(t, delay, time.Second<<(attempt-1)/2)
+			require.LessOrEqual(t, delay, time.Second<<(attempt-1))
+		}
+	})
+
+	t.Run("is capped", func(t *testing.T) {
+		for attempt := 1; attempt < 100; attempt++ {
+			delay := Backoff(time.Second, time.Minute, attempt)
+			require.Positive(t, delay)
+			require.LessOrEqual(t, delay, time.Minute)
+		}
+	})
+}
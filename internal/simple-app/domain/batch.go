@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrorAborted is reported for the operations of an all-or-nothing batch that was rejected because of another one
+var ErrorAborted = fmt.Errorf("aborted")
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is a create, update or delete of a batch. An update with a nil ExpiresAt keeps the expiry
+// the user has like UpdateUser, a zero one keeps the user for good.
+type BatchOperation struct {
+	Op        BatchOp
+	ID        uuid.UUID
+	Name      string
+	Email     string
+	ExpiresAt *time.Time
+}
+
+type BatchResult struct {
+	ID  uuid.UUID
+	Err error
+}
+
+// UserMutation is a batch operation as it is handed to storage, together with the event it raises
+type UserMutation struct {
+	Op        BatchOp
+	ID        string
+	Name      string
+	Email     string
+	ExpiresAt time.Time
+	Event     Event
+}
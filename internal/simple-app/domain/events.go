@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type EventType string
+
+const (
+	EventUserCreated EventType = "user.created"
+	EventUserUpdated EventType = "user.updated"
+	EventUserDeleted EventType = "user.deleted"
+	EventUserExpired EventType = "user.expired"
+)
+
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserExpired:
+		return true
+	default:
+		return false
+	}
+}
+
+type Event struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Tenant owns the user, subscribers only see the events of their own tenant
+	Tenant string `json:"tenant,omitempty"`
+	// Trace is the W3C trace context of the request that caused the event
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+func NewEvent(ctx context.Context, eventType EventType, userID, name string) Event {
+	trace := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, trace)
+
+	if len(trace) == 0 {
+		trace = nil
+	}
+
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		UserID:     userID,
+		Name:       name,
+		OccurredAt: time.Now().UTC(),
+		Tenant:     TenantFromContext(ctx),
+		Trace:      trace,
+	}
+}
+
+//go:generate mockery --name=EventPublisher
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) (err error)
+}
+
+//go:generate mockery --name=Outbox
+type Outbox interface {
+	// LeaseRelay makes owner the only relay of the outbox until the lease runs out, renewing a lease it holds already.
+	// Relays on the other replicas are turned away meanwhile, so the events are published once and in order.
+	LeaseRelay(ctx context.Context, owner string, lease time.Duration) (held bool, err error)
+	Pending(ctx context.Context, limit int) (events []Event, err error)
+	Ack(ctx context.Context, ids ...string) (err error)
+}
+
+// StreamEvent is an event together with its position in the event stream
+type StreamEvent struct {
+	StreamID string
+	Event    Event
+}
+
+//go:generate mockery --name=EventStream
+type EventStream interface {
+	// RangeEvents returns up to count events stored after afterID
+	RangeEvents(ctx context.Context, afterID string, count int) (events []StreamEvent, err error)
+	// LastEventID returns the id of the newest event, "0-0" while there are none
+	LastEventID(ctx context.Context) (id string, err error)
+	// ReadEvents waits up to block for events added after afterID
+	ReadEvents(ctx context.Context, afterID string, count int, block time.Duration) (events []StreamEvent, err error)
+}
+
+//go:generate mockery --name=EventSubscriber
+type EventSubscriber interface {
+	// Subscribe replays the events after lastEventID, if given, and then follows new ones.
+	// The channel is closed once ctx is done, the subscriber falls behind or the service stops.
+	Subscribe(ctx context.Context, lastEventID string) (events <-chan StreamEvent, err error)
+}
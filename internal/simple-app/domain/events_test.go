@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewEvent(t *testing.T) {
+	t.Run("without trace", func(t *testing.T) {
+		event := NewEvent(context.Background(), EventUserCreated, "id", "name")
+		require.NotEmpty(t, event.ID)
+		require.Equal(t, EventUserCreated, event.Type)
+		require.Nil(t, event.Trace)
+		require.Empty(t, event.Tenant)
+	})
+
+	t.Run("with tenant", func(t *testing.T) {
+		event := NewEvent(WithTenant(context.Background(), "acme"), EventUserUpdated, "id", "name")
+		require.Equal(t, "acme", event.Tenant)
+	})
+
+	t.Run("with trace", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{2},
+			TraceFlags: trace.FlagsSampled,
+		}))
+
+		event := NewEvent(ctx, EventUserDeleted, "id", "")
+		require.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", event.Trace["traceparent"])
+	})
+}
@@ -4,23 +4,81 @@ package domain
 import (
 	"context"
 	"fmt"
+	"iter"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 //go:generate mockery --name=ApplicationInterface
 type ApplicationInterface interface {
-	GetUser(ctx context.Context, id uuid.UUID) (name string, err error)
-	CreateUser(ctx context.Context, name string) (id uuid.UUID, err error)
-	UpdateUser(ctx context.Context, id uuid.UUID, name string) (err error)
+	GetUser(ctx context.Context, id uuid.UUID) (user User, err error)
+	// CreateUser and UpdateUser fail with ErrorConflict when another user has the email, an empty email is none
+	// expiresAt has to lie ahead, a zero expiresAt keeps the user until it is deleted
+	CreateUser(ctx context.Context, name, email string, expiresAt time.Time) (id uuid.UUID, err error)
+	// UpdateUser keeps the expiry the user has when expiresAt is nil and returns the user as stored
+	UpdateUser(ctx context.Context, id uuid.UUID, name, email string, expiresAt *time.Time) (user User, err error)
 	DeleteUser(ctx context.Context, id uuid.UUID) (err error)
+	ListUsers(ctx context.Context, cursor string, limit int) (users []User, next string, err error)
+	// BatchUsers applies the operations in order, atomic batches are applied completely or not at all
+	BatchUsers(ctx context.Context, operations []BatchOperation, atomic bool) (results []BatchResult, err error)
+	// SearchUsers returns up to limit users matching the query, ordered by name
+	SearchUsers(ctx context.Context, query NameQuery, limit int) (users []User, err error)
+	// ExportUsers walks all users page by page, iteration stops after the first error
+	ExportUsers(ctx context.Context) iter.Seq2[User, error]
+	// ImportUsers creates or overwrites the users as they are read and reports the outcome of every record in order,
+	// err is only set when the import could not continue
+	ImportUsers(ctx context.Context, records iter.Seq[ImportRecord], report func(ImportResult) error) (err error)
 }
 
-var ErrorNotFound = fmt.Errorf("not found")
+// User expires at ExpiresAt, a zero ExpiresAt never expires
+type User struct {
+	ID        uuid.UUID
+	Name      string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// NameQuery matches user names exactly or by prefix, optionally ignoring case
+type NameQuery struct {
+	Name       string
+	Prefix     bool
+	IgnoreCase bool
+}
+
+var (
+	ErrorNotFound     = fmt.Errorf("not found")
+	ErrorInvalidInput = fmt.Errorf("invalid input")
+	ErrorConflict     = fmt.Errorf("conflict")
+)
 
 //go:generate mockery --name=UserStorage
 type UserStorage interface {
-	Store(ctx context.Context, id, name string) (err error)
-	Read(ctx context.Context, id string) (name string, err error)
-	Delete(ctx context.Context, id string) (err error)
+	// Store creates or replaces the user, it fails with ErrorConflict when another user has claimed the email
+	Store(ctx context.Context, user User, events ...Event) (err error)
+	Read(ctx context.Context, id string) (user User, err error)
+	Delete(ctx context.Context, id string, events ...Event) (err error)
+	// List returns a page of about limit users starting at cursor, next is empty after the last page
+	List(ctx context.Context, cursor string, limit int) (users []User, next string, err error)
+	// Batch applies the mutations in one round trip and reports an error per mutation,
+	// update and delete fail with ErrorNotFound for missing users, create and update with ErrorConflict for taken emails
+	Batch(ctx context.Context, mutations []UserMutation, atomic bool) (results []error, err error)
+	// Search looks users up by name in an index that is kept in step with the users
+	Search(ctx context.Context, query NameQuery, limit int) (users []User, err error)
+}
+
+// ExpiryEvent makes the event that tells about the expired user, ctx is scoped to the tenant of the user
+type ExpiryEvent func(ctx context.Context, id string) Event
+
+//go:generate mockery --name=UserExpiry
+type UserExpiry interface {
+	// ExpireUsers deletes up to limit users that expired by now and queues the event made for each of them with it.
+	// Expired users are neither read, listed nor found before, they only keep taking up their tenant's quota.
+	ExpireUsers(ctx context.Context, now time.Time, limit int, event ExpiryEvent) (expired int, err error)
+}
+
+//go:generate mockery --name=Readiness
+type Readiness interface {
+	// Ready is closed once the dependencies answer, until then the service reports itself as not ready
+	Ready() <-chan struct{}
 }
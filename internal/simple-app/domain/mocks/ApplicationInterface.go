@@ -5,6 +5,12 @@ package mocks
 import (
 	context "context"
 
+	iter "iter"
+
+	time "time"
+
+	domain "github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
 	mock "github.com/stretchr/testify/mock"
 
 	uuid "github.com/google/uuid"
@@ -15,25 +21,51 @@ type ApplicationInterface struct {
 	mock.Mock
 }
 
-// CreateUser provides a mock function with given fields: ctx, name
-func (_m *ApplicationInterface) CreateUser(ctx context.Context, name string) (uuid.UUID, error) {
-	ret := _m.Called(ctx, name)
+// BatchUsers provides a mock function with given fields: ctx, operations, atomic
+func (_m *ApplicationInterface) BatchUsers(ctx context.Context, operations []domain.BatchOperation, atomic bool) ([]domain.BatchResult, error) {
+	ret := _m.Called(ctx, operations, atomic)
+
+	var r0 []domain.BatchResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.BatchOperation, bool) ([]domain.BatchResult, error)); ok {
+		return rf(ctx, operations, atomic)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.BatchOperation, bool) []domain.BatchResult); ok {
+		r0 = rf(ctx, operations, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.BatchResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []domain.BatchOperation, bool) error); ok {
+		r1 = rf(ctx, operations, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateUser provides a mock function with given fields: ctx, name, email, expiresAt
+func (_m *ApplicationInterface) CreateUser(ctx context.Context, name string, email string, expiresAt time.Time) (uuid.UUID, error) {
+	ret := _m.Called(ctx, name, email, expiresAt)
 
 	var r0 uuid.UUID
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (uuid.UUID, error)); ok {
-		return rf(ctx, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) (uuid.UUID, error)); ok {
+		return rf(ctx, name, email, expiresAt)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) uuid.UUID); ok {
-		r0 = rf(ctx, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) uuid.UUID); ok {
+		r0 = rf(ctx, name, email, expiresAt)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(uuid.UUID)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time) error); ok {
+		r1 = rf(ctx, name, email, expiresAt)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -55,19 +87,37 @@ func (_m *ApplicationInterface) DeleteUser(ctx context.Context, id uuid.UUID) er
 	return r0
 }
 
+// ExportUsers provides a mock function with given fields: ctx
+func (_m *ApplicationInterface) ExportUsers(ctx context.Context) iter.Seq2[domain.User, error] {
+	ret := _m.Called(ctx)
+
+	var r0 iter.Seq2[domain.User, error]
+	if rf, ok := ret.Get(0).(func(context.Context) iter.Seq2[domain.User, error]); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(iter.Seq2[domain.User, error])
+		}
+	}
+
+	return r0
+}
+
 // GetUser provides a mock function with given fields: ctx, id
-func (_m *ApplicationInterface) GetUser(ctx context.Context, id uuid.UUID) (string, error) {
+func (_m *ApplicationInterface) GetUser(ctx context.Context, id uuid.UUID) (domain.User, error) {
 	ret := _m.Called(ctx, id)
 
-	var r0 string
+	var r0 domain.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (string, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (domain.User, error)); ok {
 		return rf(ctx, id)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) string); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) domain.User); ok {
 		r0 = rf(ctx, id)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(domain.User)
+		}
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
@@ -79,13 +129,13 @@ func (_m *ApplicationInterface) GetUser(ctx context.Context, id uuid.UUID) (stri
 	return r0, r1
 }
 
-// UpdateUser provides a mock function with given fields: ctx, id, name
-func (_m *ApplicationInterface) UpdateUser(ctx context.Context, id uuid.UUID, name string) error {
-	ret := _m.Called(ctx, id, name)
+// ImportUsers provides a mock function with given fields: ctx, records, report
+func (_m *ApplicationInterface) ImportUsers(ctx context.Context, records iter.Seq[domain.ImportRecord], report func(domain.ImportResult) error) error {
+	ret := _m.Called(ctx, records, report)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string) error); ok {
-		r0 = rf(ctx, id, name)
+	if rf, ok := ret.Get(0).(func(context.Context, iter.Seq[domain.ImportRecord], func(domain.ImportResult) error) error); ok {
+		r0 = rf(ctx, records, report)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -93,6 +143,91 @@ func (_m *ApplicationInterface) UpdateUser(ctx context.Context, id uuid.UUID, na
 	return r0
 }
 
+// ListUsers provides a mock function with given fields: ctx, cursor, limit
+func (_m *ApplicationInterface) ListUsers(ctx context.Context, cursor string, limit int) ([]domain.User, string, error) {
+	ret := _m.Called(ctx, cursor, limit)
+
+	var r0 []domain.User
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]domain.User, string, error)); ok {
+		return rf(ctx, cursor, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []domain.User); ok {
+		r0 = rf(ctx, cursor, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) string); ok {
+		r1 = rf(ctx, cursor, limit)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, int) error); ok {
+		r2 = rf(ctx, cursor, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// SearchUsers provides a mock function with given fields: ctx, query, limit
+func (_m *ApplicationInterface) SearchUsers(ctx context.Context, query domain.NameQuery, limit int) ([]domain.User, error) {
+	ret := _m.Called(ctx, query, limit)
+
+	var r0 []domain.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.NameQuery, int) ([]domain.User, error)); ok {
+		return rf(ctx, query, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, domain.NameQuery, int) []domain.User); ok {
+		r0 = rf(ctx, query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, domain.NameQuery, int) error); ok {
+		r1 = rf(ctx, query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, id, name, email, expiresAt
+func (_m *ApplicationInterface) UpdateUser(ctx context.Context, id uuid.UUID, name string, email string, expiresAt *time.Time) (domain.User, error) {
+	ret := _m.Called(ctx, id, name, email, expiresAt)
+
+	var r0 domain.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string, string, *time.Time) (domain.User, error)); ok {
+		return rf(ctx, id, name, email, expiresAt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string, string, *time.Time) domain.User); ok {
+		r0 = rf(ctx, id, name, email, expiresAt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(domain.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, string, string, *time.Time) error); ok {
+		r1 = rf(ctx, id, name, email, expiresAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewApplicationInterface creates a new instance of ApplicationInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewApplicationInterface(t interface {
@@ -5,6 +5,8 @@ package mocks
 import (
 	context "context"
 
+	domain "github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,13 +15,46 @@ type UserStorage struct {
 	mock.Mock
 }
 
-// Delete provides a mock function with given fields: ctx, id
-func (_m *UserStorage) Delete(ctx context.Context, id string) error {
-	ret := _m.Called(ctx, id)
+// Batch provides a mock function with given fields: ctx, mutations, atomic
+func (_m *UserStorage) Batch(ctx context.Context, mutations []domain.UserMutation, atomic bool) ([]error, error) {
+	ret := _m.Called(ctx, mutations, atomic)
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.UserMutation, bool) ([]error, error)); ok {
+		return rf(ctx, mutations, atomic)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.UserMutation, bool) []error); ok {
+		r0 = rf(ctx, mutations, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []domain.UserMutation, bool) error); ok {
+		r1 = rf(ctx, mutations, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Delete provides a mock function with given fields: ctx, id, events
+func (_m *UserStorage) Delete(ctx context.Context, id string, events ...domain.Event) error {
+	_va := make([]interface{}, len(events))
+	for _i := range events {
+		_va[_i] = events[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, id)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...domain.Event) error); ok {
+		r0 = rf(ctx, id, events...)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -27,19 +62,54 @@ func (_m *UserStorage) Delete(ctx context.Context, id string) error {
 	return r0
 }
 
+// List provides a mock function with given fields: ctx, cursor, limit
+func (_m *UserStorage) List(ctx context.Context, cursor string, limit int) ([]domain.User, string, error) {
+	ret := _m.Called(ctx, cursor, limit)
+
+	var r0 []domain.User
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]domain.User, string, error)); ok {
+		return rf(ctx, cursor, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []domain.User); ok {
+		r0 = rf(ctx, cursor, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) string); ok {
+		r1 = rf(ctx, cursor, limit)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, int) error); ok {
+		r2 = rf(ctx, cursor, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // Read provides a mock function with given fields: ctx, id
-func (_m *UserStorage) Read(ctx context.Context, id string) (string, error) {
+func (_m *UserStorage) Read(ctx context.Context, id string) (domain.User, error) {
 	ret := _m.Called(ctx, id)
 
-	var r0 string
+	var r0 domain.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.User, error)); ok {
 		return rf(ctx, id)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.User); ok {
 		r0 = rf(ctx, id)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(domain.User)
+		}
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
@@ -51,13 +121,46 @@ func (_m *UserStorage) Read(ctx context.Context, id string) (string, error) {
 	return r0, r1
 }
 
-// Store provides a mock function with given fields: ctx, id, name
-func (_m *UserStorage) Store(ctx context.Context, id string, name string) error {
-	ret := _m.Called(ctx, id, name)
+// Search provides a mock function with given fields: ctx, query, limit
+func (_m *UserStorage) Search(ctx context.Context, query domain.NameQuery, limit int) ([]domain.User, error) {
+	ret := _m.Called(ctx, query, limit)
+
+	var r0 []domain.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.NameQuery, int) ([]domain.User, error)); ok {
+		return rf(ctx, query, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, domain.NameQuery, int) []domain.User); ok {
+		r0 = rf(ctx, query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, domain.NameQuery, int) error); ok {
+		r1 = rf(ctx, query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store provides a mock function with given fields: ctx, user, events
+func (_m *UserStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) error {
+	_va := make([]interface{}, len(events))
+	for _i := range events {
+		_va[_i] = events[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, user)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, id, name)
+	if rf, ok := ret.Get(0).(func(context.Context, domain.User, ...domain.Event) error); ok {
+		r0 = rf(ctx, user, events...)
 	} else {
 		r0 = ret.Error(0)
 	}
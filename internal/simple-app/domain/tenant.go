@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// tenantPattern keeps tenant names to a dns label, they end up in storage keys and subdomains
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ErrorQuotaExceeded is a conflict with the users the tenant already has
+var ErrorQuotaExceeded = fmt.Errorf("%w: quota exceeded", ErrorConflict)
+
+type tenantKey struct{}
+
+// TenantInfo describes a tenant, Quota is zero when its users are not capped
+type TenantInfo struct {
+	Name  string
+	Users int64
+	Quota int
+}
+
+// WithTenant scopes the storage calls made with the returned context to the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext is the tenant the context is scoped to, empty when there is none
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+
+	return tenant
+}
+
+func ValidateTenant(tenant string) error {
+	if !tenantPattern.MatchString(tenant) {
+		return fmt.Errorf("%w: malformed tenant %q, expected lowercase letters, digits and dashes", ErrorInvalidInput, tenant)
+	}
+
+	return nil
+}
+
+//go:generate mockery --name=TenantStorage
+type TenantStorage interface {
+	// Tenants lists the tenants that have stored users
+	Tenants(ctx context.Context) (tenants []TenantInfo, err error)
+	// PurgeTenant deletes the users of the tenant and reports how many there were, ErrorNotFound for unknown tenants
+	PurgeTenant(ctx context.Context, tenant string) (users int64, err error)
+}
+
+//go:generate mockery --name=TenantApplicationInterface
+type TenantApplicationInterface interface {
+	ListTenants(ctx context.Context) (tenants []TenantInfo, err error)
+	PurgeTenant(ctx context.Context, tenant string) (users int64, err error)
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTenant(t *testing.T) {
+	for _, tenant := range []string{"acme", "a", "acme-corp", "42", strings.Repeat("a", 63)} {
+		require.NoError(t, ValidateTenant(tenant), tenant)
+	}
+
+	for _, tenant := range []string{"", "Acme", "-acme", "acme-", "acme::users", "acme*", "a.b", strings.Repeat("a", 64)} {
+		require.ErrorIs(t, ValidateTenant(tenant), ErrorInvalidInput, tenant)
+	}
+}
+
+func TestQuotaExceededIsConflict(t *testing.T) {
+	require.ErrorIs(t, ErrorQuotaExceeded, ErrorConflict)
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"iter"
+
+	"github.com/google/uuid"
+)
+
+// ImportRecord is a user read from an import stream, Err is set when its line could not be decoded
+type ImportRecord struct {
+	Line int
+	User User
+	Err  error
+}
+
+type ImportResult struct {
+	Line int
+	ID   uuid.UUID
+	Err  error
+}
+
+// AllUsers walks every user of any storage through List, pageSize users at a time, iteration stops after the first error
+func AllUsers(ctx context.Context, storage UserStorage, pageSize int) iter.Seq2[User, error] {
+	return func(yield func(User, error) bool) {
+		cursor := ""
+
+		for {
+			users, next, err := storage.List(ctx, cursor, pageSize)
+			if err != nil {
+				yield(User{}, err)
+
+				return
+			}
+
+			for _, user := range users {
+				if !yield(user, nil) {
+					return
+				}
+			}
+
+			if next == "" {
+				return
+			}
+
+			cursor = next
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorUnavailable is reported while the storage cannot be reached, the request may succeed when tried again later
+var ErrorUnavailable = fmt.Errorf("unavailable")
+
+// UnavailableError tells how long to wait before trying again, it matches ErrorUnavailable
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrorUnavailable, e.RetryAfter)
+}
+
+func (e UnavailableError) Unwrap() error {
+	return ErrorUnavailable
+}
+
+// RetryAfter is how long err asks to wait before trying again, zero when it does not say
+func RetryAfter(err error) time.Duration {
+	var unavailable UnavailableError
+	if errors.As(err, &unavailable) {
+		return unavailable.RetryAfter
+	}
+
+	return 0
+}
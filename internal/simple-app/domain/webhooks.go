@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Webhook struct {
+	ID     uuid.UUID   `json:"id"`
+	URL    string      `json:"url"`
+	Secret string      `json:"secret"`
+	Events []EventType `json:"events,omitempty"`
+	// CreatedAt is used to keep listings stable
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the webhook wants events of the type, an empty filter means all of them
+func (w Webhook) Subscribed(eventType EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// WebhookDelivery is a pending delivery of one event to one webhook
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Event     Event  `json:"event"`
+	Attempt   int    `json:"attempt"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryRetrying  DeliveryStatus = "retrying"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+type DeliveryAttempt struct {
+	DeliveryID string         `json:"delivery_id"`
+	EventID    string         `json:"event_id"`
+	EventType  EventType      `json:"event_type"`
+	Attempt    int            `json:"attempt"`
+	StatusCode int            `json:"status_code,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Status     DeliveryStatus `json:"status"`
+	At         time.Time      `json:"at"`
+}
+
+//go:generate mockery --name=WebhookApplicationInterface
+type WebhookApplicationInterface interface {
+	CreateWebhook(ctx context.Context, url string, events []EventType) (webhook Webhook, err error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (webhook Webhook, err error)
+	ListWebhooks(ctx context.Context) (webhooks []Webhook, err error)
+	UpdateWebhook(ctx context.Context, id uuid.UUID, url string, events []EventType) (webhook Webhook, err error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) (err error)
+	ListDeliveryAttempts(ctx context.Context, id uuid.UUID) (attempts []DeliveryAttempt, err error)
+	ListDeadLetters(ctx context.Context, id uuid.UUID) (deliveries []WebhookDelivery, err error)
+}
+
+//go:generate mockery --name=WebhookStorage
+type WebhookStorage interface {
+	StoreWebhook(ctx context.Context, webhook Webhook) (err error)
+	ReadWebhook(ctx context.Context, id string) (webhook Webhook, err error)
+	ListWebhooks(ctx context.Context) (webhooks []Webhook, err error)
+	DeleteWebhook(ctx context.Context, id string) (err error)
+	// ScheduleDelivery is idempotent, a delivery that is already queued keeps its state
+	ScheduleDelivery(ctx context.Context, delivery WebhookDelivery, at time.Time) (err error)
+	// ClaimDeliveries leases due deliveries so other workers skip them until the lease expires
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []WebhookDelivery, err error)
+	// RecordAttempt stores the attempt and completes, reschedules or dead-letters the delivery according to its status
+	RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt DeliveryAttempt, retryAt time.Time) (err error)
+	DropDelivery(ctx context.Context, id string) (err error)
+	ListDeliveryAttempts(ctx context.Context, webhookID string) (attempts []DeliveryAttempt, err error)
+	ListDeadLetters(ctx context.Context, webhookID string) (deliveries []WebhookDelivery, err error)
+}
+
+//go:generate mockery --name=WebhookSender
+type WebhookSender interface {
+	Send(ctx context.Context, webhook Webhook, event Event) (statusCode int, err error)
+}
@@ -0,0 +1,710 @@
+package driven
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/fx"
+)
+
+// boltIndexedName is how many bytes of a name the name indexes hold
+const boltIndexedName = 1024
+
+var (
+	boltUsersBucket     = []byte("users")
+	boltNameBucket      = []byte("index::name")
+	boltNameFoldBucket  = []byte("index::name::fold")
+	boltEmailBucket     = []byte("index::email")
+	boltExpiryBucket    = []byte("index::expiry")
+	boltOutboxBucket    = []byte("outbox")
+	boltOutboxIDsBucket = []byte("outbox::ids")
+)
+
+var (
+	_ domain.UserStorage = (*BoltStorage)(nil)
+	_ domain.Outbox      = (*BoltStorage)(nil)
+	_ domain.UserExpiry  = (*BoltStorage)(nil)
+	_ domain.Readiness   = (*BoltStorage)(nil)
+)
+
+// errBatchAborted rolls back the transaction of an atomic batch that has a failed mutation
+var errBatchAborted = errors.New("batch aborted")
+
+// BoltStorage keeps the users in a single file for deployments without a database server.
+// bbolt has no write-ahead log: pages are copied on write and every commit is synced, so a crash leaves the last commit.
+type BoltStorage struct {
+	db    *bolt.DB
+	ready chan struct{}
+}
+
+func NewBoltStorage(lc fx.Lifecycle, cfg *config.Config) (*BoltStorage, error) {
+	// the timeout bounds the wait for the file lock that another process may hold
+	db, err := bolt.Open(cfg.Bolt.Path, 0o600, &bolt.Options{Timeout: cfg.Bolt.Timeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bolt file: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			boltUsersBucket, boltNameBucket, boltNameFoldBucket, boltEmailBucket, boltExpiryBucket,
+			boltOutboxBucket, boltOutboxIDsBucket,
+		} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("error creating bolt buckets: %w", err)
+	}
+
+	b := &BoltStorage{
+		db:    db,
+		ready: make(chan struct{}),
+	}
+
+	close(b.ready)
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			err := b.db.Close()
+			if err != nil {
+				return fmt.Errorf("error closing bolt file: %w", err)
+			}
+
+			return nil
+		},
+	})
+
+	return b, nil
+}
+
+// Ready is closed from the start, the file is open once the storage is created
+func (b BoltStorage) Ready() <-chan struct{} {
+	return b.ready
+}
+
+func (b BoltStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) (err error) {
+	err = b.update(ctx, func(tx *bolt.Tx) error {
+		id := user.ID.String()
+
+		previous, txErr := b.readUser(tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		txErr = b.checkEmail(tx, id, user.Email)
+		if txErr != nil {
+			return txErr
+		}
+
+		txErr = b.put(tx, id, newUserRecord(user.Name, user.Email, user.ExpiresAt), previous)
+		if txErr != nil {
+			return txErr
+		}
+
+		return b.appendOutbox(tx, events)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrorConflict) {
+			return
+		}
+
+		err = fmt.Errorf("error storing to bolt: %w", err)
+	}
+
+	return
+}
+
+func (b BoltStorage) Read(ctx context.Context, id string) (user domain.User, err error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return user, fmt.Errorf("%w: malformed id %q", domain.ErrorInvalidInput, id)
+	}
+
+	err = b.view(ctx, func(tx *bolt.Tx) error {
+		stored, txErr := b.readUser(tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		if !stored.exists || stored.expired(time.Now()) {
+			return domain.ErrorNotFound
+		}
+
+		user = stored.user(parsed)
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, domain.ErrorNotFound) {
+		err = fmt.Errorf("error reading from bolt: %w", err)
+	}
+
+	return
+}
+
+func (b BoltStorage) Delete(ctx context.Context, id string, events ...domain.Event) (err error) {
+	err = b.update(ctx, func(tx *bolt.Tx) error {
+		previous, txErr := b.readUser(tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		if !previous.exists || previous.expired(time.Now()) {
+			return domain.ErrorNotFound
+		}
+
+		txErr = b.remove(tx, id, previous)
+		if txErr != nil {
+			return txErr
+		}
+
+		return b.appendOutbox(tx, events)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return
+		}
+
+		err = fmt.Errorf("error deleting from bolt: %w", err)
+	}
+
+	return
+}
+
+// Batch applies the mutations in one transaction, each one sees the changes of those before it
+func (b BoltStorage) Batch(ctx context.Context, mutations []domain.UserMutation, atomic bool) (results []error, err error) {
+	err = b.update(ctx, func(tx *bolt.Tx) error {
+		results = make([]error, len(mutations))
+		failed := false
+
+		for i, mutation := range mutations {
+			applied, txErr := b.apply(tx, mutation)
+			if txErr != nil {
+				return txErr
+			}
+
+			if applied != nil {
+				results[i] = applied
+				failed = true
+			}
+		}
+
+		if atomic && failed {
+			for i := range results {
+				if results[i] == nil {
+					results[i] = domain.ErrorAborted
+				}
+			}
+
+			return errBatchAborted
+		}
+
+		return nil
+	})
+	if errors.Is(err, errBatchAborted) {
+		return results, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error batch in bolt: %w", err)
+	}
+
+	return results, nil
+}
+
+// apply checks the mutation before changing anything, so a rejected one leaves the transaction as it was
+func (b BoltStorage) apply(tx *bolt.Tx, mutation domain.UserMutation) (rejected error, err error) {
+	previous, err := b.readUser(tx, mutation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mutation.Op != domain.BatchCreate && (!previous.exists || previous.expired(time.Now())) {
+		return domain.ErrorNotFound, nil
+	}
+
+	if mutation.Op == domain.BatchDelete {
+		err = b.remove(tx, mutation.ID, previous)
+	} else {
+		err = b.checkEmail(tx, mutation.ID, mutation.Email)
+		if errors.Is(err, domain.ErrorConflict) {
+			return domain.ErrorConflict, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = b.put(tx, mutation.ID, newUserRecord(mutation.Name, mutation.Email, mutation.ExpiresAt), previous)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, b.appendOutbox(tx, []domain.Event{mutation.Event})
+}
+
+func (b BoltStorage) readUser(tx *bolt.Tx, id string) (user storedUser, err error) {
+	value := tx.Bucket(boltUsersBucket).Get([]byte(id))
+	if value == nil {
+		return user, nil
+	}
+
+	return storedUser{userRecord: decodeUser(string(value)), exists: true}, nil
+}
+
+// checkEmail fails with ErrorConflict when another user holds the email, expired users have given it up
+func (b BoltStorage) checkEmail(tx *bolt.Tx, id, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	owner := tx.Bucket(boltEmailBucket).Get([]byte(emailClaim(email)))
+	if owner == nil || string(owner) == id {
+		return nil
+	}
+
+	previous, err := b.readUser(tx, string(owner))
+	if err != nil {
+		return err
+	}
+
+	if previous.exists && !previous.expired(time.Now()) {
+		return fmt.Errorf("%w: email %q is taken", domain.ErrorConflict, email)
+	}
+
+	return nil
+}
+
+// put replaces the user and moves its index entries and email claim from the previous values to the new ones
+func (b BoltStorage) put(tx *bolt.Tx, id string, record userRecord, previous storedUser) error {
+	value, err := encodeUser(record)
+	if err != nil {
+		return err
+	}
+
+	err = b.release(tx, id, previous)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(boltUsersBucket).Put([]byte(id), []byte(value))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(boltNameBucket).Put(nameIndexMember(record.Name, id), nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(boltNameFoldBucket).Put(nameIndexMember(strings.ToLower(record.Name), id), nil)
+	if err != nil {
+		return err
+	}
+
+	if record.ExpiresAt != 0 {
+		err = tx.Bucket(boltExpiryBucket).Put(expiryMember(record.ExpiresAt, id), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if record.Email == "" {
+		return nil
+	}
+
+	return tx.Bucket(boltEmailBucket).Put([]byte(emailClaim(record.Email)), []byte(id))
+}
+
+func (b BoltStorage) remove(tx *bolt.Tx, id string, previous storedUser) error {
+	err := b.release(tx, id, previous)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltUsersBucket).Delete([]byte(id))
+}
+
+// release drops the index entries and the email claim of the user that is replaced or deleted,
+// an expired user may have lost its email to another user already
+func (b BoltStorage) release(tx *bolt.Tx, id string, previous storedUser) error {
+	if !previous.exists {
+		return nil
+	}
+
+	err := tx.Bucket(boltNameBucket).Delete(nameIndexMember(previous.Name, id))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(boltNameFoldBucket).Delete(nameIndexMember(strings.ToLower(previous.Name), id))
+	if err != nil {
+		return err
+	}
+
+	if previous.ExpiresAt != 0 {
+		err = tx.Bucket(boltExpiryBucket).Delete(expiryMember(previous.ExpiresAt, id))
+		if err != nil {
+			return err
+		}
+	}
+
+	if previous.Email == "" {
+		return nil
+	}
+
+	emails := tx.Bucket(boltEmailBucket)
+	email := []byte(emailClaim(previous.Email))
+
+	if !bytes.Equal(emails.Get(email), []byte(id)) {
+		return nil
+	}
+
+	return emails.Delete(email)
+}
+
+// ExpireUsers deletes the expired users in the order of their expiry
+func (b BoltStorage) ExpireUsers(ctx context.Context, now time.Time, limit int, event domain.ExpiryEvent) (expired int, err error) {
+	due := binary.BigEndian.AppendUint64(nil, uint64(now.UnixMilli()))
+
+	err = b.update(ctx, func(tx *bolt.Tx) error {
+		expired = 0
+		// members are collected first, since deleting moves the cursor
+		var members [][]byte
+
+		c := tx.Bucket(boltExpiryBucket).Cursor()
+		for member, _ := c.First(); member != nil && len(members) < limit; member, _ = c.Next() {
+			if bytes.Compare(member[:8], due) > 0 {
+				break
+			}
+
+			members = append(members, bytes.Clone(member))
+		}
+
+		for _, member := range members {
+			id := string(member[8:])
+
+			user, txErr := b.readUser(tx, id)
+			if txErr != nil {
+				return txErr
+			}
+
+			// the member outlived its user, it is not in the way of the next sweep
+			if !user.expired(now) {
+				txErr = tx.Bucket(boltExpiryBucket).Delete(member)
+				if txErr != nil {
+					return txErr
+				}
+
+				continue
+			}
+
+			txErr = b.remove(tx, id, user)
+			if txErr != nil {
+				return txErr
+			}
+
+			txErr = b.appendOutbox(tx, []domain.Event{event(ctx, id)})
+			if txErr != nil {
+				return txErr
+			}
+
+			expired++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error expiring users in bolt: %w", err)
+	}
+
+	return expired, nil
+}
+
+// appendOutbox queues events in the same transaction as the data change, keyed by a sequence to keep their order
+func (b BoltStorage) appendOutbox(tx *bolt.Tx, events []domain.Event) error {
+	outbox := tx.Bucket(boltOutboxBucket)
+
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding event: %w", err)
+		}
+
+		seq, err := outbox.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := binary.BigEndian.AppendUint64(nil, seq)
+
+		err = outbox.Put(key, payload)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(boltOutboxIDsBucket).Put([]byte(event.ID), key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LeaseRelay is always held, bolt locks its file to a single process
+func (b BoltStorage) LeaseRelay(context.Context, string, time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (b BoltStorage) Pending(ctx context.Context, limit int) (events []domain.Event, err error) {
+	err = b.view(ctx, func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltOutboxBucket).Cursor()
+
+		for key, payload := cursor.First(); key != nil && len(events) < limit; key, payload = cursor.Next() {
+			var event domain.Event
+
+			txErr := json.Unmarshal(payload, &event)
+			if txErr != nil {
+				return fmt.Errorf("error decoding outbox event %x: %w", key, txErr)
+			}
+
+			events = append(events, event)
+		}
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error reading outbox from bolt: %w", err)
+	}
+
+	return
+}
+
+func (b BoltStorage) Ack(ctx context.Context, ids ...string) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	err = b.update(ctx, func(tx *bolt.Tx) error {
+		outboxIDs := tx.Bucket(boltOutboxIDsBucket)
+
+		for _, id := range ids {
+			key := outboxIDs.Get([]byte(id))
+			if key == nil {
+				continue
+			}
+
+			txErr := tx.Bucket(boltOutboxBucket).Delete(key)
+			if txErr != nil {
+				return txErr
+			}
+
+			txErr = outboxIDs.Delete([]byte(id))
+			if txErr != nil {
+				return txErr
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error acking outbox events in bolt: %w", err)
+	}
+
+	return
+}
+
+// List pages through the users in the order of their ids, the cursor is the last id of the previous page
+func (b BoltStorage) List(ctx context.Context, cursor string, limit int) (users []domain.User, next string, err error) {
+	if cursor != "" {
+		_, err = uuid.Parse(cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: malformed cursor %q", domain.ErrorInvalidInput, cursor)
+		}
+	}
+
+	now := time.Now()
+
+	err = b.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltUsersBucket).Cursor()
+
+		key, value := c.First()
+		if cursor != "" {
+			key, value = c.Seek([]byte(cursor))
+			if bytes.Equal(key, []byte(cursor)) {
+				key, value = c.Next()
+			}
+		}
+
+		for ; key != nil; key, value = c.Next() {
+			if len(users) == limit {
+				next = users[limit-1].ID.String()
+
+				return nil
+			}
+
+			txErr := ctx.Err()
+			if txErr != nil {
+				return txErr
+			}
+
+			id, txErr := uuid.ParseBytes(key)
+			if txErr != nil {
+				return fmt.Errorf("malformed user key %q: %w", key, txErr)
+			}
+
+			if record := decodeUser(string(value)); !record.expired(now) {
+				users = append(users, record.user(id))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing bolt: %w", err)
+	}
+
+	return users, next, nil
+}
+
+func (b BoltStorage) Search(ctx context.Context, query domain.NameQuery, limit int) (users []domain.User, err error) {
+	index, name := boltNameBucket, query.Name
+	if query.IgnoreCase {
+		index, name = boltNameFoldBucket, strings.ToLower(name)
+	}
+
+	// members are name, separator, id, so an exact match is the range of members starting with name and separator.
+	// Members hold the start of long names only, so the names of the users found are matched once more.
+	indexed := indexedName(name)
+
+	prefix := []byte(indexed + nameSeparator)
+	if query.Prefix && indexed == name {
+		prefix = []byte(name)
+	}
+
+	matches := func(user domain.User) bool {
+		found := user.Name
+		if query.IgnoreCase {
+			found = strings.ToLower(found)
+		}
+
+		if query.Prefix {
+			return strings.HasPrefix(found, name)
+		}
+
+		return found == name
+	}
+
+	now := time.Now()
+
+	err = b.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(index).Cursor()
+		userBucket := tx.Bucket(boltUsersBucket)
+
+		for member, _ := c.Seek(prefix); bytes.HasPrefix(member, prefix) && len(users) < limit; member, _ = c.Next() {
+			txErr := ctx.Err()
+			if txErr != nil {
+				return txErr
+			}
+
+			id := member[bytes.LastIndex(member, []byte(nameSeparator))+1:]
+
+			parsed, txErr := uuid.ParseBytes(id)
+			if txErr != nil {
+				return fmt.Errorf("malformed index member %q: %w", member, txErr)
+			}
+
+			value := userBucket.Get(id)
+			if value == nil {
+				continue
+			}
+
+			record := decodeUser(string(value))
+			if record.expired(now) {
+				continue
+			}
+
+			user := record.user(parsed)
+			if matches(user) {
+				users = append(users, user)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching bolt: %w", err)
+	}
+
+	return users, nil
+}
+
+// update runs fn in a write transaction, which is rolled back when ctx is done before it commits
+func (b BoltStorage) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Err()
+	})
+}
+
+func (b BoltStorage) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return b.db.View(fn)
+}
+
+// expiryMember sorts the expiring users by their expiry, as big endian milliseconds followed by the id
+func expiryMember(expiresAt int64, id string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(expiresAt)), id...)
+}
+
+func nameIndexMember(name, id string) []byte {
+	return []byte(indexedName(name) + nameSeparator + id)
+}
+
+// indexedName is the start of name that goes into index keys, which bolt limits to 32KiB
+func indexedName(name string) string {
+	if len(name) <= boltIndexedName {
+		return name
+	}
+
+	end := boltIndexedName
+	for !utf8.RuneStart(name[end]) {
+		end--
+	}
+
+	return name[:end]
+}
@@ -0,0 +1,102 @@
+package driven
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx/fxtest"
+)
+
+type BoltStorageTestSuite struct {
+	suite.Suite
+	storage *BoltStorage
+	cfg     *config.Config
+	name    string
+}
+
+func (s *BoltStorageTestSuite) SetupSuite() {
+	s.name = gofakeit.Username()
+	s.cfg = &config.Config{
+		Bolt: config.BoltConfig{
+			Path:    filepath.Join(s.T().TempDir(), "users.db"),
+			Timeout: 100 * time.Millisecond,
+		},
+	}
+
+	lc := fxtest.NewLifecycle(s.T())
+
+	var err error
+
+	s.storage, err = NewBoltStorage(lc, s.cfg)
+	s.Require().NoError(err)
+
+	lc.RequireStart()
+	s.T().Cleanup(lc.RequireStop)
+}
+
+func (s *BoltStorageTestSuite) TestContract() {
+	storagetest.Run(s.T(), func(t *testing.T) domain.UserStorage {
+		cfg := *s.cfg
+		cfg.Bolt.Path = filepath.Join(t.TempDir(), "users.db")
+
+		lc := fxtest.NewLifecycle(t)
+
+		storage, err := NewBoltStorage(lc, &cfg)
+		require.NoError(t, err)
+
+		lc.RequireStart()
+		t.Cleanup(lc.RequireStop)
+
+		return storage
+	})
+}
+
+func (s *BoltStorageTestSuite) Test5Outbox() {
+	ctx := context.Background()
+	id := gofakeit.UUID()
+	created := domain.NewEvent(ctx, domain.EventUserCreated, id, s.name)
+	deleted := domain.NewEvent(ctx, domain.EventUserDeleted, id, "")
+
+	s.Require().NoError(s.storage.Store(ctx, domain.User{ID: uuid.MustParse(id), Name: s.name}, created))
+	s.Require().NoError(s.storage.Delete(ctx, id, deleted))
+
+	events, err := s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+	s.Require().Equal(created.ID, events[0].ID)
+	s.Require().Equal(s.name, events[0].Name)
+	s.Require().True(created.OccurredAt.Equal(events[0].OccurredAt))
+	s.Require().Equal(deleted.ID, events[1].ID)
+
+	s.Require().NoError(s.storage.Ack(ctx, created.ID))
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+	s.Require().Equal(deleted.ID, events[0].ID)
+
+	s.Require().NoError(s.storage.Ack(ctx, deleted.ID))
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Empty(events)
+}
+
+func (s *BoltStorageTestSuite) Test11Locked() {
+	_, err := NewBoltStorage(fxtest.NewLifecycle(s.T()), s.cfg)
+	s.Require().Error(err)
+}
+
+func TestBoltStorage(t *testing.T) {
+	suite.Run(t, new(BoltStorageTestSuite))
+}
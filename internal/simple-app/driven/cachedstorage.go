@@ -0,0 +1,317 @@
+package driven
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.uber.org/zap"
+)
+
+var _ domain.UserStorage = (*CachedStorage)(nil)
+
+const (
+	// cacheTenantSeparator puts the tenant in front of the id in the cache keys, it cannot be part of either
+	cacheTenantSeparator = "/"
+	// cacheWildcard takes the place of the id to invalidate every user of a tenant
+	cacheWildcard = "*"
+)
+
+// cacheMetrics adds up the hits and misses of every cache in the process, it is served at /admin/debug/vars
+var cacheMetrics = expvar.NewMap("user_cache")
+
+// CacheInvalidator tells the other replicas which users changed, so they drop their cached copies.
+// The keys are the ids of the users, prefixed with their tenant if they have one, see TenantInvalidation for all of them
+type CacheInvalidator interface {
+	Invalidate(ctx context.Context, keys ...string) error
+	OnInvalidate(evict func(keys ...string))
+}
+
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+type cacheEntry struct {
+	user    domain.User
+	found   bool
+	expires time.Time
+}
+
+// CachedStorage reads users through an LRU cache, it remembers for a while that users do not exist as well
+type CachedStorage struct {
+	storage     domain.UserStorage
+	invalidator CacheInvalidator
+	log         *zap.Logger
+	entries     *lru.Cache[string, cacheEntry]
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// generation changes on every eviction, so a read that raced a write does not cache what it read
+	mu         sync.Mutex
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewCachedStorage wraps storage, invalidator may be nil when there is a single replica
+func NewCachedStorage(
+	cfg *config.Config,
+	storage domain.UserStorage,
+	invalidator CacheInvalidator,
+	log *zap.Logger,
+) (*CachedStorage, error) {
+	entries, err := lru.New[string, cacheEntry](cfg.Cache.Size)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user cache: %w", err)
+	}
+
+	c := &CachedStorage{
+		storage:     storage,
+		invalidator: invalidator,
+		log:         log,
+		entries:     entries,
+		ttl:         cfg.Cache.TTL,
+		negativeTTL: cfg.Cache.NegativeTTL,
+	}
+
+	if invalidator != nil {
+		invalidator.OnInvalidate(c.evict)
+	}
+
+	return c, nil
+}
+
+func (c *CachedStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) error {
+	err := c.storage.Store(ctx, user, events...)
+	// a failed write may still have been applied, so the user is invalidated either way
+	c.invalidate(ctx, user.ID.String())
+
+	return err
+}
+
+func (c *CachedStorage) Read(ctx context.Context, id string) (domain.User, error) {
+	err := ctx.Err()
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return c.storage.Read(ctx, id)
+	}
+
+	id = parsed.String()
+	key := cacheKey(domain.TenantFromContext(ctx), parsed)
+
+	entry, ok := c.entries.Get(key)
+	if ok && time.Now().Before(entry.expires) {
+		c.hits.Add(1)
+		cacheMetrics.Add("hits", 1)
+
+		if !entry.found {
+			return domain.User{}, domain.ErrorNotFound
+		}
+
+		return entry.user, nil
+	}
+
+	c.misses.Add(1)
+	cacheMetrics.Add("misses", 1)
+
+	generation := c.currentGeneration()
+
+	user, err := c.storage.Read(ctx, id)
+
+	switch {
+	case err == nil:
+		expires := time.Now().Add(c.ttl)
+		if !user.ExpiresAt.IsZero() && user.ExpiresAt.Before(expires) {
+			// an expiring user leaves the cache when it leaves the storage
+			expires = user.ExpiresAt
+		}
+
+		c.add(key, generation, cacheEntry{user: user, found: true, expires: expires})
+	case errors.Is(err, domain.ErrorNotFound) && c.negativeTTL > 0:
+		c.add(key, generation, cacheEntry{expires: time.Now().Add(c.negativeTTL)})
+	}
+
+	return user, err
+}
+
+func (c *CachedStorage) Delete(ctx context.Context, id string, events ...domain.Event) error {
+	err := c.storage.Delete(ctx, id, events...)
+	c.invalidate(ctx, id)
+
+	return err
+}
+
+func (c *CachedStorage) Batch(
+	ctx context.Context,
+	mutations []domain.UserMutation,
+	allOrNothing bool,
+) ([]error, error) {
+	results, err := c.storage.Batch(ctx, mutations, allOrNothing)
+
+	ids := make([]string, len(mutations))
+	for i, mutation := range mutations {
+		ids[i] = mutation.ID
+	}
+
+	c.invalidate(ctx, ids...)
+
+	return results, err
+}
+
+func (c *CachedStorage) List(ctx context.Context, cursor string, limit int) ([]domain.User, string, error) {
+	return c.storage.List(ctx, cursor, limit)
+}
+
+func (c *CachedStorage) Search(ctx context.Context, query domain.NameQuery, limit int) ([]domain.User, error) {
+	return c.storage.Search(ctx, query, limit)
+}
+
+// Stats tells how many reads this cache answered and how many it passed on to the storage
+func (c *CachedStorage) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// invalidate evicts the users here and tells the other replicas to do the same
+func (c *CachedStorage) invalidate(ctx context.Context, ids ...string) {
+	tenant := domain.TenantFromContext(ctx)
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if parsed, err := uuid.Parse(id); err == nil {
+			keys = append(keys, cacheKey(tenant, parsed))
+		}
+	}
+
+	c.publish(ctx, keys...)
+}
+
+// InvalidateTenant drops every cached user of the tenant of ctx, here and on the other replicas
+func (c *CachedStorage) InvalidateTenant(ctx context.Context) {
+	c.publish(ctx, TenantInvalidation(domain.TenantFromContext(ctx)))
+}
+
+func (c *CachedStorage) publish(ctx context.Context, keys ...string) {
+	c.evict(keys...)
+
+	if c.invalidator == nil {
+		return
+	}
+
+	// the write has happened by now, so a cancelled request must not keep the other replicas stale
+	err := c.invalidator.Invalidate(context.WithoutCancel(ctx), keys...)
+	if err != nil {
+		c.log.Warn("error invalidating cached users, other replicas serve them until they expire",
+			zap.Strings("keys", keys), zap.Error(err))
+	}
+}
+
+func (c *CachedStorage) evict(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for _, key := range keys {
+		tenant, id := splitCacheKey(key)
+
+		if id == cacheWildcard {
+			for _, cached := range c.entries.Keys() {
+				if cachedTenant, _ := splitCacheKey(cached); cachedTenant == tenant {
+					c.entries.Remove(cached)
+				}
+			}
+
+			continue
+		}
+
+		if parsed, err := uuid.Parse(id); err == nil {
+			c.entries.Remove(cacheKey(tenant, parsed))
+		}
+	}
+}
+
+// TenantInvalidation is the key that invalidates every user of the tenant, for writes that bypass the cache
+func TenantInvalidation(tenant string) string {
+	if tenant == "" {
+		return cacheWildcard
+	}
+
+	return tenant + cacheTenantSeparator + cacheWildcard
+}
+
+// cacheKey keeps the users of different tenants apart
+func cacheKey(tenant string, id uuid.UUID) string {
+	if tenant == "" {
+		return id.String()
+	}
+
+	return tenant + cacheTenantSeparator + id.String()
+}
+
+func splitCacheKey(key string) (tenant, id string) {
+	if i := strings.LastIndex(key, cacheTenantSeparator); i >= 0 {
+		return key[:i], key[i+len(cacheTenantSeparator):]
+	}
+
+	return "", key
+}
+
+func (c *CachedStorage) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *CachedStorage) add(key string, generation uint64, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.entries.Add(key, entry)
+}
+
+var _ domain.TenantStorage = (*CachedTenantStorage)(nil)
+
+// CachedTenantStorage drops the cached users of a purged tenant on every replica, which would serve them until they expire otherwise
+type CachedTenantStorage struct {
+	domain.TenantStorage
+	cache *CachedStorage
+}
+
+func NewCachedTenantStorage(storage domain.TenantStorage, cache *CachedStorage) *CachedTenantStorage {
+	return &CachedTenantStorage{
+		TenantStorage: storage,
+		cache:         cache,
+	}
+}
+
+func (c *CachedTenantStorage) PurgeTenant(ctx context.Context, tenant string) (int64, error) {
+	users, err := c.TenantStorage.PurgeTenant(ctx, tenant)
+	// a purge that failed halfway has deleted some of the users already
+	c.cache.InvalidateTenant(domain.WithTenant(ctx, tenant))
+
+	return users, err
+}
@@ -0,0 +1,236 @@
+package driven
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// memoryInvalidator stands in for the redis channel between replicas
+type memoryInvalidator struct {
+	mu     sync.Mutex
+	evicts []func(keys ...string)
+}
+
+func (m *memoryInvalidator) Invalidate(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, evict := range m.evicts {
+		evict(keys...)
+	}
+
+	return nil
+}
+
+func (m *memoryInvalidator) OnInvalidate(evict func(keys ...string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evicts = append(m.evicts, evict)
+}
+
+func newCacheTestStorage(t *testing.T) *BoltStorage {
+	lc := fxtest.NewLifecycle(t)
+
+	storage, err := NewBoltStorage(lc, &config.Config{
+		Bolt: config.BoltConfig{Path: filepath.Join(t.TempDir(), "users.db"), Timeout: time.Second},
+	})
+	require.NoError(t, err)
+
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+
+	return storage
+}
+
+func newTestCache(t *testing.T, storage domain.UserStorage, invalidator CacheInvalidator) *CachedStorage {
+	cache, err := NewCachedStorage(&config.Config{
+		Cache: config.CacheConfig{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute},
+	}, storage, invalidator, zap.NewNop())
+	require.NoError(t, err)
+
+	return cache
+}
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+
+	storagetest.Run(t, func(t *testing.T) domain.UserStorage {
+		return newTestCache(t, newCacheTestStorage(t), nil)
+	})
+
+	t.Run("read through", func(t *testing.T) {
+		cache := newTestCache(t, newCacheTestStorage(t), nil)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+		require.NoError(t, cache.Store(ctx, user))
+
+		for range 3 {
+			read, err := cache.Read(ctx, user.ID.String())
+			require.NoError(t, err)
+			require.Equal(t, user, read)
+		}
+
+		require.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+	})
+
+	t.Run("not found is cached", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		cache := newTestCache(t, storage, nil)
+		id := uuid.New()
+
+		_, err := cache.Read(ctx, id.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+
+		// written behind the cache's back, so only the negative entry answers
+		require.NoError(t, storage.Store(ctx, domain.User{ID: id, Name: gofakeit.Username()}))
+
+		_, err = cache.Read(ctx, id.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+		require.Equal(t, CacheStats{Hits: 1, Misses: 1}, cache.Stats())
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		cache, err := NewCachedStorage(&config.Config{
+			Cache: config.CacheConfig{Size: 100, TTL: time.Millisecond},
+		}, storage, nil, zap.NewNop())
+		require.NoError(t, err)
+
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+		require.NoError(t, cache.Store(ctx, user))
+
+		_, err = cache.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+
+		user.Name = gofakeit.Username()
+		require.NoError(t, storage.Store(ctx, user))
+
+		time.Sleep(5 * time.Millisecond)
+
+		read, err := cache.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+		require.Equal(t, CacheStats{Misses: 2}, cache.Stats())
+	})
+
+	t.Run("writes invalidate other replicas", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		invalidator := new(memoryInvalidator)
+		writer := newTestCache(t, storage, invalidator)
+		reader := newTestCache(t, storage, invalidator)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+		require.NoError(t, writer.Store(ctx, user))
+
+		_, err := reader.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+
+		user.Name = gofakeit.Username()
+		require.NoError(t, writer.Store(ctx, user))
+
+		read, err := reader.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+
+		results, err := writer.Batch(ctx, []domain.UserMutation{
+			{Op: domain.BatchDelete, ID: user.ID.String(), Event: domain.NewEvent(ctx, domain.EventUserDeleted, user.ID.String(), "")},
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, []error{nil}, results)
+
+		_, err = reader.Read(ctx, user.ID.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+
+		require.NoError(t, writer.Store(ctx, user))
+
+		// the upper case id is the same user, so the negative entry is gone for it as well
+		read, err = reader.Read(ctx, strings.ToUpper(user.ID.String()))
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+	})
+
+	t.Run("tenants are kept apart", func(t *testing.T) {
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+		id := user.ID.String()
+		acme, globex := domain.WithTenant(ctx, "acme"), domain.WithTenant(ctx, "globex")
+
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", acme, id).Return(user, nil).Once()
+		storage.On("Read", globex, id).Return(domain.User{}, domain.ErrorNotFound).Once()
+		storage.On("Store", globex, user).Return(nil).Once()
+		storage.On("Read", globex, id).Return(user, nil).Once()
+
+		invalidator := new(memoryInvalidator)
+		writer := newTestCache(t, storage, invalidator)
+		reader := newTestCache(t, storage, invalidator)
+
+		read, err := reader.Read(acme, id)
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+
+		// the same id in another tenant is another user
+		_, err = reader.Read(globex, id)
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+
+		require.NoError(t, writer.Store(globex, user))
+
+		read, err = reader.Read(globex, id)
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+
+		// the write in globex left the user of acme cached
+		_, err = reader.Read(acme, id)
+		require.NoError(t, err)
+		require.Equal(t, CacheStats{Hits: 1, Misses: 3}, reader.Stats())
+	})
+	t.Run("purged tenants are dropped on every replica", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		tenants := mocks.NewTenantStorage(t)
+		acme := domain.WithTenant(ctx, "acme")
+		globex := domain.WithTenant(ctx, "globex")
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Name()}
+		id := user.ID.String()
+
+		storage.On("Read", acme, id).Return(user, nil).Once()
+		storage.On("Read", globex, id).Return(user, nil).Once()
+		storage.On("Read", acme, id).Return(domain.User{}, domain.ErrorNotFound).Once()
+		tenants.On("PurgeTenant", ctx, "acme").Return(int64(1), nil).Once()
+
+		invalidator := new(memoryInvalidator)
+		writer := newTestCache(t, storage, invalidator)
+		reader := newTestCache(t, storage, invalidator)
+
+		for _, tenantCtx := range []context.Context{acme, globex} {
+			_, err := reader.Read(tenantCtx, id)
+			require.NoError(t, err)
+		}
+
+		purged, err := NewCachedTenantStorage(tenants, writer).PurgeTenant(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		_, err = reader.Read(acme, id)
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+
+		// globex is another tenant
+		_, err = reader.Read(globex, id)
+		require.NoError(t, err)
+		require.Equal(t, CacheStats{Hits: 1, Misses: 3}, reader.Stats())
+	})
+}
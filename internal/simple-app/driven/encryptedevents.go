@@ -0,0 +1,130 @@
+package driven
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"go.uber.org/zap"
+)
+
+var (
+	_ domain.EventStream   = (*EncryptedEventStream)(nil)
+	_ domain.WebhookSender = (*EncryptedWebhookSender)(nil)
+)
+
+// EncryptedEventStream decrypts the names in the events read from the stream, which holds them encrypted like the outbox.
+// An event whose name cannot be decrypted is passed on without it, so it does not hold up the events behind it.
+type EncryptedEventStream struct {
+	stream domain.EventStream
+	keys   *KeyRing
+	log    *zap.Logger
+}
+
+func NewEncryptedEventStream(keys *KeyRing, stream domain.EventStream, log *zap.Logger) *EncryptedEventStream {
+	return &EncryptedEventStream{
+		stream: stream,
+		keys:   keys,
+		log:    log,
+	}
+}
+
+func (e *EncryptedEventStream) RangeEvents(ctx context.Context, afterID string, count int) ([]domain.StreamEvent, error) {
+	events, err := e.stream.RangeEvents(ctx, afterID, count)
+
+	return e.open(events), err
+}
+
+func (e *EncryptedEventStream) LastEventID(ctx context.Context) (string, error) {
+	return e.stream.LastEventID(ctx)
+}
+
+func (e *EncryptedEventStream) ReadEvents(
+	ctx context.Context,
+	afterID string,
+	count int,
+	block time.Duration,
+) ([]domain.StreamEvent, error) {
+	events, err := e.stream.ReadEvents(ctx, afterID, count, block)
+
+	return e.open(events), err
+}
+
+func (e *EncryptedEventStream) open(events []domain.StreamEvent) []domain.StreamEvent {
+	for i := range events {
+		event, err := openEvent(e.keys, events[i].Event)
+		if err != nil {
+			e.log.Warn("error decrypting event, passing it on without the name",
+				zap.String("id", events[i].Event.ID), zap.Error(err))
+
+			event.Name = ""
+		}
+
+		events[i].Event = event
+	}
+
+	return events
+}
+
+// EncryptedWebhookSender decrypts the name in the event right before it is sent, the queued deliveries hold it encrypted
+type EncryptedWebhookSender struct {
+	sender domain.WebhookSender
+	keys   *KeyRing
+}
+
+func NewEncryptedWebhookSender(keys *KeyRing, sender domain.WebhookSender) *EncryptedWebhookSender {
+	return &EncryptedWebhookSender{
+		sender: sender,
+		keys:   keys,
+	}
+}
+
+func (e *EncryptedWebhookSender) Send(ctx context.Context, webhook domain.Webhook, event domain.Event) (int, error) {
+	event, err := openEvent(e.keys, event)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.sender.Send(ctx, webhook, event)
+}
+
+func sealEvents(keys *KeyRing, events []domain.Event) ([]domain.Event, error) {
+	sealed := make([]domain.Event, len(events))
+
+	for i, event := range events {
+		var err error
+
+		sealed[i], err = sealEvent(keys, event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sealed, nil
+}
+
+// sealEvent encrypts the name of the event, bound to its user like the name of the user itself
+func sealEvent(keys *KeyRing, event domain.Event) (domain.Event, error) {
+	if event.Name == "" {
+		return event, nil
+	}
+
+	var err error
+
+	event.Name, err = keys.Seal(event.Name, canonicalID(event.UserID))
+
+	return event, err
+}
+
+func openEvent(keys *KeyRing, event domain.Event) (domain.Event, error) {
+	name, err := keys.Open(event.Name, canonicalID(event.UserID))
+	if err != nil {
+		return event, fmt.Errorf("error decrypting event %s: %w", event.ID, err)
+	}
+
+	event.Name = name
+
+	return event, nil
+}
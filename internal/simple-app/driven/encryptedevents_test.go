@@ -0,0 +1,53 @@
+package driven
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEncryptedEvents(t *testing.T) {
+	ctx := context.Background()
+	ring := newTestKeyRing(t, "k1", map[string]string{"k1": newTestKey(t)})
+	name := gofakeit.Name()
+
+	sealed, err := sealEvent(ring, domain.NewEvent(ctx, domain.EventUserCreated, uuid.NewString(), name))
+	require.NoError(t, err)
+	require.NotEqual(t, name, sealed.Name)
+
+	t.Run("stream", func(t *testing.T) {
+		stream := mocks.NewEventStream(t)
+		// sealed for another user, so it cannot be opened as this one
+		moved := sealed
+		moved.UserID = uuid.NewString()
+
+		stream.On("RangeEvents", ctx, "0", 10).
+			Return([]domain.StreamEvent{{StreamID: "1-0", Event: sealed}, {StreamID: "2-0", Event: moved}}, nil).Once()
+
+		events, err := NewEncryptedEventStream(ring, stream, zap.NewNop()).RangeEvents(ctx, "0", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, name, events[0].Event.Name)
+		require.Empty(t, events[1].Event.Name, "an event that cannot be decrypted goes on without the name")
+	})
+
+	t.Run("webhook sender", func(t *testing.T) {
+		sender := mocks.NewWebhookSender(t)
+		webhook := domain.Webhook{ID: uuid.New()}
+		opened := sealed
+		opened.Name = name
+
+		sender.On("Send", ctx, webhook, opened).Return(200, nil).Once()
+
+		status, err := NewEncryptedWebhookSender(ring, sender).Send(ctx, webhook, sealed)
+		require.NoError(t, err)
+		require.Equal(t, 200, status)
+	})
+}
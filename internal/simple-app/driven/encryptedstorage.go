@@ -0,0 +1,286 @@
+package driven
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+)
+
+var _ domain.UserStorage = (*EncryptedStorage)(nil)
+
+// indexedEmailPrefix marks sealed emails, it is followed by the blind index of the email and the sealed email
+const indexedEmailPrefix = "idx1:"
+
+// EncryptedStorage encrypts the names and emails of the users, and the names in their events, before they reach
+// the storage and decrypts the users on the way back. Every value is bound to the id of its user. Sealed emails carry
+// their blind index, which the storages claim to keep emails unique. Events are decrypted where they leave the service,
+// see EncryptedEventStream and EncryptedWebhookSender.
+// Values stored before encryption was enabled are read as they are until they are written again or rotated,
+// until then a readable email and the same email sealed are not told apart.
+type EncryptedStorage struct {
+	storage domain.UserStorage
+	keys    *KeyRing
+}
+
+func NewEncryptedStorage(keys *KeyRing, storage domain.UserStorage) *EncryptedStorage {
+	return &EncryptedStorage{
+		storage: storage,
+		keys:    keys,
+	}
+}
+
+func (e *EncryptedStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) error {
+	sealed, err := e.seal(user)
+	if err != nil {
+		return err
+	}
+
+	events, err = sealEvents(e.keys, events)
+	if err != nil {
+		return err
+	}
+
+	return reveal(e.storage.Store(ctx, sealed, events...), sealed.Email, user.Email)
+}
+
+func (e *EncryptedStorage) Read(ctx context.Context, id string) (domain.User, error) {
+	user, err := e.storage.Read(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return e.open(user)
+}
+
+func (e *EncryptedStorage) Delete(ctx context.Context, id string, events ...domain.Event) error {
+	events, err := sealEvents(e.keys, events)
+	if err != nil {
+		return err
+	}
+
+	return e.storage.Delete(ctx, id, events...)
+}
+
+func (e *EncryptedStorage) List(ctx context.Context, cursor string, limit int) ([]domain.User, string, error) {
+	users, next, err := e.storage.List(ctx, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range users {
+		users[i], err = e.open(users[i])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return users, next, nil
+}
+
+func (e *EncryptedStorage) Batch(
+	ctx context.Context,
+	mutations []domain.UserMutation,
+	allOrNothing bool,
+) ([]error, error) {
+	sealed := make([]domain.UserMutation, len(mutations))
+
+	for i, mutation := range mutations {
+		var err error
+
+		if mutation.Op != domain.BatchDelete {
+			mutation.Name, mutation.Email, err = e.sealFields(canonicalID(mutation.ID), mutation.Name, mutation.Email)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		mutation.Event, err = sealEvent(e.keys, mutation.Event)
+		if err != nil {
+			return nil, err
+		}
+
+		sealed[i] = mutation
+	}
+
+	results, err := e.storage.Batch(ctx, sealed, allOrNothing)
+
+	for i := range results {
+		results[i] = reveal(results[i], sealed[i].Email, mutations[i].Email)
+	}
+
+	return results, err
+}
+
+// Search cannot look up names the storage only holds encrypted
+func (e *EncryptedStorage) Search(ctx context.Context, _ domain.NameQuery, _ int) ([]domain.User, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: names are encrypted at rest and cannot be searched", domain.ErrorInvalidInput)
+}
+
+// Rotate seals the names and emails that are not sealed with the active key again, page by page, and reports how many
+// users it did. It runs next to the service: every user is read again right before it is written, which narrows,
+// but does not close, the window in which a concurrent update is overwritten with the values read here.
+func (e *EncryptedStorage) Rotate(ctx context.Context, pageSize int) (checked, rotated int, err error) {
+	for user, err := range domain.AllUsers(ctx, e.storage, pageSize) {
+		if err != nil {
+			return checked, rotated, err
+		}
+
+		checked++
+
+		if !e.stale(user) {
+			continue
+		}
+
+		done, err := e.rotate(ctx, user.ID.String())
+		if err != nil {
+			return checked, rotated, fmt.Errorf("error rotating user %s: %w", user.ID, err)
+		}
+
+		if done {
+			rotated++
+		}
+	}
+
+	return checked, rotated, nil
+}
+
+func (e *EncryptedStorage) rotate(ctx context.Context, id string) (bool, error) {
+	user, err := e.storage.Read(ctx, id)
+
+	switch {
+	case errors.Is(err, domain.ErrorNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	case !e.stale(user):
+		return false, nil
+	}
+
+	user, err = e.open(user)
+	if err != nil {
+		return false, err
+	}
+
+	return true, e.Store(ctx, user)
+}
+
+// stale tells users with a value that is not sealed with the active key
+func (e *EncryptedStorage) stale(user domain.User) bool {
+	if e.keys.Stale(user.Name) {
+		return true
+	}
+
+	if user.Email == "" {
+		return false
+	}
+
+	_, email, ok := splitIndexedEmail(user.Email)
+
+	return !ok || e.keys.Stale(email)
+}
+
+func (e *EncryptedStorage) seal(user domain.User) (domain.User, error) {
+	var err error
+
+	user.Name, user.Email, err = e.sealFields(user.ID.String(), user.Name, user.Email)
+
+	return user, err
+}
+
+func (e *EncryptedStorage) sealFields(id, name, email string) (sealedName, sealedEmail string, err error) {
+	sealedName, err = e.keys.Seal(name, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	if email == "" {
+		return sealedName, "", nil
+	}
+
+	sealedEmail, err = e.keys.Seal(email, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the index ignores case, like the claims of readable emails
+	return sealedName, indexedEmailPrefix + e.keys.Index(strings.ToLower(email)) + ":" + sealedEmail, nil
+}
+
+func (e *EncryptedStorage) open(user domain.User) (domain.User, error) {
+	name, err := e.keys.Open(user.Name, user.ID.String())
+	if err != nil {
+		return domain.User{}, fmt.Errorf("error decrypting user %s: %w", user.ID, err)
+	}
+
+	user.Name = name
+
+	if _, sealed, ok := splitIndexedEmail(user.Email); ok {
+		user.Email, err = e.keys.Open(sealed, user.ID.String())
+		if err != nil {
+			return domain.User{}, fmt.Errorf("error decrypting email of user %s: %w", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// revealedError shows the readable email in the error of a storage that has only seen it sealed
+type revealedError struct {
+	err     error
+	message string
+}
+
+func (r revealedError) Error() string {
+	return r.message
+}
+
+func (r revealedError) Unwrap() error {
+	return r.err
+}
+
+func reveal(err error, sealed, email string) error {
+	if err == nil || sealed == "" || !strings.Contains(err.Error(), sealed) {
+		return err
+	}
+
+	return revealedError{err: err, message: strings.ReplaceAll(err.Error(), sealed, email)}
+}
+
+// emailClaim is what the storages claim an email by, so no two users share it:
+// the blind index of a sealed email and the email folded to lower case otherwise
+func emailClaim(email string) string {
+	if index, _, ok := splitIndexedEmail(email); ok {
+		return indexedEmailPrefix + index
+	}
+
+	return strings.ToLower(email)
+}
+
+func splitIndexedEmail(email string) (index, sealed string, ok bool) {
+	rest, ok := strings.CutPrefix(email, indexedEmailPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	return strings.Cut(rest, ":")
+}
+
+// canonicalID is the form the storages hand ids back in, so names stay bound to ids written in any case
+func canonicalID(id string) string {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return id
+	}
+
+	return parsed.String()
+}
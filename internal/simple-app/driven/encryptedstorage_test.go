@@ -0,0 +1,225 @@
+package driven
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// testIndexKey is shared by the rings of the tests, the index cannot change while emails are stored
+var testIndexKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", dataKeySize)))
+
+func newTestKey(t *testing.T) string {
+	key := make([]byte, dataKeySize)
+
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestKeyRing(t *testing.T, active string, keys map[string]string) *KeyRing {
+	ring, err := NewKeyRing(&config.Config{
+		Encryption: config.EncryptionConfig{Enabled: true, ActiveKey: active, Keys: keys, IndexKey: testIndexKey},
+	})
+	require.NoError(t, err)
+
+	return ring
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	keys := map[string]string{"old": newTestKey(t), "new": newTestKey(t)}
+	ring := newTestKeyRing(t, "old", keys)
+
+	storagetest.Run(t, func(t *testing.T) domain.UserStorage {
+		return NewEncryptedStorage(ring, newCacheTestStorage(t))
+	}, "search", "search large and unicode values")
+
+	t.Run("names and emails are encrypted at rest", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		encrypted := NewEncryptedStorage(ring, storage)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Name(), Email: gofakeit.Email()}
+		event := domain.NewEvent(ctx, domain.EventUserCreated, user.ID.String(), user.Name)
+
+		require.NoError(t, encrypted.Store(ctx, user, event))
+
+		stored, err := storage.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(stored.Name, sealedPrefix+"old:"))
+		require.NotContains(t, stored.Name, user.Name)
+		require.True(t, strings.HasPrefix(stored.Email, indexedEmailPrefix))
+		require.NotContains(t, stored.Email, user.Email)
+
+		pending, err := storage.Pending(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.True(t, strings.HasPrefix(pending[0].Name, sealedPrefix+"old:"), "the outbox holds the name encrypted")
+
+		opened, err := openEvent(ring, pending[0])
+		require.NoError(t, err)
+		require.Equal(t, user.Name, opened.Name)
+
+		read, err := encrypted.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+	})
+
+	t.Run("sealed emails stay unique", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		encrypted := NewEncryptedStorage(ring, storage)
+		email := gofakeit.Email()
+
+		require.NoError(t, encrypted.Store(ctx, domain.User{ID: uuid.New(), Name: gofakeit.Name(), Email: email}))
+
+		// the index ignores case, and another active key does not change it
+		taken := NewEncryptedStorage(newTestKeyRing(t, "new", keys), storage).
+			Store(ctx, domain.User{ID: uuid.New(), Name: gofakeit.Name(), Email: strings.ToUpper(email)})
+		require.ErrorIs(t, taken, domain.ErrorConflict)
+		require.ErrorContains(t, taken, strings.ToUpper(email), "the error tells the readable email")
+		require.NotContains(t, taken.Error(), indexedEmailPrefix)
+
+		results, err := encrypted.Batch(ctx, []domain.UserMutation{
+			{Op: domain.BatchCreate, ID: uuid.NewString(), Name: gofakeit.Name(), Email: email},
+		}, false)
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0], domain.ErrorConflict)
+	})
+
+	t.Run("names written before encryption are read as they are", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Name()}
+
+		require.NoError(t, storage.Store(ctx, user))
+
+		read, err := NewEncryptedStorage(ring, storage).Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+	})
+
+	t.Run("names are bound to their user", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		encrypted := NewEncryptedStorage(ring, storage)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Name()}
+
+		require.NoError(t, encrypted.Store(ctx, user))
+
+		stored, err := storage.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+
+		other := domain.User{ID: uuid.New(), Name: stored.Name}
+		require.NoError(t, storage.Store(ctx, other))
+
+		_, err = encrypted.Read(ctx, other.ID.String())
+		require.Error(t, err)
+	})
+
+	t.Run("unknown keys fail", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Name()}
+
+		require.NoError(t, NewEncryptedStorage(newTestKeyRing(t, "other", map[string]string{"other": newTestKey(t)}), storage).
+			Store(ctx, user))
+
+		_, err := NewEncryptedStorage(ring, storage).Read(ctx, user.ID.String())
+		require.ErrorContains(t, err, `key "other" is not in the ring`)
+	})
+
+	t.Run("search is not possible", func(t *testing.T) {
+		_, err := NewEncryptedStorage(ring, newCacheTestStorage(t)).Search(ctx, domain.NameQuery{Name: "name"}, 10)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		storage := newCacheTestStorage(t)
+		users := make(map[uuid.UUID]domain.User)
+
+		for range 5 {
+			user := domain.User{ID: uuid.New(), Name: gofakeit.Name(), Email: gofakeit.Email()}
+			users[user.ID] = user
+			require.NoError(t, NewEncryptedStorage(ring, storage).Store(ctx, user))
+		}
+
+		legacy := domain.User{ID: uuid.New(), Name: gofakeit.Name(), Email: gofakeit.Email()}
+		users[legacy.ID] = legacy
+		require.NoError(t, storage.Store(ctx, legacy))
+
+		rotated := NewEncryptedStorage(newTestKeyRing(t, "new", keys), storage)
+
+		checked, count, err := rotated.Rotate(ctx, 2)
+		require.NoError(t, err)
+		require.Equal(t, 6, checked)
+		require.Equal(t, 6, count)
+
+		for id, user := range users {
+			stored, err := storage.Read(ctx, id.String())
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(stored.Name, sealedPrefix+"new:"))
+			require.False(t, rotated.stale(stored))
+
+			read, err := rotated.Read(ctx, id.String())
+			require.NoError(t, err)
+			require.Equal(t, user, read)
+		}
+
+		_, count, err = rotated.Rotate(ctx, 2)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+}
+
+func TestNewKeyRing(t *testing.T) {
+	key := newTestKey(t)
+
+	ring, err := NewKeyRing(&config.Config{})
+	require.NoError(t, err)
+	require.Nil(t, ring, "no key ring while encryption is disabled")
+
+	t.Run("key file takes precedence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"active":"k2","keys":{"k1":"`+key+`","k2":"`+key+`"},"index_key":"`+key+`"}`), 0o600))
+
+		ring, err := NewKeyRing(&config.Config{
+			Encryption: config.EncryptionConfig{Enabled: true, KeyFile: path, ActiveKey: "k1", Keys: map[string]string{"k1": key}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "k2", ring.Active())
+	})
+
+	for name, cfg := range map[string]config.EncryptionConfig{
+		"no keys":             {ActiveKey: "k1"},
+		"unknown active key":  {ActiveKey: "k2", Keys: map[string]string{"k1": key}},
+		"short key":           {ActiveKey: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+		"key not in base64":   {ActiveKey: "k1", Keys: map[string]string{"k1": "not base64!"}},
+		"malformed key id":    {ActiveKey: "k:1", Keys: map[string]string{"k:1": key}},
+		"missing key file":    {KeyFile: filepath.Join(t.TempDir(), "missing.json")},
+		"key file not parsed": {KeyFile: os.DevNull},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.Enabled = true
+			cfg.IndexKey = key
+
+			_, err := NewKeyRing(&config.Config{Encryption: cfg})
+			require.Error(t, err)
+		})
+	}
+
+	for _, index := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := NewKeyRing(&config.Config{
+			Encryption: config.EncryptionConfig{Enabled: true, ActiveKey: "k1", Keys: map[string]string{"k1": key}, IndexKey: index},
+		})
+		require.ErrorContains(t, err, "index key")
+	}
+}
@@ -0,0 +1,52 @@
+package driven
+
+import (
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+)
+
+const eventEnvelopeVersion = 1
+
+// EventEnvelope is the versioned payload every event leaves the service in
+type EventEnvelope struct {
+	Version    int               `json:"version"`
+	ID         string            `json:"id"`
+	Type       domain.EventType  `json:"type"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Data       EventUserData     `json:"data"`
+	Trace      map[string]string `json:"trace,omitempty"`
+}
+
+type EventUserData struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+func NewEventEnvelope(event domain.Event) EventEnvelope {
+	return EventEnvelope{
+		Version:    eventEnvelopeVersion,
+		ID:         event.ID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Tenant:     event.Tenant,
+		Data: EventUserData{
+			ID:   event.UserID,
+			Name: event.Name,
+		},
+		Trace: event.Trace,
+	}
+}
+
+func (e EventEnvelope) Event() domain.Event {
+	return domain.Event{
+		ID:         e.ID,
+		Type:       e.Type,
+		UserID:     e.Data.ID,
+		Name:       e.Data.Name,
+		OccurredAt: e.OccurredAt,
+		Tenant:     e.Tenant,
+		Trace:      e.Trace,
+	}
+}
@@ -0,0 +1,257 @@
+package driven
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+)
+
+// sealedPrefix marks encrypted values, it is followed by the key id and the sealed envelope
+const sealedPrefix = "enc1:"
+
+// dataKeySize makes the data keys, like the keys of the ring, AES-256 keys
+const dataKeySize = 32
+
+// keyIDPattern keeps key ids out of the way of the separator of sealed values
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// keyFile is the layout of the key file, the keys are base64 encoded
+type keyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+	Index  string            `json:"index_key"`
+}
+
+// KeyRing seals values with envelope encryption: every value gets a random data key,
+// which is sealed in turn with the active key of the ring. The id of that key travels with the value,
+// so values sealed with a retired key can still be opened as long as the key stays in the ring.
+type KeyRing struct {
+	active string
+	keys   map[string]cipher.AEAD
+	index  []byte
+}
+
+// NewKeyRing loads the keys of the configuration, it returns nil while encryption is disabled
+func NewKeyRing(cfg *config.Config) (*KeyRing, error) {
+	if !cfg.Encryption.Enabled {
+		return nil, nil
+	}
+
+	file := keyFile{Active: cfg.Encryption.ActiveKey, Keys: cfg.Encryption.Keys, Index: cfg.Encryption.IndexKey}
+
+	if cfg.Encryption.KeyFile != "" {
+		content, err := os.ReadFile(cfg.Encryption.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key file: %w", err)
+		}
+
+		file = keyFile{}
+
+		err = json.Unmarshal(content, &file)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key file: %w", err)
+		}
+	}
+
+	return newKeyRing(file.Active, file.Keys, file.Index)
+}
+
+func newKeyRing(active string, encoded map[string]string, index string) (*KeyRing, error) {
+	if len(encoded) == 0 {
+		return nil, errors.New("error loading key ring: no keys")
+	}
+
+	k := &KeyRing{
+		active: active,
+		keys:   make(map[string]cipher.AEAD, len(encoded)),
+	}
+
+	for id, value := range encoded {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("error loading key ring: malformed key id %q, expected letters, digits, dots, dashes and underscores", id)
+		}
+
+		key, err := decodeKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key %s: %w", id, err)
+		}
+
+		k.keys[id], err = newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key %s: %w", id, err)
+		}
+	}
+
+	if _, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("error loading key ring: active key %q is not in the ring", active)
+	}
+
+	var err error
+
+	k.index, err = decodeKey(index)
+	if err != nil {
+		return nil, fmt.Errorf("error loading index key: %w", err)
+	}
+
+	return k, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", dataKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// Active is the id of the key new values are sealed with
+func (k *KeyRing) Active() string {
+	return k.active
+}
+
+// Seal encrypts the value, aad binds it to its context so it cannot be moved elsewhere unnoticed
+func (k *KeyRing) Seal(value, aad string) (string, error) {
+	dataKey := make([]byte, dataKeySize)
+
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("error generating data key: %w", err)
+	}
+
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("error sealing value: %w", err)
+	}
+
+	// the envelope is the sealed data key followed by the sealed value
+	envelope, err := seal(k.keys[k.active], nil, dataKey, []byte(k.active))
+	if err != nil {
+		return "", err
+	}
+
+	envelope, err = seal(data, envelope, []byte(value), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return sealedPrefix + k.active + ":" + base64.RawStdEncoding.EncodeToString(envelope), nil
+}
+
+// Open decrypts a sealed value, values that are not sealed are returned as they are
+func (k *KeyRing) Open(value, aad string) (string, error) {
+	id, encoded, sealed := k.split(value)
+	if !sealed {
+		return value, nil
+	}
+
+	master, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("error opening value: key %q is not in the ring", id)
+	}
+
+	envelope, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("error opening value: %w", err)
+	}
+
+	dataKey, envelope, err := open(master, envelope, master.NonceSize()+dataKeySize+master.Overhead(), []byte(id))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("error opening value: %w", err)
+	}
+
+	plain, _, err := open(data, envelope, len(envelope), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// Index is the blind index of the value, equal values get equal indexes which tell nothing without the index key
+func (k *KeyRing) Index(value string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Stale tells values that are not sealed with the active key, a rotation seals them again
+func (k *KeyRing) Stale(value string) bool {
+	id, _, sealed := k.split(value)
+
+	return !sealed || id != k.active
+}
+
+func (k *KeyRing) split(value string) (id, envelope string, sealed bool) {
+	rest, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, envelope, ok = strings.Cut(rest, ":")
+	if !ok {
+		return "", "", false
+	}
+
+	return id, envelope, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal appends the nonce and the sealed plaintext to dst
+func seal(aead cipher.AEAD, dst, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	dst = append(dst, nonce...)
+
+	return aead.Seal(dst, nonce, plaintext, aad), nil
+}
+
+// open decrypts the first size bytes of envelope, which hold the nonce and the sealed plaintext, and returns the rest
+func open(aead cipher.AEAD, envelope []byte, size int, aad []byte) (plain, rest []byte, err error) {
+	if size < aead.NonceSize() || len(envelope) < size {
+		return nil, nil, errors.New("error opening value: truncated envelope")
+	}
+
+	nonce, sealed := envelope[:aead.NonceSize()], envelope[aead.NonceSize():size]
+
+	plain, err = aead.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening value: %w", err)
+	}
+
+	return plain, envelope[size:], nil
+}
@@ -0,0 +1,159 @@
+package driven
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+)
+
+var (
+	_ domain.EventPublisher = (*MemoryEventStream)(nil)
+	_ domain.EventStream    = (*MemoryEventStream)(nil)
+)
+
+// MemoryEventStream takes the place of the redis stream when redis is not the storage, the outbox relay publishes
+// to it and the subscribers of the same replica read from it. It keeps the newest MemoryLen events until the replica stops.
+// Its ids look like those of redis, the start of the replica followed by a sequence, so ids from before a restart
+// replay every event that is kept.
+type MemoryEventStream struct {
+	epoch  uint64
+	maxLen int
+
+	mu     sync.Mutex
+	events []domain.StreamEvent
+	// seq is the sequence of the newest event
+	seq uint64
+	// added is closed and replaced whenever an event is published
+	added chan struct{}
+}
+
+func NewMemoryEventStream(cfg *config.Config) *MemoryEventStream {
+	return &MemoryEventStream{
+		epoch:  uint64(time.Now().UnixMilli()),
+		maxLen: max(cfg.Events.MemoryLen, 1),
+		added:  make(chan struct{}),
+	}
+}
+
+func (s *MemoryEventStream) Publish(_ context.Context, event domain.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	s.events = append(s.events, domain.StreamEvent{
+		StreamID: fmt.Sprintf("%d-%d", s.epoch, s.seq),
+		Event:    event,
+	})
+
+	if len(s.events) > s.maxLen {
+		s.events = s.events[len(s.events)-s.maxLen:]
+	}
+
+	close(s.added)
+	s.added = make(chan struct{})
+
+	return nil
+}
+
+func (s *MemoryEventStream) RangeEvents(_ context.Context, afterID string, count int) ([]domain.StreamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.after(afterID, count)
+}
+
+func (s *MemoryEventStream) LastEventID(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.events) == 0 {
+		return "0-0", nil
+	}
+
+	return s.events[len(s.events)-1].StreamID, nil
+}
+
+// ReadEvents waits like XREAD, a zero block waits until an event is published
+func (s *MemoryEventStream) ReadEvents(
+	ctx context.Context,
+	afterID string,
+	count int,
+	block time.Duration,
+) ([]domain.StreamEvent, error) {
+	var timeout <-chan time.Time
+
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	for {
+		s.mu.Lock()
+		events, err := s.after(afterID, count)
+		added := s.added
+		s.mu.Unlock()
+
+		if err != nil || len(events) > 0 {
+			return events, err
+		}
+
+		select {
+		case <-added:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error reading memory stream: %w", ctx.Err())
+		}
+	}
+}
+
+// after returns up to count of the events kept after afterID, the caller holds the lock
+func (s *MemoryEventStream) after(afterID string, count int) ([]domain.StreamEvent, error) {
+	ms, seq, err := parseMemoryStreamID(afterID)
+	if err != nil {
+		return nil, err
+	}
+
+	first := s.seq - uint64(len(s.events)) + 1
+	start := 0
+
+	switch {
+	case ms > s.epoch:
+		start = len(s.events)
+	case ms == s.epoch && seq >= first:
+		start = int(min(seq-first+1, uint64(len(s.events))))
+	}
+
+	end := min(start+count, len(s.events))
+
+	return slices.Clone(s.events[start:end]), nil
+}
+
+func parseMemoryStreamID(id string) (ms, seq uint64, err error) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+
+	ms, err = strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed event id %q", domain.ErrorInvalidInput, id)
+	}
+
+	if !found {
+		return ms, 0, nil
+	}
+
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed event id %q", domain.ErrorInvalidInput, id)
+	}
+
+	return ms, seq, nil
+}
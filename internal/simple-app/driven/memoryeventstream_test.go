@@ -0,0 +1,73 @@
+package driven
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryEventStream(t *testing.T) {
+	ctx := context.Background()
+	stream := NewMemoryEventStream(&config.Config{Events: config.EventsConfig{MemoryLen: 3}})
+
+	publish := func(n int) {
+		for range n {
+			require.NoError(t, stream.Publish(ctx, domain.Event{ID: uuid.NewString(), Type: domain.EventUserCreated}))
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		last, err := stream.LastEventID(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "0-0", last)
+
+		events, err := stream.ReadEvents(ctx, last, 10, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.Empty(t, events)
+	})
+
+	t.Run("keeps the newest events", func(t *testing.T) {
+		publish(5)
+
+		events, err := stream.RangeEvents(ctx, "0-0", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+
+		last, err := stream.LastEventID(ctx)
+		require.NoError(t, err)
+		require.Equal(t, events[2].StreamID, last)
+
+		after, err := stream.RangeEvents(ctx, events[0].StreamID, 1)
+		require.NoError(t, err)
+		require.Equal(t, events[1:2], after)
+
+		after, err = stream.RangeEvents(ctx, last, 10)
+		require.NoError(t, err)
+		require.Empty(t, after)
+	})
+
+	t.Run("wakes up readers", func(t *testing.T) {
+		last, err := stream.LastEventID(ctx)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			publish(1)
+		}()
+
+		events, err := stream.ReadEvents(ctx, last, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+	})
+
+	t.Run("malformed id", func(t *testing.T) {
+		_, err := stream.RangeEvents(ctx, "nope", 10)
+		require.ErrorIs(t, err, domain.ErrorInvalidInput)
+	})
+}
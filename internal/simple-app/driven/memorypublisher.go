@@ -0,0 +1,39 @@
+package driven
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+)
+
+var _ domain.EventPublisher = (*MemoryPublisher)(nil)
+
+// MemoryPublisher keeps published events in memory, it is meant for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event domain.Event) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+
+	return
+}
+
+func (p *MemoryPublisher) Events() []domain.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]domain.Event, len(p.events))
+	copy(events, p.events)
+
+	return events
+}
@@ -0,0 +1,20 @@
+-- names and emails are compared bytewise, like the redis indexes, and folded by the application,
+-- which lowers them the same way whatever the database locale
+CREATE TABLE users (
+    id        uuid PRIMARY KEY,
+    name      text COLLATE "C" NOT NULL,
+    name_fold text COLLATE "C" NOT NULL,
+    email     text,
+    -- the folded email, null when the user has none
+    email_key text COLLATE "C",
+    CONSTRAINT users_email_key UNIQUE (email_key)
+);
+
+CREATE INDEX users_name_idx ON users (name, id);
+CREATE INDEX users_name_fold_idx ON users (name_fold, id);
+
+CREATE TABLE outbox (
+    seq     bigserial PRIMARY KEY,
+    id      text NOT NULL UNIQUE,
+    payload jsonb NOT NULL
+);
@@ -0,0 +1,6 @@
+-- btree entries are limited to about a third of a page, so the indexes hold the start of names only
+DROP INDEX users_name_idx;
+DROP INDEX users_name_fold_idx;
+
+CREATE INDEX users_name_idx ON users (left(name, 256), id);
+CREATE INDEX users_name_fold_idx ON users (left(name_fold, 256), id);
@@ -0,0 +1,4 @@
+-- users expire at expires_at, null for users that do not, the partial index serves the sweeper
+ALTER TABLE users ADD COLUMN expires_at timestamptz;
+
+CREATE INDEX users_expires_at_idx ON users (expires_at) WHERE expires_at IS NOT NULL;
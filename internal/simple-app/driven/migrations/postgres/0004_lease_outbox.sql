@@ -0,0 +1,6 @@
+-- the replica holding the lease until expires_at is the only one relaying the outbox
+CREATE TABLE outbox_lease (
+    name       text PRIMARY KEY,
+    owner      text NOT NULL,
+    expires_at timestamptz NOT NULL
+);
@@ -0,0 +1,112 @@
+package driven
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrationsLock is the advisory lock that keeps replicas starting at once from migrating twice
+const postgresMigrationsLock = 0x73696d706c65
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// MigratePostgres applies the schema migrations that the configured database is missing and returns their versions
+func MigratePostgres(ctx context.Context, cfg *config.Config) (applied []string, err error) {
+	pool, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to postgres: %w", err)
+	}
+
+	defer pool.Close()
+
+	return migratePostgres(ctx, pool)
+}
+
+// migratePostgres applies the embedded migrations in the order of their names, each one in its own transaction
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) (applied []string, err error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to postgres: %w", err)
+	}
+
+	defer conn.Release()
+
+	// the lock belongs to the session, so it is taken and released on the same connection
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationsLock)
+	if err != nil {
+		return nil, fmt.Errorf("error locking postgres migrations: %w", err)
+	}
+
+	defer func() {
+		_, unlockErr := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationsLock)
+		if err == nil && unlockErr != nil {
+			err = fmt.Errorf("error unlocking postgres migrations: %w", unlockErr)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    text PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+
+	done, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error listing postgres migrations: %w", err)
+	}
+
+	slices.Sort(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(path.Base(file), ".sql")
+		if slices.Contains(done, version) {
+			continue
+		}
+
+		script, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return applied, fmt.Errorf("error reading migration %s: %w", version, err)
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, string(script))
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+
+		applied = append(applied, version)
+	}
+
+	return applied, nil
+}
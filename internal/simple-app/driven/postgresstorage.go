@@ -0,0 +1,510 @@
+package driven
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/fx"
+)
+
+const (
+	pgUniqueViolation = "23505"
+	pgEmailConstraint = "users_email_key"
+
+	likeEscaper = `\`
+
+	// pgIndexedName is how many characters of a name the name indexes hold, btree entries are limited to about 2.7kB
+	pgIndexedName = 256
+
+	// pgLive leaves out the users that have expired but are not swept yet
+	pgLive = "(expires_at IS NULL OR expires_at > now())"
+)
+
+var (
+	_ domain.UserStorage = (*PostgresStorage)(nil)
+	_ domain.Outbox      = (*PostgresStorage)(nil)
+	_ domain.UserExpiry  = (*PostgresStorage)(nil)
+	_ domain.Readiness   = (*PostgresStorage)(nil)
+)
+
+var likeReplacer = strings.NewReplacer(likeEscaper, likeEscaper+likeEscaper, "%", likeEscaper+"%", "_", likeEscaper+"_")
+
+type PostgresStorage struct {
+	pool  *pgxpool.Pool
+	ready chan struct{}
+}
+
+func NewPostgresStorage(lc fx.Lifecycle, cfg *config.Config) (*PostgresStorage, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.Postgres.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing postgres url: %w", err)
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating postgres pool: %w", err)
+	}
+
+	p := &PostgresStorage{
+		pool:  pool,
+		ready: make(chan struct{}),
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			err := p.pool.Ping(ctx)
+			if err != nil {
+				return fmt.Errorf("error connecting to postgres: %w", err)
+			}
+
+			if cfg.Postgres.Migrate {
+				_, err = migratePostgres(ctx, p.pool)
+				if err != nil {
+					return err
+				}
+			}
+
+			close(p.ready)
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			p.pool.Close()
+
+			return nil
+		},
+	})
+
+	return p, nil
+}
+
+// Ready is closed once postgres has answered at startup and the migrations are applied
+func (p PostgresStorage) Ready() <-chan struct{} {
+	return p.ready
+}
+
+func (p PostgresStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) (err error) {
+	err = pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		txErr := p.upsert(ctx, tx, user.ID.String(), user.Name, user.Email, user.ExpiresAt)
+		if txErr != nil {
+			return txErr
+		}
+
+		return p.appendOutbox(ctx, tx, events)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrorConflict) {
+			return
+		}
+
+		err = fmt.Errorf("error storing to postgres: %w", err)
+	}
+
+	return
+}
+
+func (p PostgresStorage) Read(ctx context.Context, id string) (user domain.User, err error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return user, fmt.Errorf("%w: malformed id %q", domain.ErrorInvalidInput, id)
+	}
+
+	var (
+		email     *string
+		expiresAt *time.Time
+	)
+
+	err = p.pool.QueryRow(ctx, "SELECT name, email, expires_at FROM users WHERE id = $1 AND "+pgLive, parsed).
+		Scan(&user.Name, &email, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = domain.ErrorNotFound
+		} else {
+			err = fmt.Errorf("error reading from postgres: %w", err)
+		}
+
+		return domain.User{}, err
+	}
+
+	user.ID = parsed
+
+	if email != nil {
+		user.Email = *email
+	}
+
+	if expiresAt != nil {
+		user.ExpiresAt = expiresAt.UTC()
+	}
+
+	return user, nil
+}
+
+func (p PostgresStorage) Delete(ctx context.Context, id string, events ...domain.Event) (err error) {
+	err = pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		txErr := p.delete(ctx, tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		return p.appendOutbox(ctx, tx, events)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return
+		}
+
+		err = fmt.Errorf("error deleting from postgres: %w", err)
+	}
+
+	return
+}
+
+// Batch runs every mutation under its own savepoint, so a failing one is undone without undoing the others
+func (p PostgresStorage) Batch(ctx context.Context, mutations []domain.UserMutation, atomic bool) (results []error, err error) {
+	results = make([]error, len(mutations))
+	failed := false
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error batch in postgres: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for i, mutation := range mutations {
+		err = pgx.BeginFunc(ctx, tx, func(savepoint pgx.Tx) error {
+			return p.apply(ctx, savepoint, mutation)
+		})
+
+		switch {
+		case errors.Is(err, domain.ErrorNotFound), errors.Is(err, domain.ErrorConflict):
+			results[i] = err
+			failed = true
+		case err != nil:
+			return nil, fmt.Errorf("error batch in postgres: %w", err)
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i] == nil {
+				results[i] = domain.ErrorAborted
+			}
+		}
+
+		return results, nil
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error batch in postgres: %w", err)
+	}
+
+	return results, nil
+}
+
+func (p PostgresStorage) apply(ctx context.Context, tx pgx.Tx, mutation domain.UserMutation) error {
+	var err error
+
+	switch mutation.Op {
+	case domain.BatchCreate:
+		err = p.upsert(ctx, tx, mutation.ID, mutation.Name, mutation.Email, mutation.ExpiresAt)
+	case domain.BatchUpdate:
+		err = p.update(ctx, tx, mutation.ID, mutation.Name, mutation.Email, mutation.ExpiresAt)
+	case domain.BatchDelete:
+		err = p.delete(ctx, tx, mutation.ID)
+	default:
+		err = fmt.Errorf("unknown batch operation %q", mutation.Op)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return p.appendOutbox(ctx, tx, []domain.Event{mutation.Event})
+}
+
+func (p PostgresStorage) upsert(ctx context.Context, tx pgx.Tx, id, name, email string, expiresAt time.Time) error {
+	err := p.releaseEmail(ctx, tx, email)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO users (id, name, name_fold, email, email_key, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, name_fold = excluded.name_fold,
+			email = excluded.email, email_key = excluded.email_key, expires_at = excluded.expires_at`,
+		id, name, strings.ToLower(name), nullable(email), nullable(emailClaim(email)), nullableTime(expiresAt))
+
+	return emailConflict(err, email)
+}
+
+func (p PostgresStorage) update(ctx context.Context, tx pgx.Tx, id, name, email string, expiresAt time.Time) error {
+	err := p.releaseEmail(ctx, tx, email)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET name = $2, name_fold = $3, email = $4, email_key = $5, expires_at = $6
+		WHERE id = $1 AND `+pgLive,
+		id, name, strings.ToLower(name), nullable(email), nullable(emailClaim(email)), nullableTime(expiresAt))
+	if err != nil {
+		return emailConflict(err, email)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return domain.ErrorNotFound
+	}
+
+	return nil
+}
+
+// releaseEmail takes the email away from an expired user that is not swept yet, expired users have given it up
+func (p PostgresStorage) releaseEmail(ctx context.Context, tx pgx.Tx, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, "UPDATE users SET email = NULL, email_key = NULL WHERE email_key = $1 AND NOT "+pgLive,
+		emailClaim(email))
+
+	return err
+}
+
+func (p PostgresStorage) delete(ctx context.Context, tx pgx.Tx, id string) error {
+	tag, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1 AND "+pgLive, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return domain.ErrorNotFound
+	}
+
+	return nil
+}
+
+// ExpireUsers deletes the expired users in the order of their expiry, replicas sweeping at the same time skip each other's
+func (p PostgresStorage) ExpireUsers(ctx context.Context, now time.Time, limit int, event domain.ExpiryEvent) (expired int, err error) {
+	err = pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		rows, txErr := tx.Query(ctx, `DELETE FROM users WHERE id IN (
+			SELECT id FROM users WHERE expires_at <= $1 ORDER BY expires_at LIMIT $2 FOR UPDATE SKIP LOCKED
+		) RETURNING id`, now, limit)
+		if txErr != nil {
+			return txErr
+		}
+
+		ids, txErr := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if txErr != nil {
+			return txErr
+		}
+
+		events := make([]domain.Event, 0, len(ids))
+		for _, id := range ids {
+			events = append(events, event(ctx, id.String()))
+		}
+
+		expired = len(ids)
+
+		return p.appendOutbox(ctx, tx, events)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error expiring users in postgres: %w", err)
+	}
+
+	return expired, nil
+}
+
+// appendOutbox queues events in the same transaction as the data change
+func (p PostgresStorage) appendOutbox(ctx context.Context, tx pgx.Tx, events []domain.Event) error {
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding event: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO outbox (id, payload) VALUES ($1, $2)", event.ID, payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LeaseRelay holds the lease as the row of the outbox relay, which is taken over once it has expired
+func (p PostgresStorage) LeaseRelay(ctx context.Context, owner string, lease time.Duration) (held bool, err error) {
+	rows, err := p.pool.Query(ctx, `INSERT INTO outbox_lease (name, owner, expires_at)
+		VALUES ('relay', $1, now() + $2::bigint * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+		WHERE outbox_lease.owner = excluded.owner OR outbox_lease.expires_at < now()
+		RETURNING owner`, owner, lease.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("error leasing outbox relay in postgres: %w", err)
+	}
+
+	owners, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return false, fmt.Errorf("error leasing outbox relay in postgres: %w", err)
+	}
+
+	return len(owners) == 1, nil
+}
+
+func (p PostgresStorage) Pending(ctx context.Context, limit int) (events []domain.Event, err error) {
+	rows, err := p.pool.Query(ctx, "SELECT payload FROM outbox ORDER BY seq LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading outbox from postgres: %w", err)
+	}
+
+	events, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (event domain.Event, err error) {
+		var payload []byte
+
+		err = row.Scan(&payload)
+		if err != nil {
+			return event, err
+		}
+
+		err = json.Unmarshal(payload, &event)
+
+		return event, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding outbox events: %w", err)
+	}
+
+	return
+}
+
+func (p PostgresStorage) Ack(ctx context.Context, ids ...string) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	_, err = p.pool.Exec(ctx, "DELETE FROM outbox WHERE id = ANY($1)", ids)
+	if err != nil {
+		err = fmt.Errorf("error acking outbox events in postgres: %w", err)
+	}
+
+	return
+}
+
+// List pages through the users in the order of their ids, the cursor is the last id of the previous page
+func (p PostgresStorage) List(ctx context.Context, cursor string, limit int) (users []domain.User, next string, err error) {
+	after := uuid.Nil
+
+	if cursor != "" {
+		after, err = uuid.Parse(cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: malformed cursor %q", domain.ErrorInvalidInput, cursor)
+		}
+	}
+
+	// one more user than asked for tells whether there is a next page
+	users, err = p.queryUsers(ctx, "SELECT id, name, email, expires_at FROM users WHERE id > $1 AND "+pgLive+
+		" ORDER BY id LIMIT $2", after, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing postgres: %w", err)
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+		next = users[limit-1].ID.String()
+	}
+
+	return users, next, nil
+}
+
+func (p PostgresStorage) Search(ctx context.Context, query domain.NameQuery, limit int) (users []domain.User, err error) {
+	column, name := "name", query.Name
+	if query.IgnoreCase {
+		column, name = "name_fold", strings.ToLower(name)
+	}
+
+	// the indexes hold the start of the names, which narrows the users down before their whole names are compared
+	indexed := "left(" + column + ", " + strconv.Itoa(pgIndexedName) + ")"
+	start := name
+
+	if runes := []rune(name); len(runes) > pgIndexedName {
+		start = string(runes[:pgIndexedName])
+	}
+
+	condition := indexed + " = $3 AND " + column + " = $1"
+	if query.Prefix {
+		condition = indexed + " LIKE $3 ESCAPE '" + likeEscaper + "' AND " + column + " LIKE $1 ESCAPE '" + likeEscaper + "'"
+		name, start = likeReplacer.Replace(name)+"%", likeReplacer.Replace(start)+"%"
+	}
+
+	users, err = p.queryUsers(ctx, "SELECT id, name, email, expires_at FROM users WHERE "+condition+" AND "+pgLive+
+		" ORDER BY "+column+", id LIMIT $2", name, limit, start)
+	if err != nil {
+		return nil, fmt.Errorf("error searching postgres: %w", err)
+	}
+
+	return users, nil
+}
+
+func (p PostgresStorage) queryUsers(ctx context.Context, sql string, args ...any) ([]domain.User, error) {
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (user domain.User, err error) {
+		var (
+			email     *string
+			expiresAt *time.Time
+		)
+
+		err = row.Scan(&user.ID, &user.Name, &email, &expiresAt)
+		if email != nil {
+			user.Email = *email
+		}
+
+		if expiresAt != nil {
+			user.ExpiresAt = expiresAt.UTC()
+		}
+
+		return user, err
+	})
+}
+
+// emailConflict turns a violation of the unique email into ErrorConflict
+func emailConflict(err error, email string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == pgEmailConstraint {
+		return fmt.Errorf("%w: email %q is taken", domain.ErrorConflict, email)
+	}
+
+	return err
+}
+
+// nullable stores empty strings as null, which unique constraints let any number of rows have
+func nullable(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func nullableTime(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+
+	return &value
+}
@@ -0,0 +1,144 @@
+package driven
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.uber.org/fx/fxtest"
+)
+
+type PostgresStorageTestSuite struct {
+	suite.Suite
+	storage *PostgresStorage
+	cfg     *config.Config
+	name    string
+}
+
+func (s *PostgresStorageTestSuite) SetupSuite() {
+	ctx := context.Background()
+
+	s.name = gofakeit.Username()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_PASSWORD": "postgres",
+		},
+		WaitingFor: wait.ForAll(
+			// the server restarts once after initializing the database
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(3*time.Minute),
+			wait.ForListeningPort("5432/tcp").WithStartupTimeout(3*time.Minute),
+		),
+		Name: "postgres",
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	s.Require().NoError(err)
+
+	postgresPort, err := container.MappedPort(ctx, "5432")
+	s.Require().NoError(err)
+
+	host, err := container.Host(ctx)
+	s.Require().NoError(err)
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	s.cfg = &config.Config{
+		Postgres: config.PostgresConfig{
+			URL:     "postgres://postgres:postgres@" + host + ":" + postgresPort.Port() + "/postgres?sslmode=disable",
+			Migrate: true,
+		},
+	}
+
+	lc := fxtest.NewLifecycle(s.T())
+
+	s.storage, err = NewPostgresStorage(lc, s.cfg)
+	s.Require().NoError(err)
+
+	err = lc.Start(ctx)
+	s.Require().NoError(err)
+}
+
+func (s *PostgresStorageTestSuite) TestContract() {
+	storagetest.Run(s.T(), func(t *testing.T) domain.UserStorage {
+		_, err := s.storage.pool.Exec(context.Background(), "TRUNCATE users, outbox")
+		require.NoError(t, err)
+
+		return s.storage
+	})
+}
+
+func (s *PostgresStorageTestSuite) Test5Outbox() {
+	ctx := context.Background()
+	id := gofakeit.UUID()
+	created := domain.NewEvent(ctx, domain.EventUserCreated, id, s.name)
+	deleted := domain.NewEvent(ctx, domain.EventUserDeleted, id, "")
+
+	s.Require().NoError(s.storage.Store(ctx, domain.User{ID: uuid.MustParse(id), Name: s.name}, created))
+	s.Require().NoError(s.storage.Delete(ctx, id, deleted))
+
+	events, err := s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+	s.Require().Equal(created.ID, events[0].ID)
+	s.Require().Equal(s.name, events[0].Name)
+	s.Require().True(created.OccurredAt.Equal(events[0].OccurredAt))
+	s.Require().Equal(deleted.ID, events[1].ID)
+
+	s.Require().NoError(s.storage.Ack(ctx, created.ID, deleted.ID))
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Empty(events)
+}
+
+func (s *PostgresStorageTestSuite) Test5OutboxLease() {
+	ctx := context.Background()
+	lease := 50 * time.Millisecond
+
+	held, err := s.storage.LeaseRelay(ctx, "first", lease)
+	s.Require().NoError(err)
+	s.Require().True(held)
+
+	held, err = s.storage.LeaseRelay(ctx, "second", lease)
+	s.Require().NoError(err)
+	s.Require().False(held)
+
+	held, err = s.storage.LeaseRelay(ctx, "first", lease)
+	s.Require().NoError(err)
+	s.Require().True(held, "the holder renews its lease")
+
+	// the lease is taken over once the holder stopped renewing it
+	s.Require().Eventually(func() bool {
+		held, err = s.storage.LeaseRelay(ctx, "second", lease)
+
+		return err == nil && held
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *PostgresStorageTestSuite) Test10Migrations() {
+	applied, err := MigratePostgres(context.Background(), s.cfg)
+	s.Require().NoError(err)
+	s.Require().Empty(applied)
+}
+
+func TestPostgresStorage(t *testing.T) {
+	suite.Run(t, new(PostgresStorageTestSuite))
+}
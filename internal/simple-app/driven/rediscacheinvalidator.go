@@ -0,0 +1,128 @@
+package driven
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// invalidationSeparator joins the keys of one invalidation, it cannot be part of an uuid or a tenant
+const invalidationSeparator = ","
+
+var _ CacheInvalidator = (*RedisCacheInvalidator)(nil)
+
+// RedisCacheInvalidator passes invalidations between the replicas over a redis pub/sub channel.
+// Pub/sub delivers at most once, an invalidation missed while reconnecting leaves a user stale until its TTL.
+type RedisCacheInvalidator struct {
+	client  redis.UniversalClient
+	channel string
+
+	mu     sync.RWMutex
+	evicts []func(keys ...string)
+}
+
+func NewRedisCacheInvalidator(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	storage *RedisStorage,
+	log *zap.Logger,
+) *RedisCacheInvalidator {
+	r := &RedisCacheInvalidator{
+		client:  storage.client,
+		channel: storage.sharedID(cfg.Cache.Channel),
+	}
+
+	var (
+		pubsub *redis.PubSub
+		done   = make(chan struct{})
+	)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			pubsub = r.client.Subscribe(ctx, r.channel)
+
+			// the first reply confirms the subscription, so no invalidation is missed once the service starts.
+			// While redis is down the subscription is made when go-redis reconnects, the cache relies on its TTL until then
+			select {
+			case <-storage.Ready():
+				_, err := pubsub.Receive(ctx)
+				if err != nil {
+					log.Warn("error subscribing to cache invalidations, retrying in the background", zap.Error(err))
+				}
+			default:
+				log.Warn("redis is not ready, subscribing to cache invalidations in the background")
+			}
+
+			go func() {
+				defer close(done)
+
+				for message := range pubsub.Channel() {
+					r.dispatch(strings.Split(message.Payload, invalidationSeparator))
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			err := pubsub.Close()
+			if err != nil {
+				return fmt.Errorf("error unsubscribing from cache invalidations: %w", err)
+			}
+
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+
+	return r
+}
+
+func (r *RedisCacheInvalidator) Invalidate(ctx context.Context, keys ...string) error {
+	return publishInvalidation(ctx, r.client, r.channel, keys)
+}
+
+// PublishCacheInvalidation tells the replicas to drop the keys from their caches without subscribing to the channel,
+// for writes that bypass the cache from outside the service
+func PublishCacheInvalidation(ctx context.Context, cfg *config.Config, storage *RedisStorage, keys ...string) error {
+	return publishInvalidation(ctx, storage.client, storage.sharedID(cfg.Cache.Channel), keys)
+}
+
+func publishInvalidation(ctx context.Context, client redis.UniversalClient, channel string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := client.Publish(ctx, channel, strings.Join(keys, invalidationSeparator)).Err()
+	if err != nil {
+		return fmt.Errorf("error publishing cache invalidation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisCacheInvalidator) OnInvalidate(evict func(keys ...string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evicts = append(r.evicts, evict)
+}
+
+func (r *RedisCacheInvalidator) dispatch(keys []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, evict := range r.evicts {
+		evict(keys...)
+	}
+}
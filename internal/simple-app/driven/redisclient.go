@@ -0,0 +1,125 @@
+package driven
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisClient connects to a single node, to the master a sentinel points at, or to a cluster
+func newRedisClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{}
+
+	switch cfg.Mode {
+	case "", config.RedisSingle:
+		opt, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing redis url: %w", err)
+		}
+
+		opts.Addrs = []string{opt.Addr}
+		opts.Username = opt.Username
+		opts.Password = opt.Password
+		opts.DB = opt.DB
+		opts.TLSConfig = opt.TLSConfig
+	case config.RedisSentinel:
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, errors.New("error configuring redis: sentinel mode needs the master name and the sentinel addresses")
+		}
+
+		opts.MasterName = cfg.MasterName
+		opts.Addrs = cfg.Addrs
+	case config.RedisCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, errors.New("error configuring redis: cluster mode needs the node addresses")
+		}
+
+		opts.Addrs = cfg.Addrs
+		opts.IsClusterMode = true
+	default:
+		return nil, fmt.Errorf("error configuring redis: unknown mode %q, expected %s, %s or %s",
+			cfg.Mode, config.RedisSingle, config.RedisSentinel, config.RedisCluster)
+	}
+
+	if cfg.Username != "" {
+		opts.Username = cfg.Username
+	}
+
+	if cfg.Password != "" {
+		opts.Password = cfg.Password
+	}
+
+	opts.PoolSize = cfg.PoolSize
+	opts.MinIdleConns = cfg.MinIdleConns
+	opts.DialTimeout = cfg.DialTimeout
+	opts.ReadTimeout = cfg.ReadTimeout
+	opts.WriteTimeout = cfg.WriteTimeout
+	opts.MaxRetries = cfg.MaxRetries
+	opts.MinRetryBackoff = cfg.MinRetryBackoff
+	opts.MaxRetryBackoff = cfg.MaxRetryBackoff
+
+	tlsConfig, err := newRedisTLSConfig(cfg.TLS, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.TLSConfig = tlsConfig
+
+	return redis.NewUniversalClient(opts), nil
+}
+
+// newRedisTLSConfig adds the configured CA, key pair and server name to base, which a rediss url sets
+func newRedisTLSConfig(cfg config.RedisTLSConfig, base *tls.Config) (*tls.Config, error) {
+	if !cfg.Enabled && cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" && cfg.ServerName == "" {
+		return base, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redis ca file: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("error reading redis ca file: no certificates in %s", cfg.CAFile)
+		}
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading redis client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.ServerName != "" {
+		tlsConfig.ServerName = cfg.ServerName
+	}
+
+	return tlsConfig, nil
+}
+
+// redisKeyPrefix starts every key, in a cluster it is a hash tag that keeps all the keys in one slot,
+// because the transactions watch users, indexes and the outbox together. That slot lives on a single node,
+// so a cluster adds failover but no capacity.
+func redisKeyPrefix(cfg config.RedisConfig) string {
+	if cfg.Mode == config.RedisCluster {
+		return "{" + cfg.Prefix + "}::"
+	}
+
+	return cfg.Prefix + "::"
+}
@@ -0,0 +1,146 @@
+package driven
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ValueMigration is what a batch of the value migration did, Cursor resumes the migration after it
+// and is empty once every key has been scanned
+type ValueMigration struct {
+	Scanned  int
+	Outdated int
+	Upgraded int
+	Cursor   string
+}
+
+// MigrateValues scans a batch of the user keys of the tenant of ctx, starting at cursor, and rewrites the values
+// written in an older version of the encoding, a dry run only counts them. It runs next to the service:
+// values changed while the batch is rewritten are left alone, they have been written in the latest version anyway.
+// SCAN may return a key more than once, a value that is upgraded already is not outdated the second time.
+func (r RedisStorage) MigrateValues(ctx context.Context, cursor string, batchSize int, dryRun bool) (migration ValueMigration, err error) {
+	var scanCursor uint64
+
+	if cursor != "" {
+		scanCursor, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return migration, fmt.Errorf("malformed cursor %q", cursor)
+		}
+	}
+
+	prefix := r.genID(ctx, "")
+
+	scanner, err := r.scanner(ctx)
+	if err != nil {
+		return migration, fmt.Errorf("error scanning redis: %w", err)
+	}
+
+	keys, scanCursor, err := scanner.ScanType(ctx, scanCursor, prefix+"*", int64(batchSize), "string").Result()
+	if err != nil {
+		return migration, fmt.Errorf("error scanning redis: %w", err)
+	}
+
+	if scanCursor != 0 {
+		migration.Cursor = strconv.FormatUint(scanCursor, 10)
+	}
+
+	userKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		// the keys of other tenants and of the indexes share the prefix
+		if _, parseErr := uuid.Parse(strings.TrimPrefix(key, prefix)); parseErr == nil {
+			userKeys = append(userKeys, key)
+		}
+	}
+
+	if len(userKeys) == 0 {
+		return migration, nil
+	}
+
+	values, err := r.client.MGet(ctx, userKeys...).Result()
+	if err != nil {
+		return migration, fmt.Errorf("error reading from redis: %w", err)
+	}
+
+	outdated := make(map[string]string)
+
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			// deleted meanwhile
+			continue
+		}
+
+		migration.Scanned++
+
+		if decodeUser(str).outdated() {
+			outdated[userKeys[i]] = str
+		}
+	}
+
+	migration.Outdated = len(outdated)
+
+	if dryRun || len(outdated) == 0 {
+		return migration, nil
+	}
+
+	migration.Upgraded, err = r.upgradeValues(ctx, outdated)
+	if err != nil {
+		return migration, fmt.Errorf("error upgrading users in redis: %w", err)
+	}
+
+	return migration, nil
+}
+
+// upgradeValues rewrites the values in the latest version of the encoding, as long as they are still what was read.
+// The expiry of the keys is kept, the copies kept for expiring users are only read for their index entries.
+func (r RedisStorage) upgradeValues(ctx context.Context, read map[string]string) (upgraded int, err error) {
+	keys := make([]string, 0, len(read))
+	for key := range read {
+		keys = append(keys, key)
+	}
+
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		upgraded = 0
+
+		current, txErr := tx.MGet(ctx, keys...).Result()
+		if txErr != nil {
+			return txErr
+		}
+
+		values := make(map[string]string, len(keys))
+
+		for i, key := range keys {
+			if value, ok := current[i].(string); ok && value == read[key] {
+				values[key], txErr = encodeUser(decodeUser(value))
+				if txErr != nil {
+					return txErr
+				}
+			}
+		}
+
+		if len(values) == 0 {
+			return nil
+		}
+
+		_, txErr = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for key, value := range values {
+				pipe.SetArgs(ctx, key, value, redis.SetArgs{KeepTTL: true})
+			}
+
+			return nil
+		})
+		if txErr == nil {
+			upgraded = len(values)
+		}
+
+		return txErr
+	}, keys...)
+
+	return upgraded, err
+}
@@ -3,41 +3,149 @@ package driven
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
-var _ domain.UserStorage = (*RedisStorage)(nil)
+const (
+	outboxKey        = "outbox"
+	outboxEventsKey  = "outbox::events"
+	outboxDeadKey    = "outbox::dead"
+	outboxRelayKey   = "outbox::relay"
+	nameIndexKey     = "index::name"
+	nameFoldIndexKey = "index::name::fold"
+	emailIndexKey    = "index::email"
+	indexKeyPrefix   = "index::"
+	tenantsKey       = "tenants"
+	expiringKey      = "expiring"
+	expiringUsersKey = "expiring::users"
+
+	nameSeparator     = "\x00"
+	nameSeparatorNext = "\x01"
+
+	maxTxRetries = 10
+
+	purgeBatchSize = 500
+
+	startupBackoffBase = 100 * time.Millisecond
+	startupBackoffMax  = 5 * time.Second
+)
+
+// leaseScript renews the lease of the owner or takes it when nobody holds it
+var leaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+var (
+	_ domain.UserStorage   = (*RedisStorage)(nil)
+	_ domain.Outbox        = (*RedisStorage)(nil)
+	_ domain.Readiness     = (*RedisStorage)(nil)
+	_ domain.TenantStorage = (*RedisStorage)(nil)
+	_ domain.UserExpiry    = (*RedisStorage)(nil)
+)
 
 type RedisStorage struct {
-	client *redis.Client
-	prefix string
+	client        redis.UniversalClient
+	prefix        string
+	tenants       config.TenantConfig
+	upgradeOnRead bool
+	log           *zap.Logger
+	ready         chan struct{}
 }
 
-func NewRedisStorage(lc fx.Lifecycle, cfg *config.Config) (*RedisStorage, error) {
-	opt, err := redis.ParseURL(cfg.Redis.URL)
+func NewRedisStorage(lc fx.Lifecycle, cfg *config.Config, log *zap.Logger) (*RedisStorage, error) {
+	client, err := newRedisClient(cfg.Redis)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing redis url: %w", err)
+		return nil, err
 	}
 
 	r := &RedisStorage{
-		client: redis.NewClient(opt),
-		prefix: cfg.Redis.Prefix,
+		client:        client,
+		prefix:        redisKeyPrefix(cfg.Redis),
+		tenants:       cfg.Tenant,
+		upgradeOnRead: cfg.Redis.UpgradeOnRead,
+		log:           log,
+		ready:         make(chan struct{}),
 	}
 
+	check, err := r.startupCheck(cfg.Redis.StartupCheck)
+	if err != nil {
+		_ = client.Close()
+
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	checked := make(chan struct{})
+
 	lc.Append(fx.Hook{
-		OnStart: func(ctx context.Context) error {
-			err := r.client.Set(ctx, r.genID("ping"), "pong", 1*time.Millisecond).Err()
-			if err != nil {
+		OnStart: func(startCtx context.Context) error {
+			timeout := cfg.Redis.StartupTimeout
+
+			checkCtx, cancelCheck := startCtx, context.CancelFunc(func() {})
+			if timeout > 0 {
+				checkCtx, cancelCheck = context.WithTimeout(startCtx, timeout)
+			}
+
+			err := r.await(checkCtx, check, timeout > 0)
+
+			cancelCheck()
+
+			if err == nil {
+				close(checked)
+
+				return nil
+			}
+
+			if !cfg.Redis.StartupDegraded {
 				return fmt.Errorf("error connecting to redis: %w", err)
 			}
+
+			log.Warn("redis is not reachable, starting degraded until it answers", zap.Error(err))
+
+			go func() {
+				defer close(checked)
+
+				if r.await(ctx, check, true) == nil {
+					log.Info("redis is reachable, the service is ready")
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			select {
+			case <-checked:
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+
+			err := r.client.Close()
+			if err != nil {
+				return fmt.Errorf("error closing redis client: %w", err)
+			}
+
 			return nil
 		},
 	})
@@ -45,19 +153,119 @@ func NewRedisStorage(lc fx.Lifecycle, cfg *config.Config) (*RedisStorage, error)
 	return r, nil
 }
 
-func (r RedisStorage) Store(ctx context.Context, id, name string) (err error) {
-	err = r.client.Set(ctx, r.genID(id), name, 0).Err()
+// Ready is closed once the startup check has passed
+func (r RedisStorage) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// startupCheck pings redis, or only reads a key for users who may not write
+func (r RedisStorage) startupCheck(mode string) (func(ctx context.Context) error, error) {
+	switch mode {
+	case "", config.RedisCheckPing:
+		return func(ctx context.Context) error {
+			return r.client.Ping(ctx).Err()
+		}, nil
+	case config.RedisCheckRead:
+		return func(ctx context.Context) error {
+			return r.client.Exists(ctx, r.sharedID(outboxKey)).Err()
+		}, nil
+	}
+
+	return nil, fmt.Errorf("error configuring redis: unknown startup check %q, expected %s or %s",
+		mode, config.RedisCheckPing, config.RedisCheckRead)
+}
+
+// await runs the check until it passes, with jittered backoff when retry is set, and marks the storage ready
+func (r RedisStorage) await(ctx context.Context, check func(ctx context.Context) error, retry bool) error {
+	for attempt := 1; ; attempt++ {
+		err := check(ctx)
+		if err == nil {
+			close(r.ready)
+
+			return nil
+		}
+
+		if !retry {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(domain.Backoff(startupBackoffBase, startupBackoffMax, attempt)):
+		}
+	}
+}
+
+func (r RedisStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) (err error) {
+	id := user.ID.String()
+	key := r.genID(ctx, id)
+	keys := []string{key}
+
+	if user.Email != "" {
+		keys = append(keys, r.emailKey(ctx, user.Email))
+	}
+
+	quota := r.quota(ctx)
+	if quota > 0 {
+		// the name index holds every user of the tenant, watching it keeps concurrent creates within the quota
+		keys = append(keys, r.genID(ctx, nameIndexKey))
+	}
+
+	record := newUserRecord(user.Name, user.Email, user.ExpiresAt)
+
+	value, err := encodeUser(record)
+	if err != nil {
+		return err
+	}
+
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		previous, txErr := r.readUser(ctx, tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		if !previous.exists {
+			txErr = r.checkQuota(ctx, tx, quota)
+			if txErr != nil {
+				return txErr
+			}
+		}
+
+		txErr = r.checkEmail(ctx, tx, id, user.Email)
+		if txErr != nil {
+			return txErr
+		}
+
+		_, txErr = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.release(ctx, pipe, id, previous)
+			r.put(ctx, pipe, id, value, record)
+
+			return r.appendOutbox(ctx, pipe, events)
+		})
+
+		return txErr
+	}, keys...)
 	if err != nil {
+		if errors.Is(err, domain.ErrorConflict) {
+			return
+		}
+
 		err = fmt.Errorf("error storing to redis: %w", err)
 	}
 
 	return
 }
 
-func (r RedisStorage) Read(ctx context.Context, id string) (name string, err error) {
-	id = r.genID(id)
+func (r RedisStorage) Read(ctx context.Context, id string) (user domain.User, err error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return user, fmt.Errorf("%w: malformed id %q", domain.ErrorInvalidInput, id)
+	}
 
-	name, err = r.client.Get(ctx, id).Result()
+	key := r.genID(ctx, id)
+
+	value, err := r.client.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = domain.ErrorNotFound
@@ -70,15 +278,48 @@ func (r RedisStorage) Read(ctx context.Context, id string) (name string, err err
 		return
 	}
 
-	return
+	record := decodeUser(value)
+	// redis expires the key by its own clock, which may lag behind
+	if record.expired(time.Now()) {
+		return user, domain.ErrorNotFound
+	}
+
+	if record.outdated() && r.upgradeOnRead {
+		// the user is read either way, a failed upgrade is left to the next read or to the migration
+		_, upgradeErr := r.upgradeValues(ctx, map[string]string{key: value})
+		if upgradeErr != nil {
+			r.log.Warn("error upgrading user", zap.String("id", id), zap.Error(upgradeErr))
+		}
+	}
+
+	return record.user(parsed), nil
 }
 
-func (r RedisStorage) Delete(ctx context.Context, id string) (err error) {
-	err = r.client.Del(ctx, r.genID(id)).Err()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			err = domain.ErrorNotFound
+func (r RedisStorage) Delete(ctx context.Context, id string, events ...domain.Event) (err error) {
+	key := r.genID(ctx, id)
+
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		previous, txErr := r.readUser(ctx, tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		if !previous.exists || previous.expired(time.Now()) {
+			return domain.ErrorNotFound
+		}
 
+		_, txErr = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			r.release(ctx, pipe, id, previous)
+			r.track(ctx, pipe, id, "", userRecord{})
+
+			return r.appendOutbox(ctx, pipe, events)
+		})
+
+		return txErr
+	}, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
 			return
 		}
 
@@ -90,6 +331,863 @@ func (r RedisStorage) Delete(ctx context.Context, id string) (err error) {
 	return
 }
 
-func (r RedisStorage) genID(id string) string {
-	return r.prefix + "::" + id
+func (r RedisStorage) Batch(ctx context.Context, mutations []domain.UserMutation, atomic bool) (results []error, err error) {
+	keys := make([]string, len(mutations))
+	records := make([]userRecord, len(mutations))
+	values := make([]string, len(mutations))
+	watched := make([]string, 0, 2*len(mutations))
+
+	for i, mutation := range mutations {
+		keys[i] = r.genID(ctx, mutation.ID)
+		watched = append(watched, keys[i])
+
+		if mutation.Email != "" {
+			watched = append(watched, r.emailKey(ctx, mutation.Email))
+		}
+
+		records[i] = newUserRecord(mutation.Name, mutation.Email, mutation.ExpiresAt)
+
+		values[i], err = encodeUser(records[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.quota(ctx) > 0 {
+		watched = append(watched, r.genID(ctx, nameIndexKey))
+	}
+
+	err = r.watch(ctx, func(tx *redis.Tx) (txErr error) {
+		var previous []storedUser
+
+		results, previous, txErr = r.checkMutations(ctx, tx, mutations, keys, records, atomic)
+		if txErr != nil {
+			return txErr
+		}
+
+		_, txErr = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, mutation := range mutations {
+				if results[i] != nil {
+					continue
+				}
+
+				r.release(ctx, pipe, mutation.ID, previous[i])
+
+				if mutation.Op == domain.BatchDelete {
+					pipe.Del(ctx, keys[i])
+					r.track(ctx, pipe, mutation.ID, "", userRecord{})
+				} else {
+					r.put(ctx, pipe, mutation.ID, values[i], records[i])
+				}
+
+				pipeErr := r.appendOutbox(ctx, pipe, []domain.Event{mutation.Event})
+				if pipeErr != nil {
+					return pipeErr
+				}
+			}
+
+			return nil
+		})
+
+		return txErr
+	}, watched...)
+	if err != nil {
+		return nil, fmt.Errorf("error batch in redis: %w", err)
+	}
+
+	return results, nil
+}
+
+// storedUser is the user a write replaces. When redis has expired its key before it was swept,
+// lapsed is set and the record is the copy the expiry bookkeeping kept, so its index entries can be dropped.
+type storedUser struct {
+	userRecord
+	exists bool
+	lapsed bool
+}
+
+// checkMutations reports which mutations can be applied and the user each of them replaces,
+// taking the effect of the earlier ones in the batch into account
+func (r RedisStorage) checkMutations(
+	ctx context.Context,
+	tx *redis.Tx,
+	mutations []domain.UserMutation,
+	keys []string,
+	records []userRecord,
+	atomic bool,
+) (results []error, previous []storedUser, err error) {
+	userCmds := make(map[string]*redis.StringCmd, len(mutations))
+	lapsedCmds := make(map[string]*redis.StringCmd, len(mutations))
+	// owners of the emails the mutations claim, empty when an email is free
+	ownerCmds := make(map[string]*redis.StringCmd, len(mutations))
+	quota := int64(r.quota(ctx))
+
+	var countCmd *redis.IntCmd
+
+	_, err = tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if quota > 0 {
+			countCmd = pipe.ZCard(ctx, r.genID(ctx, nameIndexKey))
+		}
+
+		for i, mutation := range mutations {
+			if _, ok := userCmds[keys[i]]; !ok {
+				userCmds[keys[i]] = pipe.Get(ctx, keys[i])
+				lapsedCmds[keys[i]] = pipe.HGet(ctx, r.sharedID(expiringUsersKey), r.expiringMember(ctx, mutation.ID))
+			}
+
+			if mutation.Email == "" {
+				continue
+			}
+
+			if _, ok := ownerCmds[r.emailKey(ctx, mutation.Email)]; !ok {
+				ownerCmds[r.emailKey(ctx, mutation.Email)] = pipe.Get(ctx, r.emailKey(ctx, mutation.Email))
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, nil, err
+	}
+
+	users := make(map[string]storedUser, len(userCmds))
+	for key, cmd := range userCmds {
+		users[key], err = storedUserOf(cmd, lapsedCmds[key])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	now := time.Now()
+
+	owners := make(map[string]string, len(ownerCmds))
+	for key, cmd := range ownerCmds {
+		owner, cmdErr := cmd.Result()
+		if cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+			return nil, nil, cmdErr
+		}
+
+		owners[key] = owner
+	}
+
+	var count int64
+
+	if countCmd != nil {
+		count, err = countCmd.Result()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	results = make([]error, len(mutations))
+	previous = make([]storedUser, len(mutations))
+	failed := false
+
+	for i, mutation := range mutations {
+		user := users[keys[i]]
+
+		switch {
+		case mutation.Op != domain.BatchCreate && (!user.exists || user.expired(now)):
+			results[i] = domain.ErrorNotFound
+		case mutation.Email != "" && owners[r.emailKey(ctx, mutation.Email)] != "" &&
+			owners[r.emailKey(ctx, mutation.Email)] != mutation.ID:
+			results[i] = domain.ErrorConflict
+		case quota > 0 && mutation.Op != domain.BatchDelete && !user.exists && count >= quota:
+			results[i] = domain.ErrorQuotaExceeded
+		}
+
+		if results[i] != nil {
+			failed = true
+
+			continue
+		}
+
+		previous[i] = user
+
+		if user.Email != "" {
+			owners[r.emailKey(ctx, user.Email)] = ""
+		}
+
+		if mutation.Op == domain.BatchDelete {
+			users[keys[i]] = storedUser{}
+			count--
+
+			continue
+		}
+
+		if !user.exists {
+			count++
+		}
+
+		users[keys[i]] = storedUser{userRecord: records[i], exists: true}
+
+		if mutation.Email != "" {
+			owners[r.emailKey(ctx, mutation.Email)] = mutation.ID
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i] == nil {
+				results[i] = domain.ErrorAborted
+			}
+		}
+	}
+
+	return results, previous, nil
+}
+
+func (r RedisStorage) readUser(ctx context.Context, tx *redis.Tx, id string) (user storedUser, err error) {
+	var userCmd, lapsedCmd *redis.StringCmd
+
+	_, err = tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		userCmd = pipe.Get(ctx, r.genID(ctx, id))
+		lapsedCmd = pipe.HGet(ctx, r.sharedID(expiringUsersKey), r.expiringMember(ctx, id))
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return user, err
+	}
+
+	return storedUserOf(userCmd, lapsedCmd)
+}
+
+// storedUserOf reads the user from its key, or from the expiry bookkeeping once redis has expired the key
+func storedUserOf(userCmd, lapsedCmd *redis.StringCmd) (storedUser, error) {
+	value, err := userCmd.Result()
+	if err == nil {
+		return storedUser{userRecord: decodeUser(value), exists: true}, nil
+	}
+
+	if !errors.Is(err, redis.Nil) {
+		return storedUser{}, err
+	}
+
+	value, err = lapsedCmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return storedUser{}, nil
+	}
+
+	if err != nil {
+		return storedUser{}, err
+	}
+
+	return storedUser{userRecord: decodeUser(value), lapsed: true}, nil
+}
+
+// checkEmail fails with ErrorConflict when another user holds the email, the claim key has to be watched
+func (r RedisStorage) checkEmail(ctx context.Context, tx *redis.Tx, id, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	owner, err := tx.Get(ctx, r.emailKey(ctx, email)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if owner != id {
+		return fmt.Errorf("%w: email %q is taken", domain.ErrorConflict, email)
+	}
+
+	return nil
+}
+
+// checkQuota fails with ErrorQuotaExceeded when the tenant has no room for another user, the name index has to be watched
+func (r RedisStorage) checkQuota(ctx context.Context, tx *redis.Tx, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+
+	count, err := tx.ZCard(ctx, r.genID(ctx, nameIndexKey)).Result()
+	if err != nil {
+		return err
+	}
+
+	if count >= int64(quota) {
+		return fmt.Errorf("%w: tenant %q is limited to %d users", domain.ErrorQuotaExceeded, domain.TenantFromContext(ctx), quota)
+	}
+
+	return nil
+}
+
+// quota is the cap on the users of the tenant of ctx, zero when there is none
+func (r RedisStorage) quota(ctx context.Context) int {
+	tenant := domain.TenantFromContext(ctx)
+	if tenant == "" {
+		return 0
+	}
+
+	return r.tenants.Quota(tenant)
+}
+
+// put writes the user, redis expires the user and its email claim together at the expiry of the record
+func (r RedisStorage) put(ctx context.Context, pipe redis.Pipeliner, id, value string, record userRecord) {
+	key := r.genID(ctx, id)
+
+	pipe.Set(ctx, key, value, 0)
+	r.claim(ctx, pipe, id, record.Name, record.Email)
+
+	if record.ExpiresAt != 0 {
+		expiresAt := record.expiresAt()
+
+		pipe.PExpireAt(ctx, key, expiresAt)
+
+		if record.Email != "" {
+			pipe.PExpireAt(ctx, r.emailKey(ctx, record.Email), expiresAt)
+		}
+	}
+
+	r.track(ctx, pipe, id, value, record)
+}
+
+// claim indexes the name, takes the email and registers the tenant,
+// checkEmail has made sure under watch that SETNX succeeds
+func (r RedisStorage) claim(ctx context.Context, pipe redis.Pipeliner, id, name, email string) {
+	r.indexName(ctx, pipe, id, name)
+
+	if tenant := domain.TenantFromContext(ctx); tenant != "" {
+		pipe.SAdd(ctx, r.sharedID(tenantsKey), tenant)
+	}
+
+	if email != "" {
+		pipe.SetNX(ctx, r.emailKey(ctx, email), id, 0)
+	}
+}
+
+// release drops the index entries and the email claim of the user that is replaced or deleted,
+// the claim of a lapsed user has expired with it and may belong to someone else by now
+func (r RedisStorage) release(ctx context.Context, pipe redis.Pipeliner, id string, previous storedUser) {
+	if !previous.exists && !previous.lapsed {
+		return
+	}
+
+	r.unindexName(ctx, pipe, id, previous.Name)
+
+	if previous.Email != "" && previous.exists {
+		pipe.Del(ctx, r.emailKey(ctx, previous.Email))
+	}
+}
+
+// track keeps the expiring users in a sorted set by their expiry, together with a copy of their value,
+// which tells the sweeper the index entries to drop once redis has expired the user
+func (r RedisStorage) track(ctx context.Context, pipe redis.Pipeliner, id, value string, record userRecord) {
+	member := r.expiringMember(ctx, id)
+
+	if record.ExpiresAt == 0 {
+		pipe.ZRem(ctx, r.sharedID(expiringKey), member)
+		pipe.HDel(ctx, r.sharedID(expiringUsersKey), member)
+
+		return
+	}
+
+	pipe.ZAdd(ctx, r.sharedID(expiringKey), redis.Z{Score: float64(record.ExpiresAt), Member: member})
+	pipe.HSet(ctx, r.sharedID(expiringUsersKey), member, value)
+}
+
+// expiringMember names the user across the tenants, as tenant/id
+func (r RedisStorage) expiringMember(ctx context.Context, id string) string {
+	if tenant := domain.TenantFromContext(ctx); tenant != "" {
+		return tenant + "/" + id
+	}
+
+	return id
+}
+
+// ExpireUsers drops the users that redis has expired, or is about to, from the indexes and queues their events.
+// Replicas may sweep at the same time, every user is swept in a transaction of its own and only once.
+func (r RedisStorage) ExpireUsers(ctx context.Context, now time.Time, limit int, event domain.ExpiryEvent) (int, error) {
+	members, err := r.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     r.sharedID(expiringKey),
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(now.UnixMilli(), 10),
+		ByScore: true,
+		Count:   int64(limit),
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error reading expiring users from redis: %w", err)
+	}
+
+	expired := 0
+
+	for _, member := range members {
+		userCtx, id := ctx, member
+		if i := strings.LastIndex(member, "/"); i >= 0 {
+			userCtx, id = domain.WithTenant(ctx, member[:i]), member[i+1:]
+		}
+
+		swept, err := r.expireUser(userCtx, id, now, event)
+		if err != nil {
+			return expired, fmt.Errorf("error expiring user %s in redis: %w", member, err)
+		}
+
+		if swept {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+func (r RedisStorage) expireUser(ctx context.Context, id string, now time.Time, event domain.ExpiryEvent) (swept bool, err error) {
+	key := r.genID(ctx, id)
+
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		swept = false
+
+		user, txErr := r.readUser(ctx, tx, id)
+		if txErr != nil {
+			return txErr
+		}
+
+		// a user stored again meanwhile has moved on, one that is gone has been swept already
+		if !user.expired(now) || (!user.exists && !user.lapsed) {
+			return nil
+		}
+
+		_, txErr = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			r.release(ctx, pipe, id, user)
+			r.track(ctx, pipe, id, "", userRecord{})
+
+			return r.appendOutbox(ctx, pipe, []domain.Event{event(ctx, id)})
+		})
+
+		swept = txErr == nil
+
+		return txErr
+	}, key)
+
+	return swept, err
+}
+
+// LeaseRelay holds the lease as a key with the owner, which expires unless it is renewed
+func (r RedisStorage) LeaseRelay(ctx context.Context, owner string, lease time.Duration) (held bool, err error) {
+	held, err = leaseScript.Run(ctx, r.client, []string{r.sharedID(outboxRelayKey)}, owner, lease.Milliseconds()).Bool()
+	if err != nil {
+		return false, fmt.Errorf("error leasing outbox relay in redis: %w", err)
+	}
+
+	return held, nil
+}
+
+func (r RedisStorage) Pending(ctx context.Context, limit int) (events []domain.Event, err error) {
+	ids, err := r.client.LRange(ctx, r.sharedID(outboxKey), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading outbox from redis: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	payloads, err := r.client.HMGet(ctx, r.sharedID(outboxEventsKey), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading outbox events from redis: %w", err)
+	}
+
+	events = make([]domain.Event, 0, len(payloads))
+	poisoned := make(map[string]string)
+
+	for i, payload := range payloads {
+		data, ok := payload.(string)
+		if !ok {
+			r.log.Error("outbox event has no payload, dropping it", zap.String("id", ids[i]))
+			poisoned[ids[i]] = ""
+
+			continue
+		}
+
+		var event domain.Event
+
+		err = json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			r.log.Error("error decoding outbox event, dead-lettering it", zap.String("id", ids[i]), zap.Error(err))
+			poisoned[ids[i]] = data
+
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	err = r.dropPoisoned(ctx, poisoned)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// dropPoisoned takes the events that can never be relayed off the outbox, so they do not block the events behind them.
+// Their payloads are kept in the dead letters of the outbox, to be looked at by hand.
+func (r RedisStorage) dropPoisoned(ctx context.Context, poisoned map[string]string) error {
+	if len(poisoned) == 0 {
+		return nil
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for id, payload := range poisoned {
+			pipe.LRem(ctx, r.sharedID(outboxKey), 1, id)
+			pipe.HDel(ctx, r.sharedID(outboxEventsKey), id)
+
+			if payload != "" {
+				pipe.HSet(ctx, r.sharedID(outboxDeadKey), id, payload)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error dropping outbox events from redis: %w", err)
+	}
+
+	return nil
+}
+
+func (r RedisStorage) Ack(ctx context.Context, ids ...string) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.LRem(ctx, r.sharedID(outboxKey), 1, id)
+		}
+
+		pipe.HDel(ctx, r.sharedID(outboxEventsKey), ids...)
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error acking outbox events in redis: %w", err)
+	}
+
+	return
+}
+
+// appendOutbox queues events in the same transaction as the data change
+func (r RedisStorage) appendOutbox(ctx context.Context, pipe redis.Pipeliner, events []domain.Event) error {
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding event: %w", err)
+		}
+
+		pipe.HSet(ctx, r.sharedID(outboxEventsKey), event.ID, payload)
+		pipe.RPush(ctx, r.sharedID(outboxKey), event.ID)
+	}
+
+	return nil
+}
+
+func (r RedisStorage) List(ctx context.Context, cursor string, limit int) (users []domain.User, next string, err error) {
+	var scanCursor uint64
+
+	if cursor != "" {
+		scanCursor, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: malformed cursor %q", domain.ErrorInvalidInput, cursor)
+		}
+	}
+
+	prefix := r.genID(ctx, "")
+
+	scanner, err := r.scanner(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("error scanning redis: %w", err)
+	}
+
+	// SCAN only promises about count keys per call, so a page may hold a few more users than limit
+	for {
+		var keys []string
+
+		keys, scanCursor, err = scanner.ScanType(ctx, scanCursor, prefix+"*", int64(limit), "string").Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("error scanning redis: %w", err)
+		}
+
+		users, err = r.appendUsers(ctx, users, prefix, keys)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if scanCursor == 0 {
+			return users, "", nil
+		}
+
+		if len(users) >= limit {
+			return users, strconv.FormatUint(scanCursor, 10), nil
+		}
+	}
+}
+
+// appendUsers reads the users behind keys, skipping keys that are not user ids or were deleted meanwhile
+func (r RedisStorage) appendUsers(ctx context.Context, users []domain.User, prefix string, keys []string) ([]domain.User, error) {
+	ids := make([]uuid.UUID, 0, len(keys))
+	userKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		id, err := uuid.Parse(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+		userKeys = append(userKeys, key)
+	}
+
+	if len(userKeys) == 0 {
+		return users, nil
+	}
+
+	values, err := r.client.MGet(ctx, userKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading users from redis: %w", err)
+	}
+
+	now := time.Now()
+
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			if record := decodeUser(value); !record.expired(now) {
+				users = append(users, record.user(ids[i]))
+			}
+		}
+	}
+
+	return users, nil
+}
+
+func (r RedisStorage) Search(ctx context.Context, query domain.NameQuery, limit int) (users []domain.User, err error) {
+	index, name := nameIndexKey, query.Name
+	if query.IgnoreCase {
+		index, name = nameFoldIndexKey, strings.ToLower(name)
+	}
+
+	// members are name, separator, id, so an exact match is the range of members starting with name and separator
+	start, stop := "["+name+nameSeparator, "("+name+nameSeparatorNext
+	if query.Prefix {
+		// utf-8 never uses 0xff, so it sorts after every name starting with the prefix
+		start, stop = "["+name, "("+name+"\xff"
+	}
+
+	members, err := r.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:    r.genID(ctx, index),
+		Start:  start,
+		Stop:   stop,
+		ByLex:  true,
+		Offset: 0,
+		Count:  int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error searching redis: %w", err)
+	}
+
+	keys := make([]string, 0, len(members))
+	prefix := r.genID(ctx, "")
+
+	for _, member := range members {
+		keys = append(keys, prefix+member[strings.LastIndex(member, nameSeparator)+1:])
+	}
+
+	return r.appendUsers(ctx, make([]domain.User, 0, len(keys)), prefix, keys)
+}
+
+func (r RedisStorage) Tenants(ctx context.Context) ([]domain.TenantInfo, error) {
+	names, err := r.client.SMembers(ctx, r.sharedID(tenantsKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tenants in redis: %w", err)
+	}
+
+	slices.Sort(names)
+
+	counts := make([]*redis.IntCmd, len(names))
+
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range names {
+			counts[i] = pipe.ZCard(ctx, r.genID(domain.WithTenant(ctx, name), nameIndexKey))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting tenant users in redis: %w", err)
+	}
+
+	tenants := make([]domain.TenantInfo, len(names))
+	for i, name := range names {
+		tenants[i] = domain.TenantInfo{Name: name, Users: counts[i].Val(), Quota: r.tenants.Quota(name)}
+	}
+
+	return tenants, nil
+}
+
+// PurgeTenant deletes the users and indexes of the tenant in batches without events, so it is not atomic:
+// users stored while it runs may survive. It leaves the caches alone, CachedTenantStorage drops the tenant from them
+func (r RedisStorage) PurgeTenant(ctx context.Context, tenant string) (int64, error) {
+	tenantCtx := domain.WithTenant(ctx, tenant)
+
+	users, err := r.client.ZCard(ctx, r.genID(tenantCtx, nameIndexKey)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+	}
+
+	removed, err := r.client.SRem(ctx, r.sharedID(tenantsKey), tenant).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+	}
+
+	if removed == 0 {
+		return 0, domain.ErrorNotFound
+	}
+
+	scanner, err := r.scanner(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+	}
+
+	prefix := r.genID(tenantCtx, "")
+
+	var cursor uint64
+
+	for {
+		var keys []string
+
+		keys, cursor, err = scanner.Scan(ctx, cursor, prefix+"*", purgeBatchSize).Result()
+		if err != nil {
+			return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+		}
+
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return !ownedByTenant(strings.TrimPrefix(key, prefix))
+		})
+
+		if len(keys) > 0 {
+			err = r.client.Unlink(ctx, keys...).Err()
+			if err != nil {
+				return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	err = r.untrackTenant(ctx, tenant)
+	if err != nil {
+		return 0, fmt.Errorf("error purging tenant in redis: %w", err)
+	}
+
+	return users, nil
+}
+
+// untrackTenant drops the expiring users of the tenant, so the sweeper does not tell about purged users
+func (r RedisStorage) untrackTenant(ctx context.Context, tenant string) error {
+	var cursor uint64
+
+	for {
+		// tenant names hold no glob characters
+		pairs, next, err := r.client.HScan(ctx, r.sharedID(expiringUsersKey), cursor, tenant+"/*", purgeBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		// HSCAN answers fields and values in turn
+		fields := make([]string, 0, len(pairs)/2)
+		members := make([]any, 0, len(pairs)/2)
+
+		for i := 0; i < len(pairs); i += 2 {
+			fields = append(fields, pairs[i])
+			members = append(members, pairs[i])
+		}
+
+		if len(fields) > 0 {
+			_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HDel(ctx, r.sharedID(expiringUsersKey), fields...)
+				pipe.ZRem(ctx, r.sharedID(expiringKey), members...)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// ownedByTenant tells the users and indexes of a tenant apart from shared keys that its name happens to prefix,
+// like the outbox events of a tenant called outbox
+func ownedByTenant(key string) bool {
+	if strings.HasPrefix(key, indexKeyPrefix) {
+		return true
+	}
+
+	_, err := uuid.Parse(key)
+
+	return err == nil
+}
+
+// indexName adds the user to the name indexes, in the same transaction as the user itself
+func (r RedisStorage) indexName(ctx context.Context, pipe redis.Pipeliner, id, name string) {
+	pipe.ZAdd(ctx, r.genID(ctx, nameIndexKey), redis.Z{Member: name + nameSeparator + id})
+	pipe.ZAdd(ctx, r.genID(ctx, nameFoldIndexKey), redis.Z{Member: strings.ToLower(name) + nameSeparator + id})
+}
+
+func (r RedisStorage) unindexName(ctx context.Context, pipe redis.Pipeliner, id, name string) {
+	pipe.ZRem(ctx, r.genID(ctx, nameIndexKey), name+nameSeparator+id)
+	pipe.ZRem(ctx, r.genID(ctx, nameFoldIndexKey), strings.ToLower(name)+nameSeparator+id)
+}
+
+// watch runs fn in an optimistic transaction, retrying when one of the keys changed meanwhile
+func (r RedisStorage) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) (err error) {
+	for range maxTxRetries {
+		err = r.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// emailKey is the claim of an email within the tenant, it holds the id of its user
+func (r RedisStorage) emailKey(ctx context.Context, email string) string {
+	return r.genID(ctx, emailIndexKey+"::"+emailClaim(email))
+}
+
+// scanner is the node to scan for users, a cluster keeps them all on the node serving the slot of the prefix
+func (r RedisStorage) scanner(ctx context.Context) (redis.Cmdable, error) {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return r.client, nil
+	}
+
+	return cluster.MasterForKey(ctx, r.sharedID(""))
+}
+
+// genID namespaces the keys of the users and their indexes by the tenant of ctx, as prefix::tenant::id
+func (r RedisStorage) genID(ctx context.Context, id string) string {
+	if tenant := domain.TenantFromContext(ctx); tenant != "" {
+		return r.prefix + tenant + "::" + id
+	}
+
+	return r.prefix + id
+}
+
+// sharedID names the keys all the tenants share, like the outbox
+func (r RedisStorage) sharedID(id string) string {
+	return r.prefix + id
 }
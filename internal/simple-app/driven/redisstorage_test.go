@@ -2,30 +2,38 @@ package driven
 
 import (
 	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/application"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
 
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/phayes/freeport"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
 )
 
 type RedisStorageTestSuite struct {
 	suite.Suite
 	storage *RedisStorage
-	id      string
+	cfg     *config.Config
 	name    string
 }
 
 func (s *RedisStorageTestSuite) SetupSuite() {
 	ctx := context.Background()
 
-	s.id = gofakeit.UUID()
 	s.name = gofakeit.Username()
 
 	req := testcontainers.ContainerRequest{
@@ -56,50 +64,737 @@ func (s *RedisStorageTestSuite) SetupSuite() {
 		host = "localhost"
 	}
 
+	s.cfg = &config.Config{
+		Redis: config.RedisConfig{
+			URL:    "redis://" + host + ":" + port,
+			Prefix: gofakeit.Word(),
+		},
+	}
+
 	lc := fxtest.NewLifecycle(s.T())
 
-	s.storage, err = NewRedisStorage(
-		lc,
-		&config.Config{
-			Redis: config.RedisConfig{
-				URL:    "redis://" + host + ":" + port,
-				Prefix: gofakeit.Word(),
-			},
-		})
+	s.storage, err = NewRedisStorage(lc, s.cfg, zap.NewNop())
 	s.Require().NoError(err)
 
 	err = lc.Start(ctx)
 	s.Require().NoError(err)
 }
 
-func (s *RedisStorageTestSuite) Test1Store() {
-	err := s.storage.Store(context.Background(), s.id, s.name)
-	s.Require().NoError(err)
+func (s *RedisStorageTestSuite) TestContract() {
+	storagetest.Run(s.T(), func(t *testing.T) domain.UserStorage {
+		// a prefix of its own keeps every check to an empty keyspace
+		cfg := *s.cfg
+		cfg.Redis.Prefix = gofakeit.UUID()
+
+		lc := fxtest.NewLifecycle(t)
+
+		storage, err := NewRedisStorage(lc, &cfg, zap.NewNop())
+		require.NoError(t, err)
+
+		lc.RequireStart()
+		t.Cleanup(lc.RequireStop)
+
+		return storage
+	})
 }
 
-func (s *RedisStorageTestSuite) Test2Read() {
-	name, err := s.storage.Read(context.Background(), s.id)
+func (s *RedisStorageTestSuite) Test6Outbox() {
+	ctx := context.Background()
+	id := gofakeit.UUID()
+	created := domain.NewEvent(ctx, domain.EventUserCreated, id, s.name)
+	deleted := domain.NewEvent(ctx, domain.EventUserDeleted, id, "")
+
+	err := s.storage.Store(ctx, domain.User{ID: uuid.MustParse(id), Name: s.name}, created)
+	s.Require().NoError(err)
+
+	err = s.storage.Delete(ctx, id, deleted)
+	s.Require().NoError(err)
+
+	events, err := s.storage.Pending(ctx, 10)
 	s.Require().NoError(err)
-	s.Require().Equal(s.name, name)
+	s.Require().Len(events, 2)
+	s.Require().Equal(created.ID, events[0].ID)
+	s.Require().Equal(domain.EventUserCreated, events[0].Type)
+	s.Require().Equal(s.name, events[0].Name)
+	s.Require().True(created.OccurredAt.Equal(events[0].OccurredAt))
+	s.Require().Equal(deleted.ID, events[1].ID)
+
+	err = s.storage.Ack(ctx, created.ID)
+	s.Require().NoError(err)
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+	s.Require().Equal(deleted.ID, events[0].ID)
+
+	err = s.storage.Ack(ctx, deleted.ID)
+	s.Require().NoError(err)
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Empty(events)
 }
 
-func (s *RedisStorageTestSuite) Test3NotFound() {
+func (s *RedisStorageTestSuite) Test6OutboxPoisoned() {
+	ctx := context.Background()
 	id := gofakeit.UUID()
+	created := domain.NewEvent(ctx, domain.EventUserCreated, id, s.name)
+
+	err := s.storage.client.RPush(ctx, s.storage.sharedID(outboxKey), "orphan", "malformed").Err()
+	s.Require().NoError(err)
+
+	err = s.storage.client.HSet(ctx, s.storage.sharedID(outboxEventsKey), "malformed", "{").Err()
+	s.Require().NoError(err)
+
+	err = s.storage.Store(ctx, domain.User{ID: uuid.MustParse(id), Name: s.name}, created)
+	s.Require().NoError(err)
 
-	_, err := s.storage.Read(context.Background(), id)
-	s.Require().Error(err)
-	s.Require().Equal(domain.ErrorNotFound, err)
+	events, err := s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1, "the events behind the poisoned ones are relayed")
+	s.Require().Equal(created.ID, events[0].ID)
+
+	s.Require().NoError(s.storage.Ack(ctx, created.ID))
+
+	events, err = s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Empty(events)
+
+	dead, err := s.storage.client.HGetAll(ctx, s.storage.sharedID(outboxDeadKey)).Result()
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]string{"malformed": "{"}, dead)
+}
+
+func (s *RedisStorageTestSuite) Test6OutboxRelays() {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Outbox: config.OutboxConfig{
+			Interval:  time.Hour,
+			BatchSize: 5,
+			Lease:     time.Minute,
+		},
+	}
+
+	events := make([]domain.Event, 20)
+	for i := range events {
+		id := gofakeit.UUID()
+		events[i] = domain.NewEvent(ctx, domain.EventUserCreated, id, s.name)
+		s.Require().NoError(s.storage.Store(ctx, domain.User{ID: uuid.MustParse(id), Name: s.name}, events[i]))
+	}
+
+	sink := NewMemoryPublisher()
+	relays := []*application.OutboxRelay{
+		application.NewOutboxRelay(fxtest.NewLifecycle(s.T()), cfg, zap.NewNop(), s.storage, []domain.EventPublisher{sink}),
+		application.NewOutboxRelay(fxtest.NewLifecycle(s.T()), cfg, zap.NewNop(), s.storage, []domain.EventPublisher{sink}),
+	}
+
+	var wg sync.WaitGroup
+
+	for _, relay := range relays {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range len(events) {
+				_, err := relay.Relay(ctx)
+				s.NoError(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// one relay holds the lease, so every event is published once and in order
+	s.Require().Equal(events, sink.Events())
+
+	pending, err := s.storage.Pending(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Empty(pending)
+
+	s.Require().NoError(s.storage.client.Del(ctx, s.storage.sharedID(outboxRelayKey)).Err())
 }
 
-func (s *RedisStorageTestSuite) Test4Delete() {
-	err := s.storage.Delete(context.Background(), s.id)
+func (s *RedisStorageTestSuite) Test6OutboxLease() {
+	ctx := context.Background()
+	lease := 50 * time.Millisecond
+
+	held, err := s.storage.LeaseRelay(ctx, "first", lease)
+	s.Require().NoError(err)
+	s.Require().True(held)
+
+	held, err = s.storage.LeaseRelay(ctx, "second", lease)
+	s.Require().NoError(err)
+	s.Require().False(held)
+
+	held, err = s.storage.LeaseRelay(ctx, "first", lease)
 	s.Require().NoError(err)
+	s.Require().True(held, "the holder renews its lease")
 
-	_, err = s.storage.Read(context.Background(), s.id)
-	s.Require().Error(err)
-	s.Require().Equal(domain.ErrorNotFound, err)
+	// the lease is taken over once the holder stopped renewing it
+	s.Require().Eventually(func() bool {
+		held, err = s.storage.LeaseRelay(ctx, "second", lease)
+
+		return err == nil && held
+	}, time.Second, 10*time.Millisecond)
+
+	s.Require().NoError(s.storage.client.Del(ctx, s.storage.sharedID(outboxRelayKey)).Err())
+}
+
+func (s *RedisStorageTestSuite) Test7StreamPublisher() {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Redis: config.RedisConfig{
+			Stream:       gofakeit.Word(),
+			StreamMaxLen: 10,
+		},
+	}
+	publisher := NewRedisStreamPublisher(cfg, s.storage)
+	event := domain.NewEvent(ctx, domain.EventUserUpdated, gofakeit.UUID(), s.name)
+
+	err := publisher.Publish(ctx, event)
+	s.Require().NoError(err)
+
+	messages, err := s.storage.client.XRange(ctx, s.storage.sharedID(cfg.Redis.Stream), "-", "+").Result()
+	s.Require().NoError(err)
+	s.Require().Len(messages, 1)
+	s.Require().Equal(string(domain.EventUserUpdated), messages[0].Values["type"])
+
+	var envelope EventEnvelope
+
+	err = json.Unmarshal([]byte(messages[0].Values["envelope"].(string)), &envelope)
+	s.Require().NoError(err)
+	s.Require().Equal(eventEnvelopeVersion, envelope.Version)
+	s.Require().Equal(event.ID, envelope.ID)
+	s.Require().Equal(event.UserID, envelope.Data.ID)
+	s.Require().Equal(s.name, envelope.Data.Name)
+}
+
+func (s *RedisStorageTestSuite) Test8WebhookStorage() {
+	ctx := context.Background()
+	storage := NewRedisWebhookStorage(s.storage)
+	webhook := domain.Webhook{
+		ID:        uuid.New(),
+		URL:       gofakeit.URL(),
+		Secret:    gofakeit.Word(),
+		Events:    []domain.EventType{domain.EventUserCreated},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.Run("webhook crud", func() {
+		err := storage.StoreWebhook(ctx, webhook)
+		s.Require().NoError(err)
+
+		stored, err := storage.ReadWebhook(ctx, webhook.ID.String())
+		s.Require().NoError(err)
+		s.Require().Equal(webhook.URL, stored.URL)
+		s.Require().Equal(webhook.Events, stored.Events)
+
+		webhooks, err := storage.ListWebhooks(ctx)
+		s.Require().NoError(err)
+		s.Require().Len(webhooks, 1)
+
+		_, err = storage.ReadWebhook(ctx, gofakeit.UUID())
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+	})
+
+	delivery := domain.WebhookDelivery{
+		ID:        gofakeit.UUID(),
+		WebhookID: webhook.ID.String(),
+		Event:     domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), s.name),
+	}
+
+	s.Run("claim leases due deliveries", func() {
+		now := time.Now()
+
+		err := storage.ScheduleDelivery(ctx, delivery, now)
+		s.Require().NoError(err)
+
+		claimed, err := storage.ClaimDeliveries(ctx, now, time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Len(claimed, 1)
+		s.Require().Equal(delivery.ID, claimed[0].ID)
+
+		claimed, err = storage.ClaimDeliveries(ctx, now, time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Empty(claimed)
+
+		claimed, err = storage.ClaimDeliveries(ctx, now.Add(2*time.Minute), time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Len(claimed, 1)
+	})
+
+	s.Run("retry and dead-letter", func() {
+		now := time.Now()
+		delivery.Attempt = 1
+		delivery.LastError = "timeout"
+
+		err := storage.RecordAttempt(ctx, delivery, domain.DeliveryAttempt{
+			DeliveryID: delivery.ID,
+			Attempt:    1,
+			Status:     domain.DeliveryRetrying,
+			At:         now,
+		}, now.Add(time.Hour))
+		s.Require().NoError(err)
+
+		claimed, err := storage.ClaimDeliveries(ctx, now.Add(10*time.Minute), time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Empty(claimed)
+
+		claimed, err = storage.ClaimDeliveries(ctx, now.Add(2*time.Hour), time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Len(claimed, 1)
+		s.Require().Equal(1, claimed[0].Attempt)
+
+		delivery.Attempt = 2
+		err = storage.RecordAttempt(ctx, delivery, domain.DeliveryAttempt{
+			DeliveryID: delivery.ID,
+			Attempt:    2,
+			Status:     domain.DeliveryDead,
+			At:         now,
+		}, time.Time{})
+		s.Require().NoError(err)
+
+		claimed, err = storage.ClaimDeliveries(ctx, now.Add(24*time.Hour), time.Minute, 10)
+		s.Require().NoError(err)
+		s.Require().Empty(claimed)
+
+		attempts, err := storage.ListDeliveryAttempts(ctx, webhook.ID.String())
+		s.Require().NoError(err)
+		s.Require().Len(attempts, 2)
+		s.Require().Equal(domain.DeliveryDead, attempts[0].Status)
+
+		dead, err := storage.ListDeadLetters(ctx, webhook.ID.String())
+		s.Require().NoError(err)
+		s.Require().Len(dead, 1)
+		s.Require().Equal(delivery.ID, dead[0].ID)
+		s.Require().Equal("timeout", dead[0].LastError)
+	})
+
+	s.Run("delete webhook", func() {
+		err := storage.DeleteWebhook(ctx, webhook.ID.String())
+		s.Require().NoError(err)
+
+		err = storage.DeleteWebhook(ctx, webhook.ID.String())
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+
+		attempts, err := storage.ListDeliveryAttempts(ctx, webhook.ID.String())
+		s.Require().NoError(err)
+		s.Require().Empty(attempts)
+	})
+}
+
+func (s *RedisStorageTestSuite) Test9StreamReader() {
+	ctx := context.Background()
+	cfg := &config.Config{
+		Redis: config.RedisConfig{
+			Stream:       gofakeit.Word() + "-feed",
+			StreamMaxLen: 10,
+		},
+	}
+	publisher := NewRedisStreamPublisher(cfg, s.storage)
+	reader := NewRedisStreamReader(cfg, s.storage)
+	created := domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), s.name)
+	deleted := domain.NewEvent(ctx, domain.EventUserDeleted, created.UserID, "")
+
+	last, err := reader.LastEventID(ctx)
+	s.Require().NoError(err)
+	s.Require().Equal("0-0", last)
+
+	s.Require().NoError(publisher.Publish(ctx, created))
+	s.Require().NoError(publisher.Publish(ctx, deleted))
+
+	events, err := reader.RangeEvents(ctx, "0", 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+
+	last, err = reader.LastEventID(ctx)
+	s.Require().NoError(err)
+	s.Require().Equal(events[1].StreamID, last)
+	s.Require().Equal(created.ID, events[0].Event.ID)
+	s.Require().Equal(created.UserID, events[0].Event.UserID)
+	s.Require().Equal(s.name, events[0].Event.Name)
+	s.Require().Equal(domain.EventUserDeleted, events[1].Event.Type)
+
+	events, err = reader.RangeEvents(ctx, events[0].StreamID, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+	s.Require().Equal(deleted.ID, events[0].Event.ID)
+
+	tail, err := reader.ReadEvents(ctx, events[0].StreamID, 10, 10*time.Millisecond)
+	s.Require().NoError(err)
+	s.Require().Empty(tail)
+
+	tail, err = reader.ReadEvents(ctx, "0", 1, 10*time.Millisecond)
+	s.Require().NoError(err)
+	s.Require().Len(tail, 1)
+	s.Require().Equal(created.ID, tail[0].Event.ID)
+}
+
+func (s *RedisStorageTestSuite) Test10CacheInvalidator() {
+	ctx := context.Background()
+	cfg := *s.cfg
+	cfg.Cache.Channel = gofakeit.UUID()
+
+	lc := fxtest.NewLifecycle(s.T())
+	publisher := NewRedisCacheInvalidator(lc, &cfg, s.storage, zap.NewNop())
+	subscriber := NewRedisCacheInvalidator(lc, &cfg, s.storage, zap.NewNop())
+
+	evicted := make(chan []string, 1)
+	subscriber.OnInvalidate(func(ids ...string) {
+		evicted <- ids
+	})
+
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	ids := []string{gofakeit.UUID(), gofakeit.UUID()}
+	s.Require().NoError(publisher.Invalidate(ctx, ids...))
+
+	select {
+	case got := <-evicted:
+		s.Require().Equal(ids, got)
+	case <-time.After(5 * time.Second):
+		s.Fail("invalidation was not delivered")
+	}
+
+	// writes from outside the service reach the subscribers as well
+	s.Require().NoError(PublishCacheInvalidation(ctx, &cfg, s.storage, TenantInvalidation("")))
+
+	select {
+	case got := <-evicted:
+		s.Require().Equal([]string{TenantInvalidation("")}, got)
+	case <-time.After(5 * time.Second):
+		s.Fail("invalidation was not delivered")
+	}
+}
+
+func (s *RedisStorageTestSuite) Test11StartupCheck() {
+	for _, check := range []string{config.RedisCheckPing, config.RedisCheckRead} {
+		s.Run(check, func() {
+			cfg := *s.cfg
+			cfg.Redis.StartupCheck = check
+			cfg.Redis.StartupTimeout = time.Second
+
+			lc := fxtest.NewLifecycle(s.T())
+
+			storage, err := NewRedisStorage(lc, &cfg, zap.NewNop())
+			s.Require().NoError(err)
+
+			lc.RequireStart()
+			defer lc.RequireStop()
+
+			s.Require().True(isReady(storage))
+		})
+	}
+
+	s.Run("unknown check", func() {
+		cfg := *s.cfg
+		cfg.Redis.StartupCheck = "write"
+
+		_, err := NewRedisStorage(fxtest.NewLifecycle(s.T()), &cfg, zap.NewNop())
+		s.Require().Error(err)
+	})
+}
+
+func (s *RedisStorageTestSuite) Test12Tenants() {
+	cfg := *s.cfg
+	cfg.Redis.Prefix = gofakeit.UUID()
+	cfg.Tenant = config.TenantConfig{MaxUsers: 1, Quotas: map[string]int{"globex": 2}}
+
+	lc := fxtest.NewLifecycle(s.T())
+
+	storage, err := NewRedisStorage(lc, &cfg, zap.NewNop())
+	s.Require().NoError(err)
+
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	ctx := context.Background()
+	acme, globex := domain.WithTenant(ctx, "acme"), domain.WithTenant(ctx, "globex")
+	email := gofakeit.Email()
+	user := domain.User{ID: uuid.New(), Name: s.name, Email: email}
+	id := user.ID.String()
+
+	s.Run("keys are namespaced", func() {
+		s.Require().NoError(storage.Store(acme, user))
+		s.Require().Equal(cfg.Redis.Prefix+"::acme::"+id, storage.genID(acme, id))
+
+		exists, err := storage.client.Exists(ctx, cfg.Redis.Prefix+"::acme::"+id).Result()
+		s.Require().NoError(err)
+		s.Require().EqualValues(1, exists)
+
+		_, err = storage.Read(globex, id)
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+
+		_, err = storage.Read(ctx, id)
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+
+		// emails only have to be unique within a tenant
+		s.Require().NoError(storage.Store(globex, user))
+
+		users, err := storage.Search(acme, domain.NameQuery{Name: s.name}, 10)
+		s.Require().NoError(err)
+		s.Require().Len(users, 1)
+
+		users, _, err = storage.List(ctx, "", 10)
+		s.Require().NoError(err)
+		s.Require().Empty(users)
+	})
+
+	s.Run("quotas", func() {
+		// replacing a user does not count against the quota
+		s.Require().NoError(storage.Store(acme, domain.User{ID: user.ID, Name: gofakeit.Username()}))
+
+		err := storage.Store(acme, domain.User{ID: uuid.New(), Name: gofakeit.Username()})
+		s.Require().ErrorIs(err, domain.ErrorQuotaExceeded)
+
+		results, err := storage.Batch(globex, []domain.UserMutation{
+			{Op: domain.BatchCreate, ID: uuid.NewString(), Name: gofakeit.Username()},
+			{Op: domain.BatchCreate, ID: uuid.NewString(), Name: gofakeit.Username()},
+		}, false)
+		s.Require().NoError(err)
+		s.Require().NoError(results[0])
+		s.Require().ErrorIs(results[1], domain.ErrorQuotaExceeded)
+
+		// a delete in the same batch makes room
+		results, err = storage.Batch(globex, []domain.UserMutation{
+			{Op: domain.BatchDelete, ID: id},
+			{Op: domain.BatchCreate, ID: uuid.NewString(), Name: gofakeit.Username()},
+		}, true)
+		s.Require().NoError(err)
+		s.Require().Equal([]error{nil, nil}, results)
+	})
+
+	s.Run("list and purge", func() {
+		tenants, err := storage.Tenants(ctx)
+		s.Require().NoError(err)
+		s.Require().Equal([]domain.TenantInfo{
+			{Name: "acme", Users: 1, Quota: 1},
+			{Name: "globex", Users: 2, Quota: 2},
+		}, tenants)
+
+		users, err := storage.PurgeTenant(ctx, "acme")
+		s.Require().NoError(err)
+		s.Require().EqualValues(1, users)
+
+		_, err = storage.Read(acme, id)
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+
+		keys, err := storage.client.Keys(ctx, cfg.Redis.Prefix+"::acme::*").Result()
+		s.Require().NoError(err)
+		s.Require().Empty(keys)
+
+		_, err = storage.PurgeTenant(ctx, "acme")
+		s.Require().ErrorIs(err, domain.ErrorNotFound)
+
+		tenants, err = storage.Tenants(ctx)
+		s.Require().NoError(err)
+		s.Require().Len(tenants, 1)
+		s.Require().Equal("globex", tenants[0].Name)
+	})
+
+	s.Run("purge spares shared keys", func() {
+		outbox := domain.WithTenant(ctx, "outbox")
+		event := domain.NewEvent(outbox, domain.EventUserCreated, uuid.NewString(), s.name)
+
+		s.Require().NoError(storage.Store(outbox, domain.User{ID: uuid.MustParse(event.UserID), Name: s.name}, event))
+
+		_, err := storage.PurgeTenant(ctx, "outbox")
+		s.Require().NoError(err)
+
+		events, err := storage.Pending(ctx, 10)
+		s.Require().NoError(err)
+		s.Require().NotEmpty(events)
+		s.Require().Equal(event.ID, events[len(events)-1].ID)
+		s.Require().Equal("outbox", events[len(events)-1].Tenant)
+	})
+}
+
+func (s *RedisStorageTestSuite) Test13ValueVersions() {
+	cfg := *s.cfg
+	cfg.Redis.Prefix = gofakeit.UUID()
+	cfg.Redis.UpgradeOnRead = true
+
+	lc := fxtest.NewLifecycle(s.T())
+
+	storage, err := NewRedisStorage(lc, &cfg, zap.NewNop())
+	s.Require().NoError(err)
+
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	ctx := context.Background()
+	nameOnly := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+	unversioned := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()}
+	latest := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()}
+
+	s.Require().NoError(storage.client.Set(ctx, storage.genID(ctx, nameOnly.ID.String()), nameOnly.Name, 0).Err())
+	s.Require().NoError(storage.client.Set(ctx, storage.genID(ctx, unversioned.ID.String()),
+		`{"name":"`+unversioned.Name+`","email":"`+unversioned.Email+`"}`, time.Hour).Err())
+	s.Require().NoError(storage.Store(ctx, latest))
+
+	version := func(user domain.User) int {
+		value, err := storage.client.Get(ctx, storage.genID(ctx, user.ID.String())).Result()
+		s.Require().NoError(err)
+
+		return decodeUser(value).Version
+	}
+
+	migrate := func(dryRun bool) (total ValueMigration) {
+		cursor := ""
+
+		for {
+			migration, err := storage.MigrateValues(ctx, cursor, 2, dryRun)
+			s.Require().NoError(err)
+
+			total.Scanned += migration.Scanned
+			total.Outdated += migration.Outdated
+			total.Upgraded += migration.Upgraded
+
+			if migration.Cursor == "" {
+				return total
+			}
+
+			cursor = migration.Cursor
+		}
+	}
+
+	s.Run("values record their version", func() {
+		s.Require().Equal(userRecordNameOnly, version(nameOnly))
+		s.Require().Equal(userRecordUnversioned, version(unversioned))
+		s.Require().Equal(userRecordVersion, version(latest))
+	})
+
+	s.Run("dry run only counts", func() {
+		migration := migrate(true)
+		s.Require().GreaterOrEqual(migration.Scanned, 3)
+		s.Require().Equal(2, migration.Outdated)
+		s.Require().Zero(migration.Upgraded)
+		s.Require().Equal(userRecordNameOnly, version(nameOnly))
+	})
+
+	s.Run("reads upgrade", func() {
+		user, err := storage.Read(ctx, nameOnly.ID.String())
+		s.Require().NoError(err)
+		s.Require().Equal(nameOnly, user)
+		s.Require().Equal(userRecordVersion, version(nameOnly))
+	})
+
+	s.Run("migration upgrades the rest and keeps expiry", func() {
+		migration := migrate(false)
+		s.Require().Equal(1, migration.Upgraded)
+		s.Require().Equal(userRecordVersion, version(unversioned))
+
+		ttl, err := storage.client.PTTL(ctx, storage.genID(ctx, unversioned.ID.String())).Result()
+		s.Require().NoError(err)
+		s.Require().Positive(ttl)
+
+		user, err := storage.Read(ctx, unversioned.ID.String())
+		s.Require().NoError(err)
+		s.Require().Equal(unversioned, user)
+
+		s.Require().Zero(migrate(false).Outdated)
+	})
+
+	s.Run("malformed cursor", func() {
+		_, err := storage.MigrateValues(ctx, "not-a-cursor", 2, false)
+		s.Require().Error(err)
+	})
+}
+
+func (s *RedisStorageTestSuite) Test14TenantEvents() {
+	ctx := domain.WithTenant(context.Background(), "acme")
+	cfg := &config.Config{
+		Redis: config.RedisConfig{
+			Stream:       gofakeit.Word() + "-tenants",
+			StreamMaxLen: 10,
+		},
+		Events: config.EventsConfig{
+			Block:     10 * time.Millisecond,
+			BatchSize: 10,
+			Buffer:    2,
+		},
+	}
+
+	lc := fxtest.NewLifecycle(s.T())
+	hub := application.NewEventHub(lc, cfg, zap.NewNop(), NewRedisStreamReader(cfg, s.storage))
+
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	publisher := NewRedisStreamPublisher(cfg, s.storage)
+	other := domain.NewEvent(domain.WithTenant(ctx, "other"), domain.EventUserCreated, gofakeit.UUID(), s.name)
+	event := domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), s.name)
+
+	s.Require().NoError(publisher.Publish(ctx, other))
+	s.Require().NoError(publisher.Publish(ctx, event))
+
+	// replayed from the start of the stream, the event of the other tenant is left out
+	subscription, err := hub.Subscribe(ctx, "0-0")
+	s.Require().NoError(err)
+
+	select {
+	case got := <-subscription:
+		s.Require().Equal(event.ID, got.Event.ID)
+		s.Require().Equal("acme", got.Event.Tenant)
+	case <-time.After(5 * time.Second):
+		s.Fail("tenant event was not delivered")
+	}
 }
 
 func TestRedisStorage(t *testing.T) {
 	suite.Run(t, new(RedisStorageTestSuite))
 }
+
+func TestRedisStorageStartupUnreachable(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Redis: config.RedisConfig{
+			URL:            "redis://127.0.0.1:" + strconv.Itoa(port),
+			Prefix:         gofakeit.Word(),
+			DialTimeout:    50 * time.Millisecond,
+			StartupTimeout: 300 * time.Millisecond,
+		},
+	}
+
+	t.Run("fails startup", func(t *testing.T) {
+		lc := fxtest.NewLifecycle(t)
+
+		_, err := NewRedisStorage(lc, cfg, zap.NewNop())
+		require.NoError(t, err)
+
+		started := time.Now()
+		require.Error(t, lc.Start(context.Background()))
+		// the check is retried until the deadline rather than given up on the first error
+		require.GreaterOrEqual(t, time.Since(started), cfg.Redis.StartupTimeout)
+	})
+
+	t.Run("starts degraded", func(t *testing.T) {
+		degraded := *cfg
+		degraded.Redis.StartupDegraded = true
+
+		lc := fxtest.NewLifecycle(t)
+
+		storage, err := NewRedisStorage(lc, &degraded, zap.NewNop())
+		require.NoError(t, err)
+
+		lc.RequireStart()
+		require.False(t, isReady(storage))
+
+		// stopping ends the background check and closes the client
+		lc.RequireStop()
+		require.False(t, isReady(storage))
+	})
+}
+
+func isReady(readiness domain.Readiness) bool {
+	select {
+	case <-readiness.Ready():
+		return true
+	default:
+		return false
+	}
+}
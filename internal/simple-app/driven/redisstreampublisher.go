@@ -0,0 +1,50 @@
+package driven
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ domain.EventPublisher = (*RedisStreamPublisher)(nil)
+
+type RedisStreamPublisher struct {
+	client redis.UniversalClient
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(cfg *config.Config, storage *RedisStorage) *RedisStreamPublisher {
+	return &RedisStreamPublisher{
+		client: storage.client,
+		stream: storage.sharedID(cfg.Redis.Stream),
+		maxLen: cfg.Redis.StreamMaxLen,
+	}
+}
+
+func (p RedisStreamPublisher) Publish(ctx context.Context, event domain.Event) (err error) {
+	envelope, err := json.Marshal(NewEventEnvelope(event))
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]any{
+			"type":     string(event.Type),
+			"envelope": envelope,
+		},
+	}).Err()
+	if err != nil {
+		err = fmt.Errorf("error adding event to redis stream: %w", err)
+	}
+
+	return
+}
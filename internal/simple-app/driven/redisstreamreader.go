@@ -0,0 +1,102 @@
+package driven
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ domain.EventStream = (*RedisStreamReader)(nil)
+
+// RedisStreamReader reads back the events RedisStreamPublisher adds to the stream
+type RedisStreamReader struct {
+	client redis.UniversalClient
+	stream string
+}
+
+func NewRedisStreamReader(cfg *config.Config, storage *RedisStorage) *RedisStreamReader {
+	return &RedisStreamReader{
+		client: storage.client,
+		stream: storage.sharedID(cfg.Redis.Stream),
+	}
+}
+
+func (r RedisStreamReader) RangeEvents(ctx context.Context, afterID string, count int) ([]domain.StreamEvent, error) {
+	messages, err := r.client.XRangeN(ctx, r.stream, "("+afterID, "+", int64(count)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading redis stream: %w", err)
+	}
+
+	return decodeStreamEvents(messages)
+}
+
+func (r RedisStreamReader) LastEventID(ctx context.Context) (string, error) {
+	messages, err := r.client.XRevRangeN(ctx, r.stream, "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("error reading redis stream: %w", err)
+	}
+
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+
+	return messages[0].ID, nil
+}
+
+func (r RedisStreamReader) ReadEvents(
+	ctx context.Context,
+	afterID string,
+	count int,
+	block time.Duration,
+) ([]domain.StreamEvent, error) {
+	streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{r.stream, afterID},
+		Count:   int64(count),
+		Block:   block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error reading redis stream: %w", err)
+	}
+
+	if len(streams) == 0 {
+		return nil, nil
+	}
+
+	return decodeStreamEvents(streams[0].Messages)
+}
+
+func decodeStreamEvents(messages []redis.XMessage) ([]domain.StreamEvent, error) {
+	events := make([]domain.StreamEvent, 0, len(messages))
+
+	for _, message := range messages {
+		payload, ok := message.Values["envelope"].(string)
+		if !ok {
+			return nil, fmt.Errorf("error decoding stream entry %s: no envelope", message.ID)
+		}
+
+		var envelope EventEnvelope
+
+		err := json.Unmarshal([]byte(payload), &envelope)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding stream entry %s: %w", message.ID, err)
+		}
+
+		events = append(events, domain.StreamEvent{
+			StreamID: message.ID,
+			Event:    envelope.Event(),
+		})
+	}
+
+	return events, nil
+}
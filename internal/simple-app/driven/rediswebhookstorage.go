@@ -0,0 +1,298 @@
+package driven
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	webhooksKey              = "webhooks"
+	webhookQueueKey          = "webhooks::queue"
+	webhookJobsKey           = "webhooks::jobs"
+	webhookAttemptsKeyPrefix = "webhooks::attempts::"
+	webhookDeadKeyPrefix     = "webhooks::dead::"
+
+	webhookAttemptsLimit = 100
+	webhookDeadLimit     = 1000
+)
+
+// claimScript moves the score of due deliveries to the end of their lease and returns their ids
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+var _ domain.WebhookStorage = (*RedisWebhookStorage)(nil)
+
+type RedisWebhookStorage struct {
+	storage *RedisStorage
+}
+
+func NewRedisWebhookStorage(storage *RedisStorage) *RedisWebhookStorage {
+	return &RedisWebhookStorage{
+		storage: storage,
+	}
+}
+
+func (w RedisWebhookStorage) StoreWebhook(ctx context.Context, webhook domain.Webhook) (err error) {
+	payload, err := json.Marshal(webhook)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook: %w", err)
+	}
+
+	err = w.storage.client.HSet(ctx, w.storage.sharedID(webhooksKey), webhook.ID.String(), payload).Err()
+	if err != nil {
+		err = fmt.Errorf("error storing webhook to redis: %w", err)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) ReadWebhook(ctx context.Context, id string) (webhook domain.Webhook, err error) {
+	payload, err := w.storage.client.HGet(ctx, w.storage.sharedID(webhooksKey), id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = domain.ErrorNotFound
+
+			return
+		}
+
+		err = fmt.Errorf("error reading webhook from redis: %w", err)
+
+		return
+	}
+
+	err = json.Unmarshal([]byte(payload), &webhook)
+	if err != nil {
+		err = fmt.Errorf("error decoding webhook %s: %w", id, err)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) ListWebhooks(ctx context.Context) (webhooks []domain.Webhook, err error) {
+	payloads, err := w.storage.client.HVals(ctx, w.storage.sharedID(webhooksKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks from redis: %w", err)
+	}
+
+	webhooks = make([]domain.Webhook, 0, len(payloads))
+
+	for _, payload := range payloads {
+		var webhook domain.Webhook
+
+		err = json.Unmarshal([]byte(payload), &webhook)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding webhook: %w", err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	slices.SortFunc(webhooks, func(a, b domain.Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return
+}
+
+func (w RedisWebhookStorage) DeleteWebhook(ctx context.Context, id string) (err error) {
+	var deleted *redis.IntCmd
+
+	_, err = w.storage.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.HDel(ctx, w.storage.sharedID(webhooksKey), id)
+		pipe.Del(ctx, w.storage.sharedID(webhookAttemptsKeyPrefix+id), w.storage.sharedID(webhookDeadKeyPrefix+id))
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting webhook from redis: %w", err)
+	}
+
+	if deleted.Val() == 0 {
+		err = domain.ErrorNotFound
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) ScheduleDelivery(ctx context.Context, delivery domain.WebhookDelivery, at time.Time) (err error) {
+	payload, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("error encoding delivery: %w", err)
+	}
+
+	_, err = w.storage.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, w.storage.sharedID(webhookJobsKey), delivery.ID, payload)
+		pipe.ZAddNX(ctx, w.storage.sharedID(webhookQueueKey), redis.Z{Score: score(at), Member: delivery.ID})
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error scheduling delivery in redis: %w", err)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) ClaimDeliveries(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) (deliveries []domain.WebhookDelivery, err error) {
+	ids, err := claimScript.Run(ctx, w.storage.client,
+		[]string{w.storage.sharedID(webhookQueueKey)},
+		strconv.FormatFloat(score(now), 'f', -1, 64),
+		strconv.FormatFloat(score(now.Add(lease)), 'f', -1, 64),
+		limit,
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("error claiming deliveries in redis: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	payloads, err := w.storage.client.HMGet(ctx, w.storage.sharedID(webhookJobsKey), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading deliveries from redis: %w", err)
+	}
+
+	deliveries = make([]domain.WebhookDelivery, 0, len(payloads))
+
+	for i, payload := range payloads {
+		data, ok := payload.(string)
+		if !ok {
+			// the delivery was finished by another worker in the meantime
+			err = w.storage.client.ZRem(ctx, w.storage.sharedID(webhookQueueKey), ids[i]).Err()
+			if err != nil {
+				return nil, fmt.Errorf("error removing stale delivery from redis: %w", err)
+			}
+
+			continue
+		}
+
+		var delivery domain.WebhookDelivery
+
+		err = json.Unmarshal([]byte(data), &delivery)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding delivery %s: %w", ids[i], err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) RecordAttempt(
+	ctx context.Context,
+	delivery domain.WebhookDelivery,
+	attempt domain.DeliveryAttempt,
+	retryAt time.Time,
+) (err error) {
+	attemptPayload, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("error encoding delivery attempt: %w", err)
+	}
+
+	deliveryPayload, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("error encoding delivery: %w", err)
+	}
+
+	attemptsKey := w.storage.sharedID(webhookAttemptsKeyPrefix + delivery.WebhookID)
+	deadKey := w.storage.sharedID(webhookDeadKeyPrefix + delivery.WebhookID)
+
+	_, err = w.storage.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, attemptsKey, attemptPayload)
+		pipe.LTrim(ctx, attemptsKey, 0, webhookAttemptsLimit-1)
+
+		switch attempt.Status {
+		case domain.DeliveryRetrying:
+			pipe.HSet(ctx, w.storage.sharedID(webhookJobsKey), delivery.ID, deliveryPayload)
+			pipe.ZAdd(ctx, w.storage.sharedID(webhookQueueKey), redis.Z{Score: score(retryAt), Member: delivery.ID})
+		case domain.DeliveryDead:
+			pipe.LPush(ctx, deadKey, deliveryPayload)
+			pipe.LTrim(ctx, deadKey, 0, webhookDeadLimit-1)
+			w.removeDelivery(ctx, pipe, delivery.ID)
+		default:
+			w.removeDelivery(ctx, pipe, delivery.ID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error recording delivery attempt in redis: %w", err)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) DropDelivery(ctx context.Context, id string) (err error) {
+	_, err = w.storage.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		w.removeDelivery(ctx, pipe, id)
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error dropping delivery in redis: %w", err)
+	}
+
+	return
+}
+
+func (w RedisWebhookStorage) ListDeliveryAttempts(ctx context.Context, webhookID string) ([]domain.DeliveryAttempt, error) {
+	return readJSONList[domain.DeliveryAttempt](ctx, w.storage.client, w.storage.sharedID(webhookAttemptsKeyPrefix+webhookID))
+}
+
+func (w RedisWebhookStorage) ListDeadLetters(ctx context.Context, webhookID string) ([]domain.WebhookDelivery, error) {
+	return readJSONList[domain.WebhookDelivery](ctx, w.storage.client, w.storage.sharedID(webhookDeadKeyPrefix+webhookID))
+}
+
+func (w RedisWebhookStorage) removeDelivery(ctx context.Context, pipe redis.Pipeliner, id string) {
+	pipe.ZRem(ctx, w.storage.sharedID(webhookQueueKey), id)
+	pipe.HDel(ctx, w.storage.sharedID(webhookJobsKey), id)
+}
+
+// readJSONList decodes a list of JSON documents, newest first
+func readJSONList[T any](ctx context.Context, client redis.UniversalClient, key string) ([]T, error) {
+	payloads, err := client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from redis: %w", key, err)
+	}
+
+	items := make([]T, 0, len(payloads))
+
+	for _, payload := range payloads {
+		var item T
+
+		err = json.Unmarshal([]byte(payload), &item)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", key, err)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// score turns a time into a sorted set score with millisecond precision
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
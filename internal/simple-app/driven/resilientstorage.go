@@ -0,0 +1,289 @@
+package driven
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var _ domain.UserStorage = (*ResilientStorage)(nil)
+
+// resilienceMetrics holds the breaker state and counts retries, rejected calls and openings, it is served at /admin/debug/vars
+var resilienceMetrics = expvar.NewMap("user_storage_resilience")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// ResilientStorage retries failing calls with jittered backoff and stops calling the storage while it keeps failing.
+// Reads are retried on any failure, writes only when the storage could not be reached,
+// since any other failure may hide a write that went through.
+// Calls that still fail, and calls the open breaker rejects, fail with domain.UnavailableError.
+// Domain errors and writes lost to contention are answers of a working storage, they do not count as failures.
+type ResilientStorage struct {
+	storage domain.UserStorage
+	log     *zap.Logger
+	cfg     config.ResilienceConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewResilientStorage(cfg *config.Config, storage domain.UserStorage, log *zap.Logger) *ResilientStorage {
+	r := &ResilientStorage{
+		storage: storage,
+		log:     log,
+		cfg:     cfg.Resilience,
+	}
+
+	r.publishState()
+
+	return r
+}
+
+func (r *ResilientStorage) Store(ctx context.Context, user domain.User, events ...domain.Event) error {
+	return r.call(ctx, true, func(ctx context.Context) error {
+		return r.storage.Store(ctx, user, events...)
+	})
+}
+
+func (r *ResilientStorage) Read(ctx context.Context, id string) (user domain.User, err error) {
+	err = r.call(ctx, false, func(ctx context.Context) (err error) {
+		user, err = r.storage.Read(ctx, id)
+
+		return err
+	})
+
+	return user, err
+}
+
+func (r *ResilientStorage) Delete(ctx context.Context, id string, events ...domain.Event) error {
+	return r.call(ctx, true, func(ctx context.Context) error {
+		return r.storage.Delete(ctx, id, events...)
+	})
+}
+
+func (r *ResilientStorage) Batch(
+	ctx context.Context,
+	mutations []domain.UserMutation,
+	allOrNothing bool,
+) (results []error, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		results, err = r.storage.Batch(ctx, mutations, allOrNothing)
+
+		return err
+	})
+
+	return results, err
+}
+
+func (r *ResilientStorage) List(ctx context.Context, cursor string, limit int) (users []domain.User, next string, err error) {
+	err = r.call(ctx, false, func(ctx context.Context) (err error) {
+		users, next, err = r.storage.List(ctx, cursor, limit)
+
+		return err
+	})
+
+	return users, next, err
+}
+
+func (r *ResilientStorage) Search(ctx context.Context, query domain.NameQuery, limit int) (users []domain.User, err error) {
+	err = r.call(ctx, false, func(ctx context.Context) (err error) {
+		users, err = r.storage.Search(ctx, query, limit)
+
+		return err
+	})
+
+	return users, err
+}
+
+func (r *ResilientStorage) call(ctx context.Context, write bool, fn func(ctx context.Context) error) error {
+	var failure error
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, allowed := r.allow()
+		if !allowed {
+			resilienceMetrics.Add("rejected", 1)
+
+			if failure != nil {
+				// the breaker opened between the attempts, the failure that opened it tells more
+				return fmt.Errorf("%w: %w", domain.UnavailableError{RetryAfter: retryAfter}, failure)
+			}
+
+			return domain.UnavailableError{RetryAfter: retryAfter}
+		}
+
+		err := fn(ctx)
+
+		switch {
+		case err == nil, isDomainError(err), isContention(err):
+			r.succeed()
+
+			return err
+		case ctx.Err() != nil:
+			// the caller gave up, which says nothing about the storage
+			r.release()
+
+			return err
+		}
+
+		r.fail(err)
+		failure = err
+
+		if attempt >= r.cfg.MaxAttempts || (write && !isConnectError(err)) {
+			return fmt.Errorf("%w: %w", domain.UnavailableError{RetryAfter: r.retryAfter()}, err)
+		}
+
+		resilienceMetrics.Add("retries", 1)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(domain.Backoff(r.cfg.BackoffBase, r.cfg.BackoffMax, attempt)):
+		}
+	}
+}
+
+// allow lets calls through while the breaker is closed, and a single probe once it has been open for OpenTimeout
+func (r *ResilientStorage) allow() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case breakerOpen:
+		remaining := r.cfg.OpenTimeout - time.Since(r.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+
+		r.transition(breakerHalfOpen, nil)
+		r.probing = true
+
+		return 0, true
+	case breakerHalfOpen:
+		if r.probing {
+			return r.cfg.BackoffMax, false
+		}
+
+		r.probing = true
+
+		return 0, true
+	default:
+		return 0, true
+	}
+}
+
+func (r *ResilientStorage) succeed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = 0
+	r.probing = false
+
+	if r.state != breakerClosed {
+		r.transition(breakerClosed, nil)
+	}
+}
+
+func (r *ResilientStorage) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures++
+	r.probing = false
+
+	if r.state == breakerHalfOpen || (r.state == breakerClosed && r.failures >= r.cfg.FailureThreshold) {
+		r.openedAt = time.Now()
+		r.transition(breakerOpen, err)
+	}
+}
+
+// release ends a probe that neither succeeded nor failed, so the next call probes instead
+func (r *ResilientStorage) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.probing = false
+}
+
+func (r *ResilientStorage) retryAfter() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == breakerOpen {
+		return r.cfg.OpenTimeout
+	}
+
+	return r.cfg.BackoffMax
+}
+
+// transition has to be called with mu held
+func (r *ResilientStorage) transition(state breakerState, err error) {
+	r.state = state
+	r.publishState()
+
+	switch state {
+	case breakerOpen:
+		resilienceMetrics.Add("opened", 1)
+		r.log.Warn("storage circuit breaker opened", zap.Int("failures", r.failures),
+			zap.Duration("open_timeout", r.cfg.OpenTimeout), zap.Error(err))
+	case breakerHalfOpen:
+		r.log.Info("storage circuit breaker half-open, probing the storage")
+	case breakerClosed:
+		r.log.Info("storage circuit breaker closed")
+	}
+}
+
+func (r *ResilientStorage) publishState() {
+	state := new(expvar.String)
+	state.Set(r.state.String())
+	resilienceMetrics.Set("state", state)
+}
+
+// isDomainError tells answers of a working storage apart from failures
+func isDomainError(err error) bool {
+	return errors.Is(err, domain.ErrorNotFound) ||
+		errors.Is(err, domain.ErrorInvalidInput) ||
+		errors.Is(err, domain.ErrorConflict) ||
+		errors.Is(err, domain.ErrorAborted)
+}
+
+// isConnectError tells whether the storage could not even be reached, so nothing was written
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isContention tells writes that lost to concurrent ones too often apart from failures, the storage answered them
+func isContention(err error) bool {
+	return errors.Is(err, redis.TxFailedErr)
+}
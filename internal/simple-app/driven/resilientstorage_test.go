@@ -0,0 +1,144 @@
+package driven
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven/storagetest"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestResilience(storage domain.UserStorage) *ResilientStorage {
+	return NewResilientStorage(&config.Config{
+		Resilience: config.ResilienceConfig{
+			MaxAttempts:      3,
+			BackoffBase:      time.Millisecond,
+			BackoffMax:       2 * time.Millisecond,
+			FailureThreshold: 3,
+			OpenTimeout:      50 * time.Millisecond,
+		},
+	}, storage, zap.NewNop())
+}
+
+func TestResilientStorage(t *testing.T) {
+	ctx := context.Background()
+	user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+	id := user.ID.String()
+	blip := errors.New("connection reset by peer")
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	storagetest.Run(t, func(t *testing.T) domain.UserStorage {
+		return newTestResilience(newCacheTestStorage(t))
+	})
+
+	t.Run("reads are retried", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", mock.Anything, id).Return(domain.User{}, blip).Twice()
+		storage.On("Read", mock.Anything, id).Return(user, nil).Once()
+
+		read, err := newTestResilience(storage).Read(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, user, read)
+	})
+
+	t.Run("writes are retried only when the storage was not reached", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Store", mock.Anything, user).Return(refused).Once()
+		storage.On("Store", mock.Anything, user).Return(nil).Once()
+		storage.On("Delete", mock.Anything, id).Return(blip).Once()
+
+		resilient := newTestResilience(storage)
+		require.NoError(t, resilient.Store(ctx, user))
+
+		err := resilient.Delete(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorUnavailable)
+		require.ErrorIs(t, err, blip)
+	})
+
+	t.Run("domain errors are answers", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", mock.Anything, id).Return(domain.User{}, domain.ErrorNotFound).Times(5)
+
+		resilient := newTestResilience(storage)
+
+		for range 5 {
+			_, err := resilient.Read(ctx, id)
+			require.ErrorIs(t, err, domain.ErrorNotFound)
+			require.NotErrorIs(t, err, domain.ErrorUnavailable)
+		}
+	})
+
+	t.Run("contention is an answer", func(t *testing.T) {
+		contended := fmt.Errorf("error storing user in redis: %w", redis.TxFailedErr)
+		storage := mocks.NewUserStorage(t)
+		storage.On("Store", mock.Anything, user).Return(contended).Times(5)
+
+		resilient := newTestResilience(storage)
+
+		// more than FailureThreshold in a row, the breaker stays closed
+		for range 5 {
+			err := resilient.Store(ctx, user)
+			require.ErrorIs(t, err, redis.TxFailedErr)
+			require.NotErrorIs(t, err, domain.ErrorUnavailable)
+		}
+	})
+
+	t.Run("breaker fails fast and recovers", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", mock.Anything, id).Return(domain.User{}, blip).Times(3)
+
+		resilient := newTestResilience(storage)
+
+		_, err := resilient.Read(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorUnavailable)
+		require.ErrorIs(t, err, blip)
+
+		// the breaker is open, so the storage is not called at all
+		_, err = resilient.Read(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorUnavailable)
+		require.NotErrorIs(t, err, blip)
+		require.Positive(t, domain.RetryAfter(err))
+
+		time.Sleep(60 * time.Millisecond)
+
+		storage.On("Read", mock.Anything, id).Return(user, nil).Twice()
+
+		for range 2 {
+			read, err := resilient.Read(ctx, id)
+			require.NoError(t, err)
+			require.Equal(t, user, read)
+		}
+	})
+
+	t.Run("failed probe opens the breaker again", func(t *testing.T) {
+		storage := mocks.NewUserStorage(t)
+		storage.On("Read", mock.Anything, id).Return(domain.User{}, blip).Times(4)
+
+		resilient := newTestResilience(storage)
+
+		_, err := resilient.Read(ctx, id)
+		require.ErrorIs(t, err, blip)
+
+		time.Sleep(60 * time.Millisecond)
+
+		_, err = resilient.Read(ctx, id)
+		require.ErrorIs(t, err, blip)
+
+		_, err = resilient.Read(ctx, id)
+		require.ErrorIs(t, err, domain.ErrorUnavailable)
+		require.NotErrorIs(t, err, blip)
+	})
+}
@@ -0,0 +1,532 @@
+// Package storagetest holds the behavior every domain.UserStorage has to show, so backends and decorators are checked alike
+package storagetest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrency is the number of goroutines racing in the concurrency checks
+const concurrency = 10
+
+// Factory returns an empty storage, it is called once for every check
+type Factory func(t *testing.T) domain.UserStorage
+
+// Run checks the storage that factory makes against the contract of domain.UserStorage,
+// the checks named in skip are left out for storages that cannot do what they check
+func Run(t *testing.T, factory Factory, skip ...string) {
+	checks := []struct {
+		name  string
+		check func(t *testing.T, storage domain.UserStorage)
+	}{
+		{"crud", testCRUD},
+		{"not found", testNotFound},
+		{"list", testList},
+		{"batch", testBatch},
+		{"search", testSearch},
+		{"unique email", testUniqueEmail},
+		{"concurrency", testConcurrency},
+		{"context cancellation", testCancellation},
+		{"large and unicode values", testValues},
+		{"search large and unicode values", testSearchValues},
+		{"expiry", testExpiry},
+	}
+
+	for _, c := range checks {
+		if slices.Contains(skip, c.name) {
+			continue
+		}
+
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, factory(t))
+		})
+	}
+}
+
+func testCRUD(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	user := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()}
+
+	require.NoError(t, storage.Store(ctx, user, event(ctx, domain.EventUserCreated, user)))
+
+	stored, err := storage.Read(ctx, user.ID.String())
+	require.NoError(t, err)
+	require.Equal(t, user, stored)
+
+	user.Name, user.Email = gofakeit.Username(), ""
+	require.NoError(t, storage.Store(ctx, user, event(ctx, domain.EventUserUpdated, user)))
+
+	stored, err = storage.Read(ctx, user.ID.String())
+	require.NoError(t, err)
+	require.Equal(t, user, stored)
+
+	require.NoError(t, storage.Delete(ctx, user.ID.String(), event(ctx, domain.EventUserDeleted, user)))
+
+	_, err = storage.Read(ctx, user.ID.String())
+	require.ErrorIs(t, err, domain.ErrorNotFound)
+}
+
+func testNotFound(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	id := uuid.New()
+
+	_, err := storage.Read(ctx, id.String())
+	require.ErrorIs(t, err, domain.ErrorNotFound)
+
+	err = storage.Delete(ctx, id.String())
+	require.ErrorIs(t, err, domain.ErrorNotFound)
+
+	_, err = storage.Read(ctx, "42")
+	require.ErrorIs(t, err, domain.ErrorInvalidInput)
+
+	results, err := storage.Batch(ctx, []domain.UserMutation{
+		mutation(ctx, domain.BatchUpdate, domain.User{ID: id, Name: gofakeit.Username()}),
+		mutation(ctx, domain.BatchDelete, domain.User{ID: id}),
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []error{domain.ErrorNotFound, domain.ErrorNotFound}, results)
+
+	users, next, err := storage.List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Empty(t, users)
+	require.Empty(t, next)
+}
+
+func testList(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	stored := make(map[uuid.UUID]string)
+
+	for range 5 {
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+		stored[user.ID] = user.Name
+		require.NoError(t, storage.Store(ctx, user))
+	}
+
+	listed := make(map[uuid.UUID]string)
+	cursor := ""
+
+	for {
+		users, next, err := storage.List(ctx, cursor, 2)
+		require.NoError(t, err)
+
+		for _, user := range users {
+			listed[user.ID] = user.Name
+		}
+
+		if next == "" {
+			break
+		}
+
+		cursor = next
+	}
+
+	require.Equal(t, stored, listed)
+
+	_, _, err := storage.List(ctx, "not-a-cursor", 2)
+	require.ErrorIs(t, err, domain.ErrorInvalidInput)
+}
+
+func testBatch(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	existing := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+	created := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+	missing := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+	require.NoError(t, storage.Store(ctx, existing))
+
+	t.Run("atomic batch is rejected as a whole", func(t *testing.T) {
+		results, err := storage.Batch(ctx, []domain.UserMutation{
+			mutation(ctx, domain.BatchCreate, created),
+			mutation(ctx, domain.BatchUpdate, missing),
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, []error{domain.ErrorAborted, domain.ErrorNotFound}, results)
+
+		_, err = storage.Read(ctx, created.ID.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+	})
+
+	t.Run("best effort batch applies what it can", func(t *testing.T) {
+		renamed := domain.User{ID: created.ID, Name: gofakeit.Username()}
+
+		results, err := storage.Batch(ctx, []domain.UserMutation{
+			mutation(ctx, domain.BatchCreate, created),
+			mutation(ctx, domain.BatchUpdate, renamed),
+			mutation(ctx, domain.BatchDelete, missing),
+			mutation(ctx, domain.BatchDelete, existing),
+			mutation(ctx, domain.BatchUpdate, existing),
+		}, false)
+		require.NoError(t, err)
+		require.Equal(t, []error{nil, nil, domain.ErrorNotFound, nil, domain.ErrorNotFound}, results)
+
+		stored, err := storage.Read(ctx, created.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, renamed, stored)
+
+		_, err = storage.Read(ctx, existing.ID.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+	})
+}
+
+func testSearch(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	base := gofakeit.UUID()
+	alice := domain.User{ID: uuid.New(), Name: base + "Alice"}
+	lower := domain.User{ID: uuid.New(), Name: base + "alice"}
+	alicia := domain.User{ID: uuid.New(), Name: base + "Alicia"}
+	wildcard := domain.User{ID: uuid.New(), Name: base + "_%"}
+
+	for _, user := range []domain.User{alice, lower, alicia, wildcard} {
+		require.NoError(t, storage.Store(ctx, user))
+	}
+
+	search := func(query domain.NameQuery) []uuid.UUID {
+		users, err := storage.Search(ctx, query, 10)
+		require.NoError(t, err)
+
+		ids := make([]uuid.UUID, 0, len(users))
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+
+		return ids
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		require.Equal(t, []uuid.UUID{alice.ID}, search(domain.NameQuery{Name: alice.Name}))
+		require.Empty(t, search(domain.NameQuery{Name: base + "Ali"}))
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		require.Equal(t, []uuid.UUID{alice.ID, alicia.ID}, search(domain.NameQuery{Name: base + "Ali", Prefix: true}))
+		require.Equal(t, []uuid.UUID{wildcard.ID}, search(domain.NameQuery{Name: base + "_", Prefix: true}))
+	})
+
+	t.Run("ignore case", func(t *testing.T) {
+		require.ElementsMatch(t, []uuid.UUID{alice.ID, lower.ID}, search(domain.NameQuery{Name: base + "ALICE", IgnoreCase: true}))
+		require.Len(t, search(domain.NameQuery{Name: base + "ali", Prefix: true, IgnoreCase: true}), 3)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		users, err := storage.Search(ctx, domain.NameQuery{Name: base, Prefix: true}, 2)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+	})
+
+	t.Run("index follows updates and deletes", func(t *testing.T) {
+		require.NoError(t, storage.Store(ctx, domain.User{ID: alice.ID, Name: base + "Bob"}))
+		require.NoError(t, storage.Delete(ctx, alicia.ID.String()))
+
+		results, err := storage.Batch(ctx, []domain.UserMutation{
+			mutation(ctx, domain.BatchUpdate, domain.User{ID: lower.ID, Name: base + "bobby"}),
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, []error{nil}, results)
+
+		require.Empty(t, search(domain.NameQuery{Name: base + "ali", Prefix: true, IgnoreCase: true}))
+		require.ElementsMatch(t, []uuid.UUID{alice.ID, lower.ID}, search(domain.NameQuery{Name: base + "bob", Prefix: true, IgnoreCase: true}))
+	})
+
+	t.Run("index follows concurrent writes of one user", func(t *testing.T) {
+		stored := storeConcurrently(t, storage)
+
+		found, err := storage.Search(ctx, domain.NameQuery{Name: stored.Name}, 10)
+		require.NoError(t, err)
+		require.Equal(t, []domain.User{stored}, found)
+	})
+}
+
+func testUniqueEmail(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	email := gofakeit.Email()
+	owner := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: email}
+	other := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: strings.ToUpper(email)}
+
+	require.NoError(t, storage.Store(ctx, owner))
+
+	t.Run("email is taken regardless of case", func(t *testing.T) {
+		require.ErrorIs(t, storage.Store(ctx, other), domain.ErrorConflict)
+
+		results, err := storage.Batch(ctx, []domain.UserMutation{mutation(ctx, domain.BatchCreate, other)}, false)
+		require.NoError(t, err)
+		require.Equal(t, []error{domain.ErrorConflict}, results)
+	})
+
+	t.Run("owner keeps its email on update", func(t *testing.T) {
+		owner.Name = gofakeit.Username()
+		require.NoError(t, storage.Store(ctx, owner))
+	})
+
+	t.Run("email change releases the old one", func(t *testing.T) {
+		owner.Email = gofakeit.Email()
+		require.NoError(t, storage.Store(ctx, owner))
+		require.NoError(t, storage.Store(ctx, other))
+	})
+
+	t.Run("delete releases the email", func(t *testing.T) {
+		require.NoError(t, storage.Delete(ctx, other.ID.String()))
+
+		owner.Email = email
+		results, err := storage.Batch(ctx, []domain.UserMutation{mutation(ctx, domain.BatchUpdate, owner)}, true)
+		require.NoError(t, err)
+		require.Equal(t, []error{nil}, results)
+	})
+}
+
+func testConcurrency(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+
+	t.Run("concurrent writes of one user leave one of them", func(t *testing.T) {
+		storeConcurrently(t, storage)
+	})
+
+	t.Run("concurrent creates claim an email once", func(t *testing.T) {
+		email := gofakeit.Email()
+		errs := make(chan error, concurrency)
+
+		for range concurrency {
+			go func() {
+				errs <- storage.Store(ctx, domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: email})
+			}()
+		}
+
+		stored := 0
+
+		for range concurrency {
+			err := <-errs
+			if err == nil {
+				stored++
+
+				continue
+			}
+
+			require.ErrorIs(t, err, domain.ErrorConflict)
+		}
+
+		require.Equal(t, 1, stored)
+	})
+}
+
+// storeConcurrently races writes of one user and returns the write that is left
+func storeConcurrently(t *testing.T, storage domain.UserStorage) domain.User {
+	ctx := context.Background()
+	id := uuid.New()
+	names := make([]string, concurrency)
+	errs := make([]error, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range concurrency {
+		names[i] = gofakeit.Username()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs[i] = storage.Store(ctx, domain.User{ID: id, Name: names[i]})
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	stored, err := storage.Read(ctx, id.String())
+	require.NoError(t, err)
+	require.Contains(t, names, stored.Name)
+
+	return stored
+}
+
+func testCancellation(t *testing.T, storage domain.UserStorage) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	user := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+	require.ErrorIs(t, storage.Store(cancelled, user), context.Canceled)
+
+	_, err := storage.Read(context.Background(), user.ID.String())
+	require.ErrorIs(t, err, domain.ErrorNotFound, "a cancelled store must not write")
+
+	require.NoError(t, storage.Store(context.Background(), user))
+
+	_, err = storage.Read(cancelled, user.ID.String())
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.ErrorIs(t, storage.Delete(cancelled, user.ID.String()), context.Canceled)
+
+	_, _, err = storage.List(cancelled, "", 10)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = storage.Search(cancelled, domain.NameQuery{Name: user.Name}, 10)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = storage.Batch(cancelled, []domain.UserMutation{mutation(cancelled, domain.BatchDelete, user)}, true)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = storage.Read(context.Background(), user.ID.String())
+	require.NoError(t, err, "a cancelled delete must not delete")
+}
+
+// values holds names and emails that are easy to get wrong
+func values() map[string]domain.User {
+	return map[string]domain.User{
+		"large": {ID: uuid.New(), Name: strings.Repeat(gofakeit.Letter(), 1<<16)},
+		"unicode": {
+			ID:    uuid.New(),
+			Name:  "Zoë 李雷 Łukasz 🚀 " + gofakeit.Username(),
+			Email: "zoë.łukasz@例え.jp",
+		},
+		"separators": {ID: uuid.New(), Name: `a::b "quoted" \ 'single' ` + gofakeit.Username()},
+	}
+}
+
+func testValues(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+
+	for name, user := range values() {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, storage.Store(ctx, user))
+
+			stored, err := storage.Read(ctx, user.ID.String())
+			require.NoError(t, err)
+			require.Equal(t, user, stored)
+		})
+	}
+
+	t.Run("unicode case folding", func(t *testing.T) {
+		user := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: "Ölaf@Ærø.example"}
+		require.NoError(t, storage.Store(ctx, user))
+
+		err := storage.Store(ctx, domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: "ölaf@ærø.example"})
+		require.ErrorIs(t, err, domain.ErrorConflict)
+	})
+}
+
+func testSearchValues(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+
+	for name, user := range values() {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, storage.Store(ctx, user))
+
+			found, err := storage.Search(ctx, domain.NameQuery{Name: user.Name}, 10)
+			require.NoError(t, err)
+			require.Equal(t, []domain.User{user}, found)
+		})
+	}
+
+	t.Run("unicode case folding", func(t *testing.T) {
+		user := domain.User{ID: uuid.New(), Name: "Ölaf Ærø " + gofakeit.UUID()}
+		require.NoError(t, storage.Store(ctx, user))
+
+		found, err := storage.Search(ctx, domain.NameQuery{Name: "ölaf ærø", Prefix: true, IgnoreCase: true}, 10)
+		require.NoError(t, err)
+		require.Contains(t, found, user)
+	})
+}
+
+// testExpiry checks that expired users are gone before they are swept, the sweep itself is checked
+// for the storages that expire users on their own
+func testExpiry(t *testing.T, storage domain.UserStorage) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(300 * time.Millisecond).UTC().Truncate(time.Millisecond)
+	expiring := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email(), ExpiresAt: expiresAt}
+	batched := domain.User{ID: uuid.New(), Name: gofakeit.Username(), ExpiresAt: expiresAt}
+	permanent := domain.User{ID: uuid.New(), Name: gofakeit.Username()}
+
+	require.NoError(t, storage.Store(ctx, expiring, event(ctx, domain.EventUserCreated, expiring)))
+	require.NoError(t, storage.Store(ctx, permanent, event(ctx, domain.EventUserCreated, permanent)))
+
+	results, err := storage.Batch(ctx, []domain.UserMutation{mutation(ctx, domain.BatchCreate, batched)}, true)
+	require.NoError(t, err)
+	require.Equal(t, []error{nil}, results)
+
+	for _, user := range []domain.User{expiring, batched} {
+		stored, err := storage.Read(ctx, user.ID.String())
+		require.NoError(t, err)
+		require.Equal(t, user, stored)
+	}
+
+	time.Sleep(time.Until(expiresAt) + 50*time.Millisecond)
+
+	for _, user := range []domain.User{expiring, batched} {
+		_, err = storage.Read(ctx, user.ID.String())
+		require.ErrorIs(t, err, domain.ErrorNotFound)
+
+		require.ErrorIs(t, storage.Delete(ctx, user.ID.String()), domain.ErrorNotFound)
+	}
+
+	users, _, err := storage.List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []domain.User{permanent}, users)
+
+	// an expired user gives up its email
+	taken := domain.User{ID: uuid.New(), Name: gofakeit.Username(), Email: expiring.Email}
+	require.NoError(t, storage.Store(ctx, taken, event(ctx, domain.EventUserCreated, taken)))
+
+	expiry, ok := storage.(domain.UserExpiry)
+	if !ok {
+		return
+	}
+
+	var expired []string
+
+	count, err := expiry.ExpireUsers(ctx, time.Now(), 10, func(ctx context.Context, id string) domain.Event {
+		expired = append(expired, id)
+
+		return domain.NewEvent(ctx, domain.EventUserExpired, id, "")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.ElementsMatch(t, []string{expiring.ID.String(), batched.ID.String()}, expired)
+
+	count, err = expiry.ExpireUsers(ctx, time.Now(), 10, func(ctx context.Context, id string) domain.Event {
+		return domain.NewEvent(ctx, domain.EventUserExpired, id, "")
+	})
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	stored, err := storage.Read(ctx, taken.ID.String())
+	require.NoError(t, err)
+	require.Equal(t, taken, stored)
+}
+
+func event(ctx context.Context, eventType domain.EventType, user domain.User) domain.Event {
+	return domain.NewEvent(ctx, eventType, user.ID.String(), user.Name)
+}
+
+// mutation builds the mutation the application would hand to storage, event included
+func mutation(ctx context.Context, op domain.BatchOp, user domain.User) domain.UserMutation {
+	eventType := domain.EventUserUpdated
+
+	switch op {
+	case domain.BatchCreate:
+		eventType = domain.EventUserCreated
+	case domain.BatchDelete:
+		eventType = domain.EventUserDeleted
+	}
+
+	return domain.UserMutation{
+		Op:        op,
+		ID:        user.ID.String(),
+		Name:      user.Name,
+		Email:     user.Email,
+		ExpiresAt: user.ExpiresAt,
+		Event:     event(ctx, eventType, user),
+	}
+}
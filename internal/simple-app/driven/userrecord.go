@@ -0,0 +1,96 @@
+package driven
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+)
+
+// the versions of the user values, every value is written in the latest one and read in any of them:
+// 0 is the bare name, written before users had an email, 1 the record without its version, 2 the record with it
+const (
+	userRecordNameOnly    = 0
+	userRecordUnversioned = 1
+	userRecordVersion     = 2
+)
+
+// userRecord is the value kept under a user key, Version is the version of the encoding it was read in.
+// ExpiresAt counts milliseconds since the epoch, zero for users that do not expire.
+type userRecord struct {
+	Version   int    `json:"v"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+func newUserRecord(name, email string, expiresAt time.Time) userRecord {
+	record := userRecord{Version: userRecordVersion, Name: name, Email: email}
+
+	if !expiresAt.IsZero() {
+		record.ExpiresAt = expiresAt.UnixMilli()
+	}
+
+	return record
+}
+
+// encodeUser writes the record in the latest version
+func encodeUser(record userRecord) (string, error) {
+	record = record.upgrade()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("error encoding user: %w", err)
+	}
+
+	return string(value), nil
+}
+
+func decodeUser(value string) userRecord {
+	var record userRecord
+
+	if strings.HasPrefix(value, "{") && json.Unmarshal([]byte(value), &record) == nil {
+		if record.Version == userRecordNameOnly {
+			record.Version = userRecordUnversioned
+		}
+
+		return record
+	}
+
+	return userRecord{Version: userRecordNameOnly, Name: value}
+}
+
+// outdated tells records read in an older version than the latest, records of newer versions are left to newer code
+func (u userRecord) outdated() bool {
+	return u.Version < userRecordVersion
+}
+
+// upgrade brings the record to the latest version, a version that changes the model converts the older records here
+func (u userRecord) upgrade() userRecord {
+	if u.outdated() {
+		u.Version = userRecordVersion
+	}
+
+	return u
+}
+
+func (u userRecord) user(id uuid.UUID) domain.User {
+	return domain.User{ID: id, Name: u.Name, Email: u.Email, ExpiresAt: u.expiresAt()}
+}
+
+func (u userRecord) expiresAt() time.Time {
+	if u.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(u.ExpiresAt).UTC()
+}
+
+// expired tells users whose expiry has passed by now
+func (u userRecord) expired(now time.Time) bool {
+	return u.ExpiresAt != 0 && u.ExpiresAt <= now.UnixMilli()
+}
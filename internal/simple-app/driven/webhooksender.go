@@ -0,0 +1,84 @@
+package driven
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+)
+
+const (
+	HeaderWebhookID        = "X-Webhook-Id"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	// HeaderWebhookSignature carries "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+var _ domain.WebhookSender = (*HTTPWebhookSender)(nil)
+
+type HTTPWebhookSender struct {
+	client *http.Client
+}
+
+func NewHTTPWebhookSender(cfg *config.Config) *HTTPWebhookSender {
+	return &HTTPWebhookSender{
+		client: &http.Client{
+			Timeout: cfg.Webhook.Timeout,
+		},
+	}
+}
+
+func (s HTTPWebhookSender) Send(ctx context.Context, webhook domain.Webhook, event domain.Event) (statusCode int, err error) {
+	body, err := json.Marshal(NewEventEnvelope(event))
+	if err != nil {
+		return 0, fmt.Errorf("error encoding event: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, event.ID)
+	req.Header.Set(HeaderWebhookEvent, string(event.Type))
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending webhook: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package driven
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPWebhookSender(t *testing.T) {
+	ctx := context.Background()
+	sender := NewHTTPWebhookSender(&config.Config{Webhook: config.WebhookConfig{Timeout: time.Second}})
+	event := domain.NewEvent(ctx, domain.EventUserCreated, gofakeit.UUID(), gofakeit.Username())
+	secret := gofakeit.Password(true, true, true, false, false, 32)
+
+	t.Run("signed delivery", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, event.ID, r.Header.Get(HeaderWebhookID))
+			require.Equal(t, string(domain.EventUserCreated), r.Header.Get(HeaderWebhookEvent))
+			require.Equal(t, SignWebhook(secret, r.Header.Get(HeaderWebhookTimestamp), body), r.Header.Get(HeaderWebhookSignature))
+
+			var envelope EventEnvelope
+			require.NoError(t, json.Unmarshal(body, &envelope))
+			require.Equal(t, event.UserID, envelope.Data.ID)
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		statusCode, err := sender.Send(ctx, domain.Webhook{URL: server.URL, Secret: secret}, event)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, statusCode)
+	})
+
+	t.Run("failed delivery", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		statusCode, err := sender.Send(ctx, domain.Webhook{URL: server.URL, Secret: secret}, event)
+		require.Error(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, statusCode)
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		// reference value computed with: printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+		require.Equal(t,
+			"sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+			SignWebhook("secret", "1700000000", []byte("{}")),
+		)
+	})
+}
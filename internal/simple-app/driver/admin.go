@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	adminPath    = "/admin/"
+	webhooksPath = "/api/webhooks"
+)
+
+// AdminMiddleware guards the admin endpoints with the admin token as bearer token.
+// While tenants are enabled it guards the webhook endpoints as well, since webhooks receive the events of every tenant
+func AdminMiddleware(cfg *config.Config) echo.MiddlewareFunc {
+	token := cfg.Tenant.AdminToken
+	guardWebhooks := cfg.Tenant.Enabled
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			path := ctx.Request().URL.Path
+
+			if !strings.HasPrefix(path, adminPath) && !(guardWebhooks && strings.HasPrefix(path, webhooksPath)) {
+				return next(ctx)
+			}
+
+			if token == "" {
+				return echo.NewHTTPError(http.StatusForbidden, "no admin token is configured")
+			}
+
+			given, ok := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), bearerPrefix)
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or wrong admin token")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+func (h HTTPServer) ListTenants(ctx echo.Context) error {
+	if h.tenants == nil {
+		return tenantsUnavailable()
+	}
+
+	tenants, err := h.tenants.ListTenants(ctx.Request().Context())
+	if err != nil {
+		return serverError(ctx, err)
+	}
+
+	response := make([]Tenant, 0, len(tenants))
+	for _, tenant := range tenants {
+		response = append(response, Tenant{Name: tenant.Name, Users: tenant.Users, Quota: tenant.Quota})
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h HTTPServer) PurgeTenant(ctx echo.Context, tenant string) error {
+	if h.tenants == nil {
+		return tenantsUnavailable()
+	}
+
+	users, err := h.tenants.PurgeTenant(ctx.Request().Context(), tenant)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrorInvalidInput):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrorNotFound):
+			return ctx.NoContent(http.StatusNotFound)
+		}
+
+		return serverError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, TenantPurge{Name: tenant, Users: users})
+}
+
+// tenantsUnavailable answers the tenant endpoints while redis is not the storage, only redis keeps the tenants apart
+func tenantsUnavailable() error {
+	return echo.NewHTTPError(http.StatusNotImplemented, "tenants need the redis storage")
+}
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	apiTenants = "/admin/tenants"
+)
+
+func (s *HttpServerTestSuite) TestListTenants() {
+	s.Run("happy case", func() {
+		s.tenants.On("ListTenants", mock.Anything).
+			Return([]domain.TenantInfo{{Name: "acme", Users: 3, Quota: 10}}, nil).Once()
+		s.tester.GET(apiTenants).
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+testAdminToken).
+			Expect().
+			Status(http.StatusOK).JSON().Array().Element(0).Object().
+			HasValue("name", "acme").
+			HasValue("users", 3).
+			HasValue("quota", 10)
+	})
+
+	s.Run("missing token", func() {
+		s.tester.GET(apiTenants).
+			Expect().
+			Status(http.StatusUnauthorized)
+	})
+
+	s.Run("wrong token", func() {
+		s.tester.GET(apiTenants).
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+"guess").
+			Expect().
+			Status(http.StatusUnauthorized)
+	})
+
+	s.Run("error in app", func() {
+		s.tenants.On("ListTenants", mock.Anything).Return(nil, fakeError).Once()
+		s.tester.GET(apiTenants).
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+testAdminToken).
+			Expect().
+			Status(http.StatusInternalServerError)
+	})
+}
+
+func (s *HttpServerTestSuite) TestPurgeTenant() {
+	s.Run("happy case", func() {
+		s.tenants.On("PurgeTenant", mock.Anything, "acme").Return(int64(3), nil).Once()
+		s.tester.DELETE(apiTenants+"/acme").
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+testAdminToken).
+			Expect().
+			Status(http.StatusOK).JSON().Object().HasValue("name", "acme").HasValue("users", 3)
+	})
+
+	s.Run("unknown tenant", func() {
+		s.tenants.On("PurgeTenant", mock.Anything, "globex").Return(int64(0), domain.ErrorNotFound).Once()
+		s.tester.DELETE(apiTenants+"/globex").
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+testAdminToken).
+			Expect().
+			Status(http.StatusNotFound)
+	})
+
+	s.Run("malformed tenant", func() {
+		s.tenants.On("PurgeTenant", mock.Anything, "Acme").Return(int64(0), domain.ErrorInvalidInput).Once()
+		s.tester.DELETE(apiTenants+"/Acme").
+			WithHeader(echo.HeaderAuthorization, bearerPrefix+testAdminToken).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	serve := func(cfg *config.Config, path, authorization string) int {
+		e := echo.New()
+		e.Use(AdminMiddleware(cfg))
+		e.GET(path, func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	shared := &config.Config{Tenant: config.TenantConfig{AdminToken: testAdminToken}}
+	tenants := &config.Config{Tenant: config.TenantConfig{Enabled: true, AdminToken: testAdminToken}}
+
+	require.Equal(t, http.StatusOK, serve(shared, apiWebhooks, ""))
+	require.Equal(t, http.StatusUnauthorized, serve(tenants, apiWebhooks, ""))
+	require.Equal(t, http.StatusOK, serve(tenants, apiWebhooks, bearerPrefix+testAdminToken))
+	require.Equal(t, http.StatusOK, serve(tenants, apiUser, ""))
+	require.Equal(t, http.StatusForbidden, serve(&config.Config{}, apiTenants, bearerPrefix))
+}
@@ -0,0 +1,250 @@
+package driver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+)
+
+const (
+	backupFormat  = "simple-app-backup"
+	backupVersion = 1
+)
+
+// BackupInfo describes a backup, Storage and Tenant are where the users were backed up from
+type BackupInfo struct {
+	CreatedAt time.Time
+	Storage   string
+	Tenant    string
+	Users     int
+}
+
+// backupLine is a line of a backup: the header, a user or the trailer.
+// A backup is gzipped ndjson, the trailer closes it with the number of users and the SHA-256 of the lines before it.
+type backupLine struct {
+	Header  *backupHeader  `json:"header,omitempty"`
+	User    *backupUser    `json:"user,omitempty"`
+	Trailer *backupTrailer `json:"trailer,omitempty"`
+}
+
+type backupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Storage   string    `json:"storage"`
+	Tenant    string    `json:"tenant,omitempty"`
+}
+
+type backupUser struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type backupTrailer struct {
+	Users  int    `json:"users"`
+	SHA256 string `json:"sha256"`
+}
+
+// WriteBackup writes the users to w as a backup and returns how many there were,
+// storage and tenant only describe where they come from
+func WriteBackup(w io.Writer, users iter.Seq2[domain.User, error], storage, tenant string) (count int, err error) {
+	zw := gzip.NewWriter(w)
+	sum := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(zw, sum))
+	encoder := json.NewEncoder(buf)
+
+	err = encoder.Encode(backupLine{Header: &backupHeader{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Storage:   storage,
+		Tenant:    tenant,
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	for user, err := range users {
+		if err != nil {
+			return count, err
+		}
+
+		err = encoder.Encode(backupLine{User: toBackupUser(user)})
+		if err != nil {
+			return count, fmt.Errorf("error writing backup: %w", err)
+		}
+
+		count++
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		return count, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	// the trailer is not part of its own checksum
+	trailer := backupTrailer{Users: count, SHA256: hex.EncodeToString(sum.Sum(nil))}
+
+	err = json.NewEncoder(zw).Encode(backupLine{Trailer: &trailer})
+	if err != nil {
+		return count, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return count, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	return count, nil
+}
+
+// VerifyBackup reads the backup to its end and checks it is complete and unchanged, before anything is restored from it
+func VerifyBackup(r io.Reader) (info BackupInfo, err error) {
+	return scanBackup(r, func(domain.User) bool { return true })
+}
+
+// ReadBackup streams the users of the backup, a backup that turns out to be damaged ends with an error
+func ReadBackup(r io.Reader) iter.Seq2[domain.User, error] {
+	return func(yield func(domain.User, error) bool) {
+		stopped := false
+
+		_, err := scanBackup(r, func(user domain.User) bool {
+			stopped = !yield(user, nil)
+
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(domain.User{}, err)
+		}
+	}
+}
+
+// scanBackup hands the users of the backup to yield until it returns false, and checks the trailer once all are read
+func scanBackup(r io.Reader, yield func(domain.User) bool) (info BackupInfo, err error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return info, fmt.Errorf("error reading backup: %w", err)
+	}
+
+	defer zr.Close()
+
+	scanner := backupScanner{reader: bufio.NewReader(zr), sum: sha256.New()}
+
+	line, err := scanner.next()
+	if err != nil {
+		return info, err
+	}
+
+	if line.Header == nil || line.Header.Format != backupFormat {
+		return info, errors.New("error reading backup: not a backup")
+	}
+
+	if line.Header.Version != backupVersion {
+		return info, fmt.Errorf("error reading backup: unknown version %d", line.Header.Version)
+	}
+
+	info = BackupInfo{CreatedAt: line.Header.CreatedAt, Storage: line.Header.Storage, Tenant: line.Header.Tenant}
+
+	for {
+		sum := hex.EncodeToString(scanner.sum.Sum(nil))
+
+		line, err = scanner.next()
+		if err != nil {
+			return info, err
+		}
+
+		if line.Trailer != nil {
+			if line.Trailer.Users != info.Users || line.Trailer.SHA256 != sum {
+				return info, errors.New("error reading backup: checksum mismatch")
+			}
+
+			return info, scanner.end()
+		}
+
+		if line.User == nil {
+			return info, fmt.Errorf("error reading backup: unexpected line %d", scanner.line)
+		}
+
+		info.Users++
+
+		if !yield(line.User.user()) {
+			return info, nil
+		}
+	}
+}
+
+type backupScanner struct {
+	reader *bufio.Reader
+	sum    hash.Hash
+	line   int
+}
+
+// next reads a line, adding it to the checksum
+func (s *backupScanner) next() (line backupLine, err error) {
+	data, err := s.reader.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return line, errors.New("error reading backup: truncated")
+	}
+
+	if err != nil {
+		return line, fmt.Errorf("error reading backup: %w", err)
+	}
+
+	s.line++
+	s.sum.Write(data)
+
+	err = json.Unmarshal(data, &line)
+	if err != nil {
+		return line, fmt.Errorf("error reading backup line %d: %w", s.line, err)
+	}
+
+	return line, nil
+}
+
+// end makes sure nothing follows the trailer
+func (s *backupScanner) end() error {
+	_, err := s.reader.ReadByte()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error reading backup: %w", err)
+	}
+
+	return errors.New("error reading backup: data after the trailer")
+}
+
+func toBackupUser(user domain.User) *backupUser {
+	backup := &backupUser{ID: user.ID, Name: user.Name, Email: user.Email}
+
+	if !user.ExpiresAt.IsZero() {
+		backup.ExpiresAt = &user.ExpiresAt
+	}
+
+	return backup
+}
+
+func (u backupUser) user() domain.User {
+	user := domain.User{ID: u.ID, Name: u.Name, Email: u.Email}
+
+	if u.ExpiresAt != nil {
+		user.ExpiresAt = u.ExpiresAt.UTC()
+	}
+
+	return user
+}
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	users := []domain.User{
+		{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()},
+		{ID: uuid.New(), Name: "名前\n" + strings.Repeat("x", 100_000)},
+		{ID: uuid.New(), Name: gofakeit.Username(), ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)},
+	}
+
+	var backup bytes.Buffer
+
+	count, err := WriteBackup(&backup, exportedUsers(users, nil), "bolt", "acme")
+	require.NoError(t, err)
+	require.Equal(t, len(users), count)
+
+	// rewrite changes the uncompressed content of the backup and compresses it again
+	rewrite := func(t *testing.T, change func(content string) string) io.Reader {
+		zr, err := gzip.NewReader(bytes.NewReader(backup.Bytes()))
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		var changed bytes.Buffer
+
+		zw := gzip.NewWriter(&changed)
+		_, err = zw.Write([]byte(change(string(content))))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		return &changed
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		info, err := VerifyBackup(bytes.NewReader(backup.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, len(users), info.Users)
+		require.Equal(t, "bolt", info.Storage)
+		require.Equal(t, "acme", info.Tenant)
+
+		var read []domain.User
+
+		for user, err := range ReadBackup(bytes.NewReader(backup.Bytes())) {
+			require.NoError(t, err)
+
+			read = append(read, user)
+		}
+
+		require.Equal(t, users, read)
+	})
+
+	t.Run("changed user", func(t *testing.T) {
+		_, err := VerifyBackup(rewrite(t, func(content string) string {
+			return strings.Replace(content, users[0].Name, users[0].Name+"x", 1)
+		}))
+		require.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("missing user", func(t *testing.T) {
+		_, err := VerifyBackup(rewrite(t, func(content string) string {
+			lines := strings.SplitAfter(content, "\n")
+
+			return strings.Join(append(lines[:1], lines[2:]...), "")
+		}))
+		require.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := VerifyBackup(bytes.NewReader(backup.Bytes()[:backup.Len()/2]))
+		require.Error(t, err)
+
+		_, err = VerifyBackup(rewrite(t, func(content string) string {
+			return content[:strings.LastIndex(content[:len(content)-1], "\n")+1]
+		}))
+		require.ErrorContains(t, err, "truncated")
+	})
+
+	t.Run("not a backup", func(t *testing.T) {
+		_, err := VerifyBackup(strings.NewReader("id,name\n"))
+		require.Error(t, err)
+
+		_, err = VerifyBackup(rewrite(t, func(string) string {
+			return `{"header":{"format":"other"}}` + "\n"
+		}))
+		require.ErrorContains(t, err, "not a backup")
+	})
+
+	t.Run("error while backing up", func(t *testing.T) {
+		_, err := WriteBackup(io.Discard, exportedUsers(users[:1], errors.New("some error")), "redis", "")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,119 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxBatchSize = 1000
+
+func (h HTTPServer) BatchUsers(ctx echo.Context) error {
+	var batchRequest BatchRequest
+
+	err := ctx.Bind(&batchRequest)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if len(batchRequest.Operations) > maxBatchSize {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("batch holds more than %d operations", maxBatchSize))
+	}
+
+	atomic := batchRequest.Mode == nil || *batchRequest.Mode == Atomic
+
+	operations := make([]domain.BatchOperation, 0, len(batchRequest.Operations))
+	for _, operation := range batchRequest.Operations {
+		converted, err := fromBatchOperation(operation)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		operations = append(operations, converted)
+	}
+
+	results, err := h.app.BatchUsers(ctx.Request().Context(), operations, atomic)
+	if err != nil {
+		return serverError(ctx, err)
+	}
+
+	response := BatchResponse{
+		Applied: true,
+		Results: make([]BatchResult, 0, len(results)),
+	}
+
+	for _, result := range results {
+		if atomic && result.Err != nil {
+			response.Applied = false
+		}
+
+		response.Results = append(response.Results, toBatchResult(result))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func fromBatchOperation(operation BatchOperation) (domain.BatchOperation, error) {
+	result := domain.BatchOperation{
+		Op: domain.BatchOp(operation.Op),
+	}
+
+	if operation.Id != nil {
+		result.ID = *operation.Id
+	}
+
+	if operation.Name != nil {
+		result.Name = *operation.Name
+	}
+
+	result.Email = fromEmail(operation.Email)
+
+	expiresAt, err := updateExpiry(operation.ExpiresAt, nil, operation.ClearExpiry)
+	if err != nil {
+		return result, fmt.Errorf("operation %s: %w", operation.Op, err)
+	}
+
+	result.ExpiresAt = expiresAt
+
+	return result, nil
+}
+
+func toBatchResult(result domain.BatchResult) BatchResult {
+	response := BatchResult{
+		Status: batchStatus(result.Err),
+	}
+
+	if result.ID != uuid.Nil {
+		response.Id = &result.ID
+	}
+
+	if result.Err != nil {
+		message := result.Err.Error()
+		response.Error = &message
+	}
+
+	return response
+}
+
+// batchStatus maps the outcome of a single operation to the status it would get as a request of its own
+func batchStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, domain.ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrorInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrorConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrorAborted):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,116 @@
+package driver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	apiBatch = "/api/user:batch"
+)
+
+func (s *HttpServerTestSuite) TestBatchUsers() {
+	id := uuid.New()
+	name := gofakeit.Username()
+	mode := BestEffort
+
+	s.Run("best effort", func() {
+		operations := []domain.BatchOperation{
+			{Op: domain.BatchCreate, Name: name},
+			{Op: domain.BatchDelete, ID: id},
+		}
+		s.app.On("BatchUsers", mock.Anything, operations, false).Return([]domain.BatchResult{
+			{ID: id},
+			{ID: id, Err: domain.ErrorNotFound},
+		}, nil).Once()
+		response := s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Mode: &mode, Operations: []BatchOperation{
+				{Op: Create, Name: &name},
+				{Op: Delete, Id: &id},
+			}}).
+			Expect().
+			Status(http.StatusOK).JSON().Object()
+		response.HasValue("applied", true)
+		results := response.Value("results").Array()
+		results.Element(0).Object().HasValue("status", http.StatusOK).HasValue("id", id)
+		results.Element(1).Object().HasValue("status", http.StatusNotFound)
+	})
+
+	s.Run("atomic batch is rejected", func() {
+		s.app.On("BatchUsers", mock.Anything, mock.Anything, true).Return([]domain.BatchResult{
+			{ID: id, Err: domain.ErrorAborted},
+			{Err: domain.ErrorInvalidInput},
+		}, nil).Once()
+		response := s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Operations: []BatchOperation{
+				{Op: Update, Id: &id, Name: &name},
+				{Op: Update, Name: &name},
+			}}).
+			Expect().
+			Status(http.StatusOK).JSON().Object()
+		response.HasValue("applied", false)
+		results := response.Value("results").Array()
+		results.Element(0).Object().HasValue("status", http.StatusFailedDependency)
+		results.Element(1).Object().HasValue("status", http.StatusBadRequest).NotContainsKey("id")
+	})
+
+	s.Run("update without expiry keeps the one the user has", func() {
+		clearExpiry := true
+		operations := []domain.BatchOperation{
+			{Op: domain.BatchUpdate, ID: id, Name: name},
+			{Op: domain.BatchUpdate, ID: id, Name: name, ExpiresAt: &time.Time{}},
+		}
+		s.app.On("BatchUsers", mock.Anything, operations, true).Return([]domain.BatchResult{{ID: id}, {ID: id}}, nil).Once()
+		s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Operations: []BatchOperation{
+				{Op: Update, Id: &id, Name: &name},
+				{Op: Update, Id: &id, Name: &name, ClearExpiry: &clearExpiry},
+			}}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().HasValue("applied", true)
+	})
+
+	s.Run("expiry cleared and set at once", func() {
+		clearExpiry := true
+		expiresAt := time.Now().Add(time.Hour)
+
+		s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Operations: []BatchOperation{
+				{Op: Update, Id: &id, Name: &name, ExpiresAt: &expiresAt, ClearExpiry: &clearExpiry},
+			}}).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("too many operations", func() {
+		operations := make([]BatchOperation, maxBatchSize+1)
+		for i := range operations {
+			operations[i] = BatchOperation{Op: Delete, Id: &id}
+		}
+
+		s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Operations: operations}).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("error in app", func() {
+		s.app.On("BatchUsers", mock.Anything, mock.Anything, true).Return(nil, fakeError).Once()
+		s.tester.POST(apiBatch).
+			WithJSON(BatchRequest{Operations: []BatchOperation{{Op: Delete, Id: &id}}}).
+			Expect().
+			Status(http.StatusInternalServerError)
+	})
+
+	s.Run("colon is not a path parameter", func() {
+		s.tester.POST("/api/userbatch").
+			Expect().
+			Status(http.StatusNotFound)
+	})
+}
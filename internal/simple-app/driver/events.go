@@ -0,0 +1,174 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const mimeEventStream = "text/event-stream"
+
+// streams keeps track of the long-lived connections, which http.Server.Shutdown neither ends nor waits for
+type streams struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closed  bool
+	closing chan struct{}
+}
+
+func newStreams() *streams {
+	return &streams{
+		closing: make(chan struct{}),
+	}
+}
+
+// open returns a context that is cancelled when either the request ends or shutdown begins,
+// done has to be called once the stream is finished
+func (s *streams) open(parent context.Context) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		cancel()
+
+		return ctx, cancel
+	}
+
+	s.wg.Add(1)
+
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		s.wg.Done()
+	}
+}
+
+func (s *streams) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	s.mu.Unlock()
+
+	finished := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for streams to finish: %w", ctx.Err())
+	}
+}
+
+func (h HTTPServer) StreamUserEvents(ctx echo.Context, params StreamUserEventsParams) error {
+	var lastEventID string
+	if params.LastEventID != nil {
+		lastEventID = *params.LastEventID
+	}
+
+	streamCtx, done := h.streams.open(ctx.Request().Context())
+	defer done()
+
+	events, err := h.events.Subscribe(streamCtx, lastEventID)
+	if err != nil {
+		if errors.Is(err, domain.ErrorInvalidInput) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, mimeEventStream)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	// stops nginx from buffering the stream
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-streamCtx.Done():
+			return nil
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(resp, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			err = writeUserEvent(resp, event)
+		}
+
+		if err != nil {
+			// the client is gone, there is nobody to report the error to
+			return nil //nolint:nilerr
+		}
+
+		resp.Flush()
+	}
+}
+
+func toUserEvent(event domain.Event) (userEvent UserEvent, err error) {
+	userID, err := uuid.Parse(event.UserID)
+	if err != nil {
+		return userEvent, fmt.Errorf("error parsing user id of event %s: %w", event.ID, err)
+	}
+
+	userEvent = UserEvent{
+		Id:         event.ID,
+		OccurredAt: event.OccurredAt,
+		Type:       EventType(event.Type),
+		UserId:     userID,
+	}
+
+	if event.Name != "" {
+		userEvent.Name = &event.Name
+	}
+
+	return userEvent, nil
+}
+
+func writeUserEvent(resp *echo.Response, event domain.StreamEvent) error {
+	userEvent, err := toUserEvent(event.Event)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(userEvent)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	_, err = fmt.Fprintf(resp, "id: %s\nevent: %s\ndata: %s\n\n", event.StreamID, event.Event.Type, data)
+
+	return err
+}
@@ -0,0 +1,132 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	apiUserEvents = "/api/user/events"
+)
+
+func (s *HttpServerTestSuite) openEventStream(lastEventID string) (*http.Response, *bufio.Reader, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+apiUserEvents, http.NoBody)
+	s.Require().NoError(err)
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+
+	return resp, bufio.NewReader(resp.Body), cancel
+}
+
+// readFrame reads one server-sent event frame up to its blank line
+func (s *HttpServerTestSuite) readFrame(reader *bufio.Reader) string {
+	var frame strings.Builder
+
+	for {
+		line, err := reader.ReadString('\n')
+		s.Require().NoError(err)
+
+		if line == "\n" {
+			return frame.String()
+		}
+
+		frame.WriteString(line)
+	}
+}
+
+func (s *HttpServerTestSuite) TestStreamUserEvents() {
+	event := domain.StreamEvent{
+		StreamID: "1700000000000-0",
+		Event:    domain.NewEvent(context.Background(), domain.EventUserCreated, gofakeit.UUID(), gofakeit.Username()),
+	}
+
+	s.Run("happy case", func() {
+		events := make(chan domain.StreamEvent, 1)
+		events <- event
+
+		s.events.On("Subscribe", mock.Anything, "").Return((<-chan domain.StreamEvent)(events), nil).Once()
+
+		resp, reader, cancel := s.openEventStream("")
+		defer cancel()
+		defer resp.Body.Close()
+
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal(mimeEventStream, resp.Header.Get(echo.HeaderContentType))
+
+		frame := s.readFrame(reader)
+		s.Contains(frame, "id: "+event.StreamID+"\n")
+		s.Contains(frame, "event: user.created\n")
+		s.Contains(frame, `"user_id":"`+event.Event.UserID+`"`)
+		s.Contains(frame, `"name":"`+event.Event.Name+`"`)
+
+		s.Equal(": heartbeat\n", s.readFrame(reader))
+	})
+
+	s.Run("resume after last event id", func() {
+		events := make(chan domain.StreamEvent)
+		close(events)
+
+		s.events.On("Subscribe", mock.Anything, event.StreamID).Return((<-chan domain.StreamEvent)(events), nil).Once()
+
+		resp, _, cancel := s.openEventStream(event.StreamID)
+		defer cancel()
+		defer resp.Body.Close()
+
+		s.Equal(http.StatusOK, resp.StatusCode)
+	})
+
+	s.Run("malformed last event id", func() {
+		s.events.On("Subscribe", mock.Anything, "nope").Return(nil, domain.ErrorInvalidInput).Once()
+		s.tester.GET(apiUserEvents).
+			WithHeader("Last-Event-ID", "nope").
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("error in subscriber", func() {
+		s.events.On("Subscribe", mock.Anything, "").Return(nil, fakeError).Once()
+		s.tester.GET(apiUserEvents).
+			Expect().
+			Status(http.StatusInternalServerError).JSON().Object().ValueEqual("message", fakeError.Error())
+	})
+}
+
+func (s *HttpServerTestSuite) TestStreamUserEventsShutdown() {
+	events := mocks.NewEventSubscriber(s.T())
+	server := NewHTTPServer(testConfig, s.app, s.webhooks, s.tenants, events, s.newGraphQL(), s.readiness)
+	e := echo.New()
+	RegisterHandlers(NewRouter(e), server)
+
+	ts := httptest.NewServer(e)
+
+	events.On("Subscribe", mock.Anything, "").Return((<-chan domain.StreamEvent)(make(chan domain.StreamEvent)), nil).Once()
+
+	resp, err := http.Get(ts.URL + apiUserEvents) //nolint:noctx
+	s.Require().NoError(err)
+
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.Require().NoError(server.ShutdownStreams(ctx))
+	s.Require().NoError(ts.Config.Shutdown(ctx))
+}
@@ -0,0 +1,520 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+)
+
+// error codes reported in the extensions of GraphQL errors
+const (
+	codeParseFailed      = "GRAPHQL_PARSE_FAILED"
+	codeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	codeQueryTooDeep     = "QUERY_TOO_DEEP"
+	codeQueryTooComplex  = "QUERY_TOO_COMPLEX"
+	codeBadUserInput     = "BAD_USER_INPUT"
+	codeNotFound         = "NOT_FOUND"
+	codeConflict         = "CONFLICT"
+	codeUnavailable      = "SERVICE_UNAVAILABLE"
+	codeInternal         = "INTERNAL_SERVER_ERROR"
+)
+
+// GraphQL serves queries and mutations over the users against the application layer
+type GraphQL struct {
+	app    domain.ApplicationInterface
+	cfg    config.GraphQLConfig
+	schema graphql.Schema
+}
+
+func NewGraphQL(cfg *config.Config, app domain.ApplicationInterface) (*GraphQL, error) {
+	g := &GraphQL{
+		app: app,
+		cfg: cfg.GraphQL,
+	}
+
+	schema, err := g.newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("error building graphql schema: %w", err)
+	}
+
+	g.schema = schema
+
+	return g, nil
+}
+
+func (h HTTPServer) Graphql(ctx echo.Context) error {
+	var request GraphQLRequest
+
+	err := ctx.Bind(&request)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, h.graphql.Execute(ctx.Request().Context(), request))
+}
+
+// Execute parses and validates the request and runs it unless it exceeds the depth or complexity limit
+func (g *GraphQL) Execute(ctx context.Context, request GraphQLRequest) *graphql.Result {
+	var variables map[string]any
+	if request.Variables != nil {
+		variables = *request.Variables
+	}
+
+	var operationName string
+	if request.OperationName != nil {
+		operationName = *request.OperationName
+	}
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(request.Query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: withCode(gqlerrors.FormatErrors(err), codeParseFailed)}
+	}
+
+	validation := graphql.ValidateDocument(&g.schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: withCode(validation.Errors, codeValidationFailed)}
+	}
+
+	if limitErr := g.checkLimits(document, variables); limitErr != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*limitErr}}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        g.schema,
+		AST:           document,
+		OperationName: operationName,
+		Args:          variables,
+		Context:       ctx,
+	})
+}
+
+type graphqlUser struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Email     *string    `json:"email"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	TTL       *int64     `json:"ttl"`
+}
+
+type graphqlUserPage struct {
+	Items      []graphqlUser `json:"items"`
+	NextCursor *string       `json:"nextCursor"`
+}
+
+func (g *GraphQL) newSchema() (graphql.Schema, error) {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"email": &graphql.Field{Type: graphql.String},
+			// null for users that do not expire
+			"expiresAt": &graphql.Field{Type: graphql.DateTime},
+			"ttl":       &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	userPageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserPage",
+		Fields: graphql.Fields{
+			"items":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type:    userType,
+				Args:    idArgs,
+				Resolve: g.resolveUser,
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewNonNull(userPageType),
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: g.resolveUsers,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"name":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"email":     &graphql.ArgumentConfig{Type: graphql.String},
+					"expiresAt": &graphql.ArgumentConfig{Type: graphql.DateTime},
+					"ttl":       &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: g.resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"name":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"email":     &graphql.ArgumentConfig{Type: graphql.String},
+					"expiresAt": &graphql.ArgumentConfig{Type: graphql.DateTime},
+					"ttl":       &graphql.ArgumentConfig{Type: graphql.Int},
+					// the user keeps the expiry it has unless expiresAt, ttl or clearExpiry is given
+					"clearExpiry": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				},
+				Resolve: g.resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Boolean),
+				Args:    idArgs,
+				Resolve: g.resolveDeleteUser,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+func (g *GraphQL) resolveUser(p graphql.ResolveParams) (any, error) {
+	id, err := graphqlID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := g.app.GetUser(p.Context, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return nil, nil
+		}
+
+		return nil, toGraphQLError(err)
+	}
+
+	return toGraphQLUser(user), nil
+}
+
+func (g *GraphQL) resolveUsers(p graphql.ResolveParams) (any, error) {
+	first, _ := p.Args["first"].(int)
+	if first <= 0 {
+		return nil, graphqlError{message: "first must be positive", code: codeBadUserInput}
+	}
+
+	after, _ := p.Args["after"].(string)
+
+	users, next, err := g.app.ListUsers(p.Context, after, min(first, maxPageSize))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	page := graphqlUserPage{
+		Items: make([]graphqlUser, 0, len(users)),
+	}
+
+	if next != "" {
+		page.NextCursor = &next
+	}
+
+	for _, user := range users {
+		page.Items = append(page.Items, toGraphQLUser(user))
+	}
+
+	return page, nil
+}
+
+func (g *GraphQL) resolveCreateUser(p graphql.ResolveParams) (any, error) {
+	expiresAt, err := graphqlExpiry(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	user := domain.User{}
+	user.Name, _ = p.Args["name"].(string)
+	user.Email, _ = p.Args["email"].(string)
+
+	if expiresAt != nil {
+		user.ExpiresAt = *expiresAt
+	}
+
+	user.ID, err = g.app.CreateUser(p.Context, user.Name, user.Email, user.ExpiresAt)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return toGraphQLUser(user), nil
+}
+
+func (g *GraphQL) resolveUpdateUser(p graphql.ResolveParams) (any, error) {
+	id, err := graphqlID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := graphqlExpiry(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if clearExpiry, _ := p.Args["clearExpiry"].(bool); clearExpiry {
+		if expiresAt != nil {
+			return nil, graphqlError{message: "clearExpiry must not be given together with expiresAt or ttl", code: codeBadUserInput}
+		}
+
+		expiresAt = &time.Time{}
+	}
+
+	name, _ := p.Args["name"].(string)
+	email, _ := p.Args["email"].(string)
+
+	user, err := g.app.UpdateUser(p.Context, id, name, email, expiresAt)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return toGraphQLUser(user), nil
+}
+
+// graphqlExpiry is nil when neither expiresAt nor ttl is given
+func graphqlExpiry(args map[string]any) (*time.Time, error) {
+	var (
+		expiresAt *time.Time
+		ttl       *int64
+	)
+
+	if at, ok := args["expiresAt"].(time.Time); ok {
+		expiresAt = &at
+	}
+
+	if seconds, ok := args["ttl"].(int); ok {
+		converted := int64(seconds)
+		ttl = &converted
+	}
+
+	expiry, err := toExpiry(expiresAt, ttl)
+	if err != nil {
+		return nil, graphqlError{message: err.Error(), code: codeBadUserInput}
+	}
+
+	return expiry, nil
+}
+
+func toGraphQLUser(user domain.User) graphqlUser {
+	result := graphqlUser{
+		ID:   user.ID.String(),
+		Name: user.Name,
+	}
+
+	if user.Email != "" {
+		result.Email = &user.Email
+	}
+
+	if !user.ExpiresAt.IsZero() {
+		ttl := ttlOf(user.ExpiresAt)
+		result.ExpiresAt = &user.ExpiresAt
+		result.TTL = &ttl
+	}
+
+	return result
+}
+
+func (g *GraphQL) resolveDeleteUser(p graphql.ResolveParams) (any, error) {
+	id, err := graphqlID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.app.DeleteUser(p.Context, id)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return true, nil
+}
+
+func graphqlID(arg any) (uuid.UUID, error) {
+	raw, _ := arg.(string)
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, graphqlError{message: fmt.Sprintf("malformed id %q", raw), code: codeBadUserInput}
+	}
+
+	return id, nil
+}
+
+// graphqlError carries its code to the extensions of the error in the response
+type graphqlError struct {
+	message string
+	code    string
+}
+
+func (e graphqlError) Error() string {
+	return e.message
+}
+
+func (e graphqlError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// toGraphQLError maps domain errors to error codes
+func toGraphQLError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrorNotFound):
+		return graphqlError{message: err.Error(), code: codeNotFound}
+	case errors.Is(err, domain.ErrorInvalidInput):
+		return graphqlError{message: err.Error(), code: codeBadUserInput}
+	case errors.Is(err, domain.ErrorConflict):
+		return graphqlError{message: err.Error(), code: codeConflict}
+	case errors.Is(err, domain.ErrorUnavailable):
+		return graphqlError{message: err.Error(), code: codeUnavailable}
+	default:
+		return graphqlError{message: err.Error(), code: codeInternal}
+	}
+}
+
+func withCode(errs []gqlerrors.FormattedError, code string) []gqlerrors.FormattedError {
+	for i := range errs {
+		errs[i].Extensions = map[string]any{"code": code}
+	}
+
+	return errs
+}
+
+// checkLimits measures every operation of the document before anything is resolved
+func (g *GraphQL) checkLimits(document *ast.Document, variables map[string]any) *gqlerrors.FormattedError {
+	cost := queryCost{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			cost.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		depth, complexity := cost.measure(operation.SelectionSet)
+
+		if depth > g.cfg.MaxDepth {
+			err := gqlerrors.NewFormattedError(fmt.Sprintf("query depth %d exceeds the limit of %d", depth, g.cfg.MaxDepth))
+			err.Extensions = map[string]any{"code": codeQueryTooDeep, "depth": depth, "maxDepth": g.cfg.MaxDepth}
+
+			return &err
+		}
+
+		if complexity > g.cfg.MaxComplexity {
+			err := gqlerrors.NewFormattedError(fmt.Sprintf("query complexity %d exceeds the limit of %d",
+				complexity, g.cfg.MaxComplexity))
+			err.Extensions = map[string]any{
+				"code":          codeQueryTooComplex,
+				"complexity":    complexity,
+				"maxComplexity": g.cfg.MaxComplexity,
+			}
+
+			return &err
+		}
+	}
+
+	return nil
+}
+
+// queryCost counts every field once and the fields below a list as often as the list may be long.
+// Introspection fields count as well, types nest through ofType as deep as a query asks.
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+func (c queryCost) measure(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var childDepth, childComplexity int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childDepth, childComplexity = c.measure(selection.SelectionSet)
+			childDepth++
+			childComplexity = 1 + c.multiplier(selection)*childComplexity
+		case *ast.InlineFragment:
+			childDepth, childComplexity = c.measure(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			// fragment cycles are rejected by validation already
+			if fragment, ok := c.fragments[selection.Name.Value]; ok {
+				childDepth, childComplexity = c.measure(fragment.SelectionSet)
+			}
+		}
+
+		depth = max(depth, childDepth)
+		complexity += childComplexity
+	}
+
+	return depth, complexity
+}
+
+// multiplier is the page size of a paginated field, taken from its first argument
+func (c queryCost) multiplier(field *ast.Field) int {
+	if field.Name.Value != "users" {
+		return 1
+	}
+
+	first := defaultPageSize
+
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				first = n
+			}
+		case *ast.Variable:
+			switch n := c.variables[value.Name.Value].(type) {
+			case float64:
+				first = int(n)
+			case int:
+				first = n
+			}
+		}
+	}
+
+	return min(max(first, 1), maxPageSize)
+}
@@ -0,0 +1,217 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	apiGraphQL = "/graphql"
+)
+
+func (s *HttpServerTestSuite) TestGraphQLQueries() {
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	s.Run("user", func() {
+		email := gofakeit.Email()
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{ID: id, Name: name, Email: email}, nil).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `query($id: ID!) { user(id: $id) { id name email } }`, Variables: &map[string]any{"id": id}}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.user").Object().
+			ValueEqual("id", id).
+			ValueEqual("name", name).
+			ValueEqual("email", email)
+	})
+
+	s.Run("unknown user", func() {
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{}, domain.ErrorNotFound).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `{ user(id: "` + id.String() + `") { name } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.user").Null()
+	})
+
+	s.Run("malformed id", func() {
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `{ user(id: "42") { name } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.errors[0].extensions.code").Equal(codeBadUserInput)
+	})
+
+	s.Run("users", func() {
+		users := []domain.User{{ID: id, Name: name}}
+		s.app.On("ListUsers", mock.Anything, "5", 2).Return(users, "", nil).Once()
+		page := s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `{ users(first: 2, after: "5") { items { id name } nextCursor } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.users").Object()
+		page.Value("items").Array().Element(0).Object().ValueEqual("name", name)
+		page.Value("nextCursor").Null()
+	})
+
+	s.Run("error in app", func() {
+		s.app.On("ListUsers", mock.Anything, "", 1).Return(nil, "", fakeError).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `{ users(first: 1) { items { id } } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.errors[0].extensions.code").Equal(codeInternal)
+	})
+}
+
+func (s *HttpServerTestSuite) TestGraphQLMutations() {
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	s.Run("create user", func() {
+		s.app.On("CreateUser", mock.Anything, name, "", time.Time{}).Return(id, nil).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { createUser(name: "` + name + `") { id } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.createUser.id").Equal(id)
+	})
+
+	s.Run("create user with taken email", func() {
+		email := gofakeit.Email()
+		s.app.On("CreateUser", mock.Anything, name, email, time.Time{}).Return(uuid.Nil, domain.ErrorConflict).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { createUser(name: "` + name + `", email: "` + email + `") { id } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.errors[0].extensions.code").Equal(codeConflict)
+	})
+
+	s.Run("create user to expire", func() {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		s.app.On("CreateUser", mock.Anything, name, "", expiresAt).Return(id, nil).Once()
+		user := s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { createUser(name: "` + name + `", expiresAt: "` +
+				expiresAt.Format(time.RFC3339Nano) + `") { id expiresAt ttl } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.createUser").Object()
+		user.ValueEqual("expiresAt", expiresAt.Format(time.RFC3339Nano))
+		user.Value("ttl").Number().InRange(time.Hour.Seconds()-1, time.Hour.Seconds())
+	})
+
+	s.Run("create user with expiresAt and ttl", func() {
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { createUser(name: "` + name +
+				`", expiresAt: "2100-01-01T00:00:00Z", ttl: 60) { id } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.errors[0].extensions.code").Equal(codeBadUserInput)
+	})
+
+	s.Run("update user keeping the expiry", func() {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		s.app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).
+			Return(domain.User{ID: id, Name: name, ExpiresAt: expiresAt}, nil).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { updateUser(id: "` + id.String() + `", name: "` + name + `") { expiresAt } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.updateUser.expiresAt").Equal(expiresAt.Format(time.RFC3339Nano))
+	})
+
+	s.Run("update user to be kept for good", func() {
+		s.app.On("UpdateUser", mock.Anything, id, name, "", &time.Time{}).Return(domain.User{ID: id, Name: name}, nil).Once()
+		user := s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { updateUser(id: "` + id.String() + `", name: "` + name +
+				`", clearExpiry: true) { expiresAt ttl } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.updateUser").Object()
+		user.Value("expiresAt").Null()
+		user.Value("ttl").Null()
+	})
+
+	s.Run("update unknown user", func() {
+		s.app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).Return(domain.User{}, domain.ErrorNotFound).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { updateUser(id: "` + id.String() + `", name: "` + name + `") { id } }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.errors[0].extensions.code").Equal(codeNotFound)
+	})
+
+	s.Run("delete user", func() {
+		s.app.On("DeleteUser", mock.Anything, id).Return(nil).Once()
+		s.tester.POST(apiGraphQL).
+			WithJSON(GraphQLRequest{Query: `mutation { deleteUser(id: "` + id.String() + `") }`}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			Path("$.data.deleteUser").Equal(true)
+	})
+}
+
+func (s *HttpServerTestSuite) TestGraphQLLimits() {
+	graphql, err := NewGraphQL(&config.Config{
+		GraphQL: config.GraphQLConfig{
+			MaxDepth:      2,
+			MaxComplexity: 50,
+		},
+	}, s.app)
+	s.Require().NoError(err)
+
+	execute := func(request GraphQLRequest) []gqlerrors.FormattedError {
+		return graphql.Execute(context.Background(), request).Errors
+	}
+
+	s.Run("parse error", func() {
+		errs := execute(GraphQLRequest{Query: `{ user(`})
+		s.Require().Len(errs, 1)
+		s.Equal(codeParseFailed, errs[0].Extensions["code"])
+	})
+
+	s.Run("validation error", func() {
+		errs := execute(GraphQLRequest{Query: `{ user(id: "1") { phone } }`})
+		s.Require().NotEmpty(errs)
+		s.Equal(codeValidationFailed, errs[0].Extensions["code"])
+	})
+
+	s.Run("too deep", func() {
+		errs := execute(GraphQLRequest{Query: `{ users(first: 1) { items { ...name } } } fragment name on User { name }`})
+		s.Require().Len(errs, 1)
+		s.Equal(codeQueryTooDeep, errs[0].Extensions["code"])
+		s.Equal(3, errs[0].Extensions["depth"])
+	})
+
+	s.Run("too complex", func() {
+		errs := execute(GraphQLRequest{
+			Query:     `query($first: Int) { a: user(id: "1") { id } b: users(first: $first) { nextCursor } }`,
+			Variables: &map[string]any{"first": float64(50)},
+		})
+		s.Require().Len(errs, 1)
+		s.Equal(codeQueryTooComplex, errs[0].Extensions["code"])
+		s.Equal(1+1+1+50, errs[0].Extensions["complexity"])
+	})
+
+	s.Run("introspection", func() {
+		errs := execute(GraphQLRequest{Query: `{ __typename }`})
+		s.Empty(errs)
+	})
+
+	s.Run("introspection is limited", func() {
+		errs := execute(GraphQLRequest{Query: `{ __schema { queryType { fields { type { ofType { name } } } } } }`})
+		s.Require().Len(errs, 1)
+		s.Equal(codeQueryTooDeep, errs[0].Extensions["code"])
+		s.Equal(6, errs[0].Extensions["depth"])
+	})
+}
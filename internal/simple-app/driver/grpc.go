@@ -0,0 +1,217 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver/pb"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc -I ../../../api --go_out=../../.. --go_opt=module=github.com/adlandh/acorn-simple-app --go-grpc_out=../../.. --go-grpc_opt=module=github.com/adlandh/acorn-simple-app simple-app.proto
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type GRPCServer struct {
+	pb.UnimplementedUserServiceServer
+	app domain.ApplicationInterface
+}
+
+var _ pb.UserServiceServer = (*GRPCServer)(nil)
+
+func NewGRPCServer(app domain.ApplicationInterface) *GRPCServer {
+	return &GRPCServer{
+		app: app,
+	}
+}
+
+func (g GRPCServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := g.app.GetUser(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return toProtoUser(user), nil
+}
+
+func (g GRPCServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	expiresAt, err := fromProtoExpiry(req.GetExpiresAt(), req.Ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	user := domain.User{Name: req.GetName(), Email: req.GetEmail()}
+	if expiresAt != nil {
+		user.ExpiresAt = *expiresAt
+	}
+
+	user.ID, err = g.app.CreateUser(ctx, user.Name, user.Email, user.ExpiresAt)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return toProtoUser(user), nil
+}
+
+func (g GRPCServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := fromProtoExpiry(req.GetExpiresAt(), req.Ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetClearExpiry() {
+		if expiresAt != nil {
+			return nil, status.Error(codes.InvalidArgument, "clear_expiry must not be set together with expires_at or ttl")
+		}
+
+		expiresAt = &time.Time{}
+	}
+
+	user, err := g.app.UpdateUser(ctx, id, req.GetName(), req.GetEmail(), expiresAt)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return toProtoUser(user), nil
+}
+
+func (g GRPCServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.app.DeleteUser(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g GRPCServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	pageSize := int(req.GetPageSize())
+
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	users, next, err := g.app.ListUsers(ctx, req.GetPageToken(), pageSize)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListUsersResponse{
+		Users:         make([]*pb.User, 0, len(users)),
+		NextPageToken: next,
+	}
+
+	for _, user := range users {
+		resp.Users = append(resp.Users, toProtoUser(user))
+	}
+
+	return resp, nil
+}
+
+func toProtoUser(user domain.User) *pb.User {
+	result := &pb.User{Id: user.ID.String(), Name: user.Name, Email: user.Email}
+
+	if !user.ExpiresAt.IsZero() {
+		result.ExpiresAt = timestamppb.New(user.ExpiresAt)
+		result.Ttl = ttlOf(user.ExpiresAt)
+	}
+
+	return result
+}
+
+// fromProtoExpiry is nil when the request sets no expiry
+func fromProtoExpiry(expiresAt *timestamppb.Timestamp, ttl *int64) (*time.Time, error) {
+	var at *time.Time
+
+	if expiresAt != nil {
+		err := expiresAt.CheckValid()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "malformed expires_at: %v", err)
+		}
+
+		converted := expiresAt.AsTime()
+		at = &converted
+	}
+
+	expiry, err := toExpiry(at, ttl)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return expiry, nil
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "malformed id %q", id)
+	}
+
+	return parsed, nil
+}
+
+// toStatus maps domain errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrorNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrorInvalidInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrorQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, domain.ErrorConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrorUnavailable):
+		return unavailableStatus(err)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// unavailableStatus tells clients when to try again in the standard RetryInfo detail
+func unavailableStatus(err error) error {
+	st := status.New(codes.Unavailable, err.Error())
+
+	detailed, detailErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(domain.RetryAfter(err))})
+	if detailErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,194 @@
+package driver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver/pb"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newGRPCClient(t *testing.T, app domain.ApplicationInterface, opts ...grpc.ServerOption) pb.UserServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	pb.RegisterUserServiceServer(server, NewGRPCServer(app))
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return pb.NewUserServiceClient(conn)
+}
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	t.Helper()
+	require.Equal(t, code, status.Code(err), err)
+}
+
+func TestGRPCServer(t *testing.T) {
+	ctx := context.Background()
+	app := mocks.NewApplicationInterface(t)
+	client := newGRPCClient(t, app)
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	t.Run("get user", func(t *testing.T) {
+		email := gofakeit.Email()
+		app.On("GetUser", mock.Anything, id).Return(domain.User{ID: id, Name: name, Email: email}, nil).Once()
+		user, err := client.GetUser(ctx, &pb.GetUserRequest{Id: id.String()})
+		require.NoError(t, err)
+		require.Equal(t, name, user.GetName())
+		require.Equal(t, email, user.GetEmail())
+	})
+
+	t.Run("get unknown user", func(t *testing.T) {
+		app.On("GetUser", mock.Anything, id).Return(domain.User{}, domain.ErrorNotFound).Once()
+		_, err := client.GetUser(ctx, &pb.GetUserRequest{Id: id.String()})
+		requireCode(t, codes.NotFound, err)
+	})
+
+	t.Run("malformed id", func(t *testing.T) {
+		_, err := client.GetUser(ctx, &pb.GetUserRequest{Id: "42"})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		app.On("GetUser", mock.Anything, id).Return(domain.User{}, domain.UnavailableError{RetryAfter: time.Second}).Once()
+		_, err := client.GetUser(ctx, &pb.GetUserRequest{Id: id.String()})
+		requireCode(t, codes.Unavailable, err)
+
+		details := status.Convert(err).Details()
+		require.Len(t, details, 1)
+		require.Equal(t, time.Second, details[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration())
+	})
+
+	t.Run("create user", func(t *testing.T) {
+		app.On("CreateUser", mock.Anything, name, "", time.Time{}).Return(id, nil).Once()
+		user, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name})
+		require.NoError(t, err)
+		require.Equal(t, id.String(), user.GetId())
+	})
+
+	t.Run("create user with taken email", func(t *testing.T) {
+		email := gofakeit.Email()
+		app.On("CreateUser", mock.Anything, name, email, time.Time{}).Return(uuid.Nil, domain.ErrorConflict).Once()
+		_, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name, Email: email})
+		requireCode(t, codes.AlreadyExists, err)
+	})
+
+	t.Run("create user over quota", func(t *testing.T) {
+		app.On("CreateUser", mock.Anything, name, "", time.Time{}).Return(uuid.Nil, domain.ErrorQuotaExceeded).Once()
+		_, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name})
+		requireCode(t, codes.ResourceExhausted, err)
+	})
+
+	t.Run("error in app", func(t *testing.T) {
+		app.On("CreateUser", mock.Anything, name, "", time.Time{}).Return(uuid.Nil, fakeError).Once()
+		_, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name})
+		requireCode(t, codes.Internal, err)
+	})
+
+	t.Run("create user to expire", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		app.On("CreateUser", mock.Anything, name, "", expiresAt).Return(id, nil).Once()
+		user, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name, ExpiresAt: timestamppb.New(expiresAt)})
+		require.NoError(t, err)
+		require.Equal(t, expiresAt, user.GetExpiresAt().AsTime())
+		require.InDelta(t, time.Hour.Seconds(), user.GetTtl(), 1)
+	})
+
+	t.Run("create user with expires_at and ttl", func(t *testing.T) {
+		ttl := int64(60)
+		_, err := client.CreateUser(ctx, &pb.CreateUserRequest{Name: name, ExpiresAt: timestamppb.Now(), Ttl: &ttl})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("update user", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).
+			Return(domain.User{ID: id, Name: name, ExpiresAt: expiresAt}, nil).Once()
+		user, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{Id: id.String(), Name: name})
+		require.NoError(t, err)
+		require.Equal(t, name, user.GetName())
+		require.Equal(t, expiresAt, user.GetExpiresAt().AsTime())
+	})
+
+	t.Run("update user with ttl", func(t *testing.T) {
+		ttl := int64(60)
+		app.On("UpdateUser", mock.Anything, id, name, "", mock.MatchedBy(func(expiresAt *time.Time) bool {
+			return expiresAt != nil && time.Until(*expiresAt) > 58*time.Second
+		})).Return(domain.User{ID: id, Name: name, ExpiresAt: time.Now().Add(time.Minute)}, nil).Once()
+		user, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{Id: id.String(), Name: name, Ttl: &ttl})
+		require.NoError(t, err)
+		require.Positive(t, user.GetTtl())
+	})
+
+	t.Run("update user to be kept for good", func(t *testing.T) {
+		app.On("UpdateUser", mock.Anything, id, name, "", &time.Time{}).Return(domain.User{ID: id, Name: name}, nil).Once()
+		user, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{Id: id.String(), Name: name, ClearExpiry: true})
+		require.NoError(t, err)
+		require.Nil(t, user.GetExpiresAt())
+		require.Zero(t, user.GetTtl())
+	})
+
+	t.Run("update user clearing and setting the expiry", func(t *testing.T) {
+		_, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{
+			Id:          id.String(),
+			Name:        name,
+			ExpiresAt:   timestamppb.Now(),
+			ClearExpiry: true,
+		})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		app.On("DeleteUser", mock.Anything, id).Return(nil).Once()
+		_, err := client.DeleteUser(ctx, &pb.DeleteUserRequest{Id: id.String()})
+		require.NoError(t, err)
+	})
+
+	t.Run("list users", func(t *testing.T) {
+		users := []domain.User{{ID: id, Name: name}}
+		app.On("ListUsers", mock.Anything, "", defaultPageSize).Return(users, "7", nil).Once()
+		resp, err := client.ListUsers(ctx, &pb.ListUsersRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 1)
+		require.Equal(t, id.String(), resp.GetUsers()[0].GetId())
+		require.Equal(t, "7", resp.GetNextPageToken())
+	})
+
+	t.Run("list users with malformed page token", func(t *testing.T) {
+		app.On("ListUsers", mock.Anything, "nope", maxPageSize).Return(nil, "", domain.ErrorInvalidInput).Once()
+		_, err := client.ListUsers(ctx, &pb.ListUsersRequest{PageSize: 5000, PageToken: "nope"})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+}
@@ -2,30 +2,77 @@
 package driver
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
-//go:generate oapi-codegen -old-config-style -generate types,server -o "openapi_gen.go" -package "driver" "../../../api/simple-app.yaml"
+//go:generate oapi-codegen -old-config-style -generate types,server,skip-prune -o "openapi_gen.go" -package "driver" "../../../api/simple-app.yaml"
 type HTTPServer struct {
-	app domain.ApplicationInterface
+	app       domain.ApplicationInterface
+	webhooks  domain.WebhookApplicationInterface
+	tenants   domain.TenantApplicationInterface
+	events    domain.EventSubscriber
+	graphql   *GraphQL
+	readiness domain.Readiness
+	heartbeat time.Duration
+	watch     config.WebSocketConfig
+	upgrader  websocket.Upgrader
+	streams   *streams
 }
 
 var _ ServerInterface = (*HTTPServer)(nil)
 
-func NewHTTPServer(app domain.ApplicationInterface) *HTTPServer {
+func NewHTTPServer(
+	cfg *config.Config,
+	app domain.ApplicationInterface,
+	webhooks domain.WebhookApplicationInterface,
+	tenants domain.TenantApplicationInterface,
+	events domain.EventSubscriber,
+	graphql *GraphQL,
+	readiness domain.Readiness,
+) *HTTPServer {
 	return &HTTPServer{
-		app: app,
+		app:       app,
+		webhooks:  webhooks,
+		tenants:   tenants,
+		events:    events,
+		graphql:   graphql,
+		readiness: readiness,
+		heartbeat: cfg.Events.Heartbeat,
+		watch:     cfg.WebSocket,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: cfg.WebSocket.WriteTimeout,
+		},
+		streams: newStreams(),
 	}
 }
 
+// ShutdownStreams ends the event streams and websockets and waits for their handlers to return.
+// It has to run before the echo server is shut down, which would otherwise wait for the streams forever.
+func (h HTTPServer) ShutdownStreams(ctx context.Context) error {
+	return h.streams.shutdown(ctx)
+}
+
 func (h HTTPServer) HealthCheck(ctx echo.Context) error {
-	return ctx.String(http.StatusOK, "Ok")
+	select {
+	case <-h.readiness.Ready():
+		return ctx.String(http.StatusOK, "Ok")
+	default:
+		return ctx.String(http.StatusServiceUnavailable, "Not ready")
+	}
 }
 
 func (h HTTPServer) CreateUser(ctx echo.Context) error {
@@ -36,15 +83,62 @@ func (h HTTPServer) CreateUser(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	id, err := h.app.CreateUser(ctx.Request().Context(), userRequest.Name)
+	expiresAt, err := fromExpiry(userRequest)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	id, err := h.app.CreateUser(ctx.Request().Context(), userRequest.Name, fromEmail(userRequest.Email), expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrorInvalidInput):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrorConflict):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+
+		return serverError(ctx, err)
 	}
 
-	return ctx.JSON(http.StatusOK, User{
-		Id:   id,
-		Name: userRequest.Name,
-	})
+	return ctx.JSON(http.StatusOK, toUser(domain.User{
+		ID:        id,
+		Name:      userRequest.Name,
+		Email:     fromEmail(userRequest.Email),
+		ExpiresAt: expiresAt,
+	}))
+}
+
+func (h HTTPServer) SearchUsers(ctx echo.Context, params SearchUsersParams) error {
+	limit := defaultPageSize
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if limit > maxPageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must not exceed %d", maxPageSize))
+	}
+
+	query := domain.NameQuery{
+		Name:       params.Name,
+		Prefix:     params.Match != nil && *params.Match == Prefix,
+		IgnoreCase: params.IgnoreCase != nil && *params.IgnoreCase,
+	}
+
+	users, err := h.app.SearchUsers(ctx.Request().Context(), query, limit)
+	if err != nil {
+		if errors.Is(err, domain.ErrorInvalidInput) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return serverError(ctx, err)
+	}
+
+	response := make([]User, 0, len(users))
+	for _, user := range users {
+		response = append(response, toUser(user))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
 }
 
 func (h HTTPServer) DeleteUser(ctx echo.Context, id uuid.UUID) error {
@@ -54,26 +148,23 @@ func (h HTTPServer) DeleteUser(ctx echo.Context, id uuid.UUID) error {
 			return ctx.NoContent(http.StatusNotFound)
 		}
 
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return serverError(ctx, err)
 	}
 
 	return ctx.NoContent(http.StatusOK)
 }
 
 func (h HTTPServer) GetUser(ctx echo.Context, id uuid.UUID) error {
-	name, err := h.app.GetUser(ctx.Request().Context(), id)
+	user, err := h.app.GetUser(ctx.Request().Context(), id)
 	if err != nil {
 		if errors.Is(domain.ErrorNotFound, err) {
 			return ctx.NoContent(http.StatusNotFound)
 		}
 
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return serverError(ctx, err)
 	}
 
-	return ctx.JSON(http.StatusOK, User{
-		Id:   id,
-		Name: name,
-	})
+	return ctx.JSON(http.StatusOK, toUser(user))
 }
 
 func (h HTTPServer) UpdateUser(ctx echo.Context, id uuid.UUID) error {
@@ -84,18 +175,121 @@ func (h HTTPServer) UpdateUser(ctx echo.Context, id uuid.UUID) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	err = h.app.UpdateUser(ctx.Request().Context(), id, userRequest.Name)
+	expiresAt, err := updateExpiry(userRequest.ExpiresAt, userRequest.Ttl, userRequest.ClearExpiry)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.app.UpdateUser(ctx.Request().Context(), id, userRequest.Name, fromEmail(userRequest.Email), expiresAt)
 
 	if err != nil {
-		if errors.Is(domain.ErrorNotFound, err) {
+		switch {
+		case errors.Is(domain.ErrorNotFound, err):
 			return ctx.NoContent(http.StatusNotFound)
+		case errors.Is(err, domain.ErrorInvalidInput):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrorConflict):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
 		}
 
+		return serverError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, toUser(user))
+}
+
+// serverError answers 503 with Retry-After while the storage is unavailable, and 500 for anything else
+func serverError(ctx echo.Context, err error) error {
+	if !errors.Is(err, domain.ErrorUnavailable) {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	return ctx.JSON(http.StatusOK, User{
-		Id:   id,
-		Name: userRequest.Name,
-	})
+	// Retry-After counts whole seconds, rounding up keeps clients from coming back too early
+	seconds := max(int(math.Ceil(domain.RetryAfter(err).Seconds())), 1)
+	ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+}
+
+func toUser(user domain.User) User {
+	response := User{
+		Id:   user.ID,
+		Name: user.Name,
+	}
+
+	if user.Email != "" {
+		email := openapi_types.Email(user.Email)
+		response.Email = &email
+	}
+
+	if !user.ExpiresAt.IsZero() {
+		ttl := ttlOf(user.ExpiresAt)
+		response.ExpiresAt = &user.ExpiresAt
+		response.Ttl = &ttl
+	}
+
+	return response
+}
+
+func fromExpiry(request UserRequest) (time.Time, error) {
+	expiresAt, err := toExpiry(request.ExpiresAt, request.Ttl)
+	if err != nil || expiresAt == nil {
+		return time.Time{}, err
+	}
+
+	return *expiresAt, nil
+}
+
+// toExpiry takes the expiry either as a point in time or as seconds from now, cut to the milliseconds the storages keep,
+// it is nil when neither is set
+func toExpiry(expiresAt *time.Time, ttl *int64) (*time.Time, error) {
+	var expiry time.Time
+
+	switch {
+	case expiresAt != nil && ttl != nil:
+		return nil, errors.New("expires_at and ttl must not be set together")
+	case ttl != nil:
+		if *ttl < 1 {
+			return nil, errors.New("ttl must be positive")
+		}
+
+		expiry = time.Now().Add(time.Duration(*ttl) * time.Second)
+	case expiresAt != nil:
+		expiry = *expiresAt
+	default:
+		return nil, nil
+	}
+
+	expiry = expiry.UTC().Truncate(time.Millisecond)
+
+	return &expiry, nil
+}
+
+// updateExpiry is the expiry an update asks for, like over grpc and graphql an update without one keeps the expiry
+// the user has, nil, and clearExpiry keeps the user for good, a zero time
+func updateExpiry(expiresAt *time.Time, ttl *int64, clearExpiry *bool) (*time.Time, error) {
+	expiry, err := toExpiry(expiresAt, ttl)
+	if err != nil || clearExpiry == nil || !*clearExpiry {
+		return expiry, err
+	}
+
+	if expiry != nil {
+		return nil, errors.New("clear_expiry must not be set together with expires_at or ttl")
+	}
+
+	return &time.Time{}, nil
+}
+
+// ttlOf is the time left until the expiry in seconds, the user is still there,
+// so a second at least is left even if the clocks disagree
+func ttlOf(expiresAt time.Time) int64 {
+	return max(int64(math.Ceil(time.Until(expiresAt).Seconds())), 1)
+}
+
+func fromEmail(email *openapi_types.Email) string {
+	if email == nil {
+		return ""
+	}
+
+	return string(*email)
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
@@ -18,28 +19,60 @@ import (
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/gavv/httpexpect/v2"
 	"github.com/labstack/echo/v4"
+	openapi_types "github.com/oapi-codegen/runtime/types"
 	"github.com/phayes/freeport"
 	"github.com/stretchr/testify/suite"
 )
 
 var fakeError = errors.New("fake error")
 
+var testConfig = &config.Config{
+	Events: config.EventsConfig{
+		Heartbeat: 100 * time.Millisecond,
+	},
+	WebSocket: config.WebSocketConfig{
+		PingInterval:     time.Second,
+		PongTimeout:      2 * time.Second,
+		WriteTimeout:     time.Second,
+		Buffer:           4,
+		MaxSubscriptions: 2,
+		MaxMessageSize:   1024,
+	},
+	GraphQL: config.GraphQLConfig{
+		MaxDepth:      8,
+		MaxComplexity: 1000,
+	},
+	Tenant: config.TenantConfig{
+		AdminToken: testAdminToken,
+	},
+}
+
 const (
-	apiUser = "/api/user"
+	apiUser        = "/api/user"
+	testAdminToken = "admin-token"
 )
 
 type HttpServerTestSuite struct {
 	suite.Suite
-	e      *echo.Echo
-	tester *httpexpect.Expect
-	app    *mocks.ApplicationInterface
-	url    string
+	e         *echo.Echo
+	tester    *httpexpect.Expect
+	app       *mocks.ApplicationInterface
+	webhooks  *mocks.WebhookApplicationInterface
+	tenants   *mocks.TenantApplicationInterface
+	events    *mocks.EventSubscriber
+	readiness *mocks.Readiness
+	url       string
 }
 
 func (s *HttpServerTestSuite) SetupSuite() {
 	s.app = new(mocks.ApplicationInterface)
+	s.webhooks = new(mocks.WebhookApplicationInterface)
+	s.tenants = new(mocks.TenantApplicationInterface)
+	s.events = new(mocks.EventSubscriber)
+	s.readiness = new(mocks.Readiness)
 	s.e = echo.New()
-	RegisterHandlers(s.e, NewHTTPServer(s.app))
+	s.e.Use(AdminMiddleware(testConfig))
+	RegisterHandlers(NewRouter(s.e), NewHTTPServer(testConfig, s.app, s.webhooks, s.tenants, s.events, s.newGraphQL(), s.readiness))
 	port, err := freeport.GetFreePort()
 	s.Require().NoError(err)
 	go func() {
@@ -51,6 +84,13 @@ func (s *HttpServerTestSuite) SetupSuite() {
 	s.tester = httpexpect.Default(s.T(), s.url)
 }
 
+func (s *HttpServerTestSuite) newGraphQL() *GraphQL {
+	graphql, err := NewGraphQL(testConfig, s.app)
+	s.Require().NoError(err)
+
+	return graphql
+}
+
 func (s *HttpServerTestSuite) TearDownSuite() {
 	err := s.e.Shutdown(context.Background())
 	s.NoError(err)
@@ -58,13 +98,31 @@ func (s *HttpServerTestSuite) TearDownSuite() {
 
 func (s *HttpServerTestSuite) TearDownTest() {
 	s.app.AssertExpectations(s.T())
+	s.webhooks.AssertExpectations(s.T())
+	s.tenants.AssertExpectations(s.T())
+	s.events.AssertExpectations(s.T())
+	s.readiness.AssertExpectations(s.T())
 }
 
 func (s *HttpServerTestSuite) TestHealthCheck() {
-	s.tester.GET("/").WithHeader(echo.HeaderContentType, echo.MIMETextPlain).
-		Expect().
-		Status(http.StatusOK).
-		Text().Contains("Ok")
+	s.Run("ready", func() {
+		ready := make(chan struct{})
+		close(ready)
+
+		s.readiness.On("Ready").Return((<-chan struct{})(ready)).Once()
+		s.tester.GET("/").WithHeader(echo.HeaderContentType, echo.MIMETextPlain).
+			Expect().
+			Status(http.StatusOK).
+			Text().Contains("Ok")
+	})
+
+	s.Run("not ready", func() {
+		s.readiness.On("Ready").Return((<-chan struct{})(make(chan struct{}))).Once()
+		s.tester.GET("/").
+			Expect().
+			Status(http.StatusServiceUnavailable).
+			Text().Contains("Not ready")
+	})
 }
 
 func (s *HttpServerTestSuite) TestCreateUser() {
@@ -72,16 +130,64 @@ func (s *HttpServerTestSuite) TestCreateUser() {
 	s.Require().NoError(err)
 	name := gofakeit.Username()
 
+	email := openapi_types.Email(gofakeit.Email())
+
 	s.Run("happy case", func() {
-		s.app.On("CreateUser", mock.Anything, name).Return(id, nil).Once()
+		s.app.On("CreateUser", mock.Anything, name, string(email), time.Time{}).Return(id, nil).Once()
 		s.tester.POST(apiUser).
-			WithJSON(UserRequest{Name: name}).
+			WithJSON(UserRequest{Name: name, Email: &email}).
 			Expect().
-			Status(http.StatusOK).JSON().Object().HasValue("id", id).HasValue("name", name)
+			Status(http.StatusOK).JSON().Object().HasValue("id", id).HasValue("name", name).HasValue("email", email)
+	})
+
+	s.Run("email taken", func() {
+		s.app.On("CreateUser", mock.Anything, name, string(email), time.Time{}).Return(uuid.Nil, domain.ErrorConflict).Once()
+		s.tester.POST(apiUser).
+			WithJSON(UserRequest{Name: name, Email: &email}).
+			Expect().
+			Status(http.StatusConflict).JSON().Object().ContainsKey("message")
+	})
+
+	s.Run("with ttl", func() {
+		ttl := int64(60)
+		s.app.On("CreateUser", mock.Anything, name, "", mock.MatchedBy(func(expiresAt time.Time) bool {
+			return time.Until(expiresAt) > 59*time.Second && time.Until(expiresAt) <= time.Minute
+		})).Return(id, nil).Once()
+		s.tester.POST(apiUser).
+			WithJSON(UserRequest{Name: name, Ttl: &ttl}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().HasValue("ttl", ttl).ContainsKey("expires_at")
+	})
+
+	s.Run("with expires_at", func() {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		s.app.On("CreateUser", mock.Anything, name, "", expiresAt).Return(id, nil).Once()
+		s.tester.POST(apiUser).
+			WithJSON(UserRequest{Name: name, ExpiresAt: &expiresAt}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().HasValue("ttl", 3600)
+	})
+
+	s.Run("with expires_at and ttl", func() {
+		ttl := int64(60)
+		expiresAt := time.Now().Add(time.Hour)
+		s.tester.POST(apiUser).
+			WithJSON(UserRequest{Name: name, ExpiresAt: &expiresAt, Ttl: &ttl}).
+			Expect().
+			Status(http.StatusBadRequest).JSON().Object().ContainsKey("message")
+	})
+
+	s.Run("with expiry in the past", func() {
+		expiresAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+		s.app.On("CreateUser", mock.Anything, name, "", expiresAt).Return(uuid.Nil, domain.ErrorInvalidInput).Once()
+		s.tester.POST(apiUser).
+			WithJSON(UserRequest{Name: name, ExpiresAt: &expiresAt}).
+			Expect().
+			Status(http.StatusBadRequest)
 	})
 
 	s.Run("error in app", func() {
-		s.app.On("CreateUser", mock.Anything, name).Return(id, fakeError).Once()
+		s.app.On("CreateUser", mock.Anything, name, "", time.Time{}).Return(id, fakeError).Once()
 		s.tester.POST(apiUser).
 			WithJSON(UserRequest{Name: name}).
 			Expect().
@@ -95,10 +201,20 @@ func (s *HttpServerTestSuite) TestGetUser() {
 	name := gofakeit.Username()
 
 	s.Run("happy case", func() {
-		s.app.On("GetUser", mock.Anything, id).Return(name, nil).Once()
+		email := gofakeit.Email()
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{ID: id, Name: name, Email: email}, nil).Once()
 		s.tester.GET(apiUser+"/"+id.String()).
 			Expect().
-			Status(http.StatusOK).JSON().Object().HasValue("id", id).HasValue("name", name)
+			Status(http.StatusOK).JSON().Object().HasValue("id", id).HasValue("name", name).HasValue("email", email)
+	})
+
+	s.Run("expiring user", func() {
+		expiresAt := time.Now().Add(90 * time.Second).UTC().Truncate(time.Millisecond)
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{ID: id, Name: name, ExpiresAt: expiresAt}, nil).Once()
+		s.tester.GET(apiUser+"/"+id.String()).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			HasValue("expires_at", expiresAt.Format(time.RFC3339Nano)).HasValue("ttl", 90)
 	})
 
 	s.Run("invalid id", func() {
@@ -109,18 +225,73 @@ func (s *HttpServerTestSuite) TestGetUser() {
 	})
 
 	s.Run("not found", func() {
-		s.app.On("GetUser", mock.Anything, id).Return("", domain.ErrorNotFound).Once()
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{}, domain.ErrorNotFound).Once()
 		s.tester.GET(apiUser + "/" + id.String()).
 			Expect().
 			Status(http.StatusNotFound).NoContent()
 	})
 
 	s.Run("error in app", func() {
-		s.app.On("GetUser", mock.Anything, id).Return("", fakeError).Once()
+		s.app.On("GetUser", mock.Anything, id).Return(domain.User{}, fakeError).Once()
 		s.tester.GET(apiUser+"/"+id.String()).
 			Expect().
 			Status(http.StatusInternalServerError).JSON().Object().HasValue("message", fakeError.Error())
 	})
+
+	s.Run("storage unavailable", func() {
+		s.app.On("GetUser", mock.Anything, id).
+			Return(domain.User{}, domain.UnavailableError{RetryAfter: 1500 * time.Millisecond}).Once()
+		s.tester.GET(apiUser + "/" + id.String()).
+			Expect().
+			Status(http.StatusServiceUnavailable).Header(echo.HeaderRetryAfter).IsEqual("2")
+	})
+}
+
+func (s *HttpServerTestSuite) TestSearchUsers() {
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	s.Run("happy case", func() {
+		query := domain.NameQuery{Name: name, Prefix: true, IgnoreCase: true}
+		s.app.On("SearchUsers", mock.Anything, query, 5).Return([]domain.User{{ID: id, Name: name}}, nil).Once()
+		s.tester.GET(apiUser).
+			WithQuery("name", name).
+			WithQuery("match", Prefix).
+			WithQuery("ignore_case", true).
+			WithQuery("limit", 5).
+			Expect().
+			Status(http.StatusOK).JSON().Array().Element(0).Object().HasValue("id", id).HasValue("name", name)
+	})
+
+	s.Run("no match", func() {
+		s.app.On("SearchUsers", mock.Anything, domain.NameQuery{Name: name}, defaultPageSize).Return(nil, nil).Once()
+		s.tester.GET(apiUser).
+			WithQuery("name", name).
+			Expect().
+			Status(http.StatusOK).JSON().Array().Empty()
+	})
+
+	s.Run("missing name", func() {
+		s.tester.GET(apiUser).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("limit too large", func() {
+		s.tester.GET(apiUser).
+			WithQuery("name", name).
+			WithQuery("limit", maxPageSize+1).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("error in app", func() {
+		s.app.On("SearchUsers", mock.Anything, domain.NameQuery{Name: name}, defaultPageSize).Return(nil, fakeError).Once()
+		s.tester.GET(apiUser).
+			WithQuery("name", name).
+			Expect().
+			Status(http.StatusInternalServerError)
+	})
 }
 
 func (s *HttpServerTestSuite) TestUpdateUser() {
@@ -129,15 +300,44 @@ func (s *HttpServerTestSuite) TestUpdateUser() {
 	name := gofakeit.Username()
 
 	s.Run("happy case", func() {
-		s.app.On("UpdateUser", mock.Anything, id, name).Return(nil).Once()
+		// without an expiry the one the user has is kept
+		s.app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).Return(domain.User{ID: id, Name: name}, nil).Once()
 		s.tester.POST(apiUser+"/"+id.String()).
 			WithJSON(UserRequest{Name: name}).
 			Expect().
 			Status(http.StatusOK).JSON().Object().HasValue("id", id).HasValue("name", name)
 	})
 
+	s.Run("clear expiry", func() {
+		clearExpiry := true
+		s.app.On("UpdateUser", mock.Anything, id, name, "", &time.Time{}).Return(domain.User{ID: id, Name: name}, nil).Once()
+		s.tester.POST(apiUser+"/"+id.String()).
+			WithJSON(UserRequest{Name: name, ClearExpiry: &clearExpiry}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().NotContainsKey("expires_at")
+	})
+
+	s.Run("expiry cleared and set at once", func() {
+		clearExpiry := true
+		ttl := int64(60)
+		s.tester.POST(apiUser+"/"+id.String()).
+			WithJSON(UserRequest{Name: name, Ttl: &ttl, ClearExpiry: &clearExpiry}).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("email taken", func() {
+		email := openapi_types.Email(gofakeit.Email())
+		s.app.On("UpdateUser", mock.Anything, id, name, string(email), (*time.Time)(nil)).
+			Return(domain.User{}, domain.ErrorConflict).Once()
+		s.tester.POST(apiUser + "/" + id.String()).
+			WithJSON(UserRequest{Name: name, Email: &email}).
+			Expect().
+			Status(http.StatusConflict).JSON().Object().ContainsKey("message")
+	})
+
 	s.Run("not found", func() {
-		s.app.On("UpdateUser", mock.Anything, id, name).Return(domain.ErrorNotFound).Once()
+		s.app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).Return(domain.User{}, domain.ErrorNotFound).Once()
 		s.tester.POST(apiUser + "/" + id.String()).
 			WithJSON(UserRequest{Name: name}).
 			Expect().
@@ -145,7 +345,7 @@ func (s *HttpServerTestSuite) TestUpdateUser() {
 	})
 
 	s.Run("error in app", func() {
-		s.app.On("UpdateUser", mock.Anything, id, name).Return(fakeError).Once()
+		s.app.On("UpdateUser", mock.Anything, id, name, "", (*time.Time)(nil)).Return(domain.User{}, fakeError).Once()
 		s.tester.POST(apiUser+"/"+id.String()).
 			WithJSON(UserRequest{Name: name}).
 			Expect().
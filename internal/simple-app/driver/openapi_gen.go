@@ -6,21 +6,304 @@ package driver
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/oapi-codegen/runtime"
 	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
+// Defines values for BatchOperationOp.
+const (
+	Create BatchOperationOp = "create"
+	Delete BatchOperationOp = "delete"
+	Update BatchOperationOp = "update"
+)
+
+// Defines values for BatchRequestMode.
+const (
+	Atomic     BatchRequestMode = "atomic"
+	BestEffort BatchRequestMode = "best_effort"
+)
+
+// Defines values for EventType.
+const (
+	UserCreated EventType = "user.created"
+	UserDeleted EventType = "user.deleted"
+	UserExpired EventType = "user.expired"
+	UserUpdated EventType = "user.updated"
+)
+
+// Defines values for TransferFormat.
+const (
+	Csv    TransferFormat = "csv"
+	Ndjson TransferFormat = "ndjson"
+)
+
+// Defines values for WatchMessageType.
+const (
+	Error        WatchMessageType = "error"
+	Event        WatchMessageType = "event"
+	Subscribed   WatchMessageType = "subscribed"
+	Unsubscribed WatchMessageType = "unsubscribed"
+)
+
+// Defines values for WatchRequestAction.
+const (
+	Subscribe   WatchRequestAction = "subscribe"
+	Unsubscribe WatchRequestAction = "unsubscribe"
+)
+
+// Defines values for WebhookDeliveryAttemptStatus.
+const (
+	Dead      WebhookDeliveryAttemptStatus = "dead"
+	Retrying  WebhookDeliveryAttemptStatus = "retrying"
+	Succeeded WebhookDeliveryAttemptStatus = "succeeded"
+)
+
+// Defines values for SearchUsersParamsMatch.
+const (
+	Exact  SearchUsersParamsMatch = "exact"
+	Prefix SearchUsersParamsMatch = "prefix"
+)
+
+// BatchOperation defines model for BatchOperation.
+type BatchOperation struct {
+	// ClearExpiry an update keeps the user for good, not together with expires_at
+	ClearExpiry *bool                `json:"clear_expiry,omitempty"`
+	Email       *openapi_types.Email `json:"email,omitempty"`
+
+	// ExpiresAt when the created or updated user expires, an update without expiry keeps the one the user has
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Id required for update and delete
+	Id *openapi_types.UUID `json:"id,omitempty"`
+
+	// Name required for create and update
+	Name *string          `json:"name,omitempty"`
+	Op   BatchOperationOp `json:"op"`
+}
+
+// BatchOperationOp defines model for BatchOperation.Op.
+type BatchOperationOp string
+
+// BatchRequest defines model for BatchRequest.
+type BatchRequest struct {
+	// Mode atomic applies all operations or none of them, best_effort applies every operation that succeeds on its own
+	Mode       *BatchRequestMode `json:"mode,omitempty"`
+	Operations []BatchOperation  `json:"operations"`
+}
+
+// BatchRequestMode atomic applies all operations or none of them, best_effort applies every operation that succeeds on its own
+type BatchRequestMode string
+
+// BatchResponse defines model for BatchResponse.
+type BatchResponse struct {
+	// Applied false when an atomic batch was rejected as a whole
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult defines model for BatchResult.
+type BatchResult struct {
+	Error *string             `json:"error,omitempty"`
+	Id    *openapi_types.UUID `json:"id,omitempty"`
+
+	// Status HTTP status code of the operation
+	Status int `json:"status"`
+}
+
+// EventType defines model for EventType.
+type EventType string
+
+// GraphQLError defines model for GraphQLError.
+type GraphQLError struct {
+	Extensions *map[string]interface{} `json:"extensions,omitempty"`
+	Message    string                  `json:"message"`
+	Path       *[]interface{}          `json:"path,omitempty"`
+}
+
+// GraphQLRequest defines model for GraphQLRequest.
+type GraphQLRequest struct {
+	OperationName *string                 `json:"operationName,omitempty"`
+	Query         string                  `json:"query"`
+	Variables     *map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse defines model for GraphQLResponse.
+type GraphQLResponse struct {
+	Data   *map[string]interface{} `json:"data,omitempty"`
+	Errors *[]GraphQLError         `json:"errors,omitempty"`
+}
+
+// ImportError defines model for ImportError.
+type ImportError struct {
+	Error string              `json:"error"`
+	Id    *openapi_types.UUID `json:"id,omitempty"`
+	Line  int                 `json:"line"`
+}
+
+// ImportReport defines model for ImportReport.
+type ImportReport struct {
+	// Errors the failed lines, at most the first 1000 of them
+	Errors   []ImportError `json:"errors"`
+	Failed   int           `json:"failed"`
+	Imported int           `json:"imported"`
+
+	// Truncated true when more lines failed than errors lists
+	Truncated *bool `json:"truncated,omitempty"`
+}
+
+// Tenant defines model for Tenant.
+type Tenant struct {
+	Name string `json:"name"`
+
+	// Quota the most users the tenant may have, 0 when there is no cap
+	Quota int   `json:"quota"`
+	Users int64 `json:"users"`
+}
+
+// TenantPurge defines model for TenantPurge.
+type TenantPurge struct {
+	Name string `json:"name"`
+
+	// Users how many users were deleted
+	Users int64 `json:"users"`
+}
+
+// TransferFormat ndjson holds one User object per line, csv has an id,name,email,expires_at header row
+type TransferFormat string
+
 // User defines model for User.
 type User struct {
-	Id   openapi_types.UUID `json:"id"`
-	Name string             `json:"name"`
+	Email *openapi_types.Email `json:"email,omitempty"`
+
+	// ExpiresAt when the user expires, left out for users that do not
+	ExpiresAt *time.Time         `json:"expires_at,omitempty"`
+	Id        openapi_types.UUID `json:"id"`
+	Name      string             `json:"name"`
+
+	// Ttl seconds until the user expires, rounded up, left out for users that do not
+	Ttl *int64 `json:"ttl,omitempty"`
+}
+
+// UserEvent a user change event, sent as a server-sent event its id is the position in the event stream
+type UserEvent struct {
+	Id         string             `json:"id"`
+	Name       *string            `json:"name,omitempty"`
+	OccurredAt time.Time          `json:"occurred_at"`
+	Type       EventType          `json:"type"`
+	UserId     openapi_types.UUID `json:"user_id"`
 }
 
 // UserRequest defines model for UserRequest.
 type UserRequest struct {
-	Name string `json:"name"`
+	// ClearExpiry an update keeps the user for good, not together with expires_at or ttl
+	ClearExpiry *bool `json:"clear_expiry,omitempty"`
+
+	// Email unique across users regardless of case, left out when the user has no email
+	Email *openapi_types.Email `json:"email,omitempty"`
+
+	// ExpiresAt when the user expires and is deleted, an update without expiry keeps the one the user has
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Name      string     `json:"name"`
+
+	// Ttl seconds until the user expires, instead of expires_at
+	Ttl *int64 `json:"ttl,omitempty"`
+}
+
+// WatchMessage message the server sends over the websocket
+type WatchMessage struct {
+	Error *string `json:"error,omitempty"`
+
+	// Event a user change event, sent as a server-sent event its id is the position in the event stream
+	Event *UserEvent            `json:"event,omitempty"`
+	Ids   *[]openapi_types.UUID `json:"ids,omitempty"`
+	Type  WatchMessageType      `json:"type"`
+}
+
+// WatchMessageType defines model for WatchMessage.Type.
+type WatchMessageType string
+
+// WatchRequest message a websocket client sends to change its subscriptions
+type WatchRequest struct {
+	Action WatchRequestAction   `json:"action"`
+	Ids    []openapi_types.UUID `json:"ids"`
+}
+
+// WatchRequestAction defines model for WatchRequest.Action.
+type WatchRequestAction string
+
+// Webhook defines model for Webhook.
+type Webhook struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// Events event types the webhook is subscribed to, empty means all of them
+	Events []EventType        `json:"events"`
+	Id     openapi_types.UUID `json:"id"`
+
+	// Secret HMAC-SHA256 signing secret, only returned when the webhook is created
+	Secret *string `json:"secret,omitempty"`
+	Url    string  `json:"url"`
+}
+
+// WebhookDeadLetter defines model for WebhookDeadLetter.
+type WebhookDeadLetter struct {
+	Attempts   int       `json:"attempts"`
+	DeliveryId string    `json:"delivery_id"`
+	EventId    string    `json:"event_id"`
+	EventType  EventType `json:"event_type"`
+	LastError  *string   `json:"last_error,omitempty"`
+	UserId     string    `json:"user_id"`
+}
+
+// WebhookDeliveryAttempt defines model for WebhookDeliveryAttempt.
+type WebhookDeliveryAttempt struct {
+	At         time.Time                    `json:"at"`
+	Attempt    int                          `json:"attempt"`
+	DeliveryId string                       `json:"delivery_id"`
+	Error      *string                      `json:"error,omitempty"`
+	EventId    string                       `json:"event_id"`
+	EventType  EventType                    `json:"event_type"`
+	Status     WebhookDeliveryAttemptStatus `json:"status"`
+	StatusCode *int                         `json:"status_code,omitempty"`
+}
+
+// WebhookDeliveryAttemptStatus defines model for WebhookDeliveryAttempt.Status.
+type WebhookDeliveryAttemptStatus string
+
+// WebhookRequest defines model for WebhookRequest.
+type WebhookRequest struct {
+	Events *[]EventType `json:"events,omitempty"`
+	Url    string       `json:"url"`
+}
+
+// SearchUsersParams defines parameters for SearchUsers.
+type SearchUsersParams struct {
+	// Name the name, or the start of it when match is prefix
+	Name       string                  `form:"name" json:"name"`
+	Match      *SearchUsersParamsMatch `form:"match,omitempty" json:"match,omitempty"`
+	IgnoreCase *bool                   `form:"ignore_case,omitempty" json:"ignore_case,omitempty"`
+	Limit      *int                    `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// SearchUsersParamsMatch defines parameters for SearchUsers.
+type SearchUsersParamsMatch string
+
+// StreamUserEventsParams defines parameters for StreamUserEvents.
+type StreamUserEventsParams struct {
+	// LastEventID resume after this event
+	LastEventID *string `json:"Last-Event-ID,omitempty"`
+}
+
+// ExportUsersParams defines parameters for ExportUsers.
+type ExportUsersParams struct {
+	Format *TransferFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// ImportUsersParams defines parameters for ImportUsers.
+type ImportUsersParams struct {
+	Format *TransferFormat `form:"format,omitempty" json:"format,omitempty"`
 }
 
 // CreateUserJSONRequestBody defines body for CreateUser for application/json ContentType.
@@ -29,15 +312,42 @@ type CreateUserJSONRequestBody = UserRequest
 // UpdateUserJSONRequestBody defines body for UpdateUser for application/json ContentType.
 type UpdateUserJSONRequestBody = UserRequest
 
+// BatchUsersJSONRequestBody defines body for BatchUsers for application/json ContentType.
+type BatchUsersJSONRequestBody = BatchRequest
+
+// CreateWebhookJSONRequestBody defines body for CreateWebhook for application/json ContentType.
+type CreateWebhookJSONRequestBody = WebhookRequest
+
+// UpdateWebhookJSONRequestBody defines body for UpdateWebhook for application/json ContentType.
+type UpdateWebhookJSONRequestBody = WebhookRequest
+
+// GraphqlJSONRequestBody defines body for Graphql for application/json ContentType.
+type GraphqlJSONRequestBody = GraphQLRequest
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 
 	// (GET /)
 	HealthCheck(ctx echo.Context) error
 
+	// (GET /admin/tenants)
+	ListTenants(ctx echo.Context) error
+
+	// (DELETE /admin/tenants/{tenant})
+	PurgeTenant(ctx echo.Context, tenant string) error
+
+	// (GET /api/user)
+	SearchUsers(ctx echo.Context, params SearchUsersParams) error
+
 	// (POST /api/user)
 	CreateUser(ctx echo.Context) error
 
+	// (GET /api/user/events)
+	StreamUserEvents(ctx echo.Context, params StreamUserEventsParams) error
+
+	// (GET /api/user/watch)
+	WatchUsers(ctx echo.Context) error
+
 	// (DELETE /api/user/{id})
 	DeleteUser(ctx echo.Context, id openapi_types.UUID) error
 
@@ -46,6 +356,39 @@ type ServerInterface interface {
 
 	// (POST /api/user/{id})
 	UpdateUser(ctx echo.Context, id openapi_types.UUID) error
+
+	// (POST /api/user:batch)
+	BatchUsers(ctx echo.Context) error
+
+	// (GET /api/user:export)
+	ExportUsers(ctx echo.Context, params ExportUsersParams) error
+
+	// (POST /api/user:import)
+	ImportUsers(ctx echo.Context, params ImportUsersParams) error
+
+	// (GET /api/webhooks)
+	ListWebhooks(ctx echo.Context) error
+
+	// (POST /api/webhooks)
+	CreateWebhook(ctx echo.Context) error
+
+	// (DELETE /api/webhooks/{id})
+	DeleteWebhook(ctx echo.Context, id openapi_types.UUID) error
+
+	// (GET /api/webhooks/{id})
+	GetWebhook(ctx echo.Context, id openapi_types.UUID) error
+
+	// (POST /api/webhooks/{id})
+	UpdateWebhook(ctx echo.Context, id openapi_types.UUID) error
+
+	// (GET /api/webhooks/{id}/dead-letters)
+	ListWebhookDeadLetters(ctx echo.Context, id openapi_types.UUID) error
+
+	// (GET /api/webhooks/{id}/deliveries)
+	ListWebhookDeliveries(ctx echo.Context, id openapi_types.UUID) error
+
+	// (POST /graphql)
+	Graphql(ctx echo.Context) error
 }
 
 // ServerInterfaceWrapper converts echo contexts to parameters.
@@ -62,6 +405,70 @@ func (w *ServerInterfaceWrapper) HealthCheck(ctx echo.Context) error {
 	return err
 }
 
+// ListTenants converts echo context to params.
+func (w *ServerInterfaceWrapper) ListTenants(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListTenants(ctx)
+	return err
+}
+
+// PurgeTenant converts echo context to params.
+func (w *ServerInterfaceWrapper) PurgeTenant(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "tenant" -------------
+	var tenant string
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "tenant", runtime.ParamLocationPath, ctx.Param("tenant"), &tenant)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter tenant: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.PurgeTenant(ctx, tenant)
+	return err
+}
+
+// SearchUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) SearchUsers(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params SearchUsersParams
+	// ------------- Required query parameter "name" -------------
+
+	err = runtime.BindQueryParameter("form", true, true, "name", ctx.QueryParams(), &params.Name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter name: %s", err))
+	}
+
+	// ------------- Optional query parameter "match" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "match", ctx.QueryParams(), &params.Match)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter match: %s", err))
+	}
+
+	// ------------- Optional query parameter "ignore_case" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "ignore_case", ctx.QueryParams(), &params.IgnoreCase)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ignore_case: %s", err))
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", ctx.QueryParams(), &params.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter limit: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.SearchUsers(ctx, params)
+	return err
+}
+
 // CreateUser converts echo context to params.
 func (w *ServerInterfaceWrapper) CreateUser(ctx echo.Context) error {
 	var err error
@@ -71,6 +478,44 @@ func (w *ServerInterfaceWrapper) CreateUser(ctx echo.Context) error {
 	return err
 }
 
+// StreamUserEvents converts echo context to params.
+func (w *ServerInterfaceWrapper) StreamUserEvents(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params StreamUserEventsParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "Last-Event-ID" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Last-Event-ID")]; found {
+		var LastEventID string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for Last-Event-ID, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "Last-Event-ID", runtime.ParamLocationHeader, valueList[0], &LastEventID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter Last-Event-ID: %s", err))
+		}
+
+		params.LastEventID = &LastEventID
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.StreamUserEvents(ctx, params)
+	return err
+}
+
+// WatchUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) WatchUsers(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.WatchUsers(ctx)
+	return err
+}
+
 // DeleteUser converts echo context to params.
 func (w *ServerInterfaceWrapper) DeleteUser(ctx echo.Context) error {
 	var err error
@@ -119,6 +564,158 @@ func (w *ServerInterfaceWrapper) UpdateUser(ctx echo.Context) error {
 	return err
 }
 
+// BatchUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) BatchUsers(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BatchUsers(ctx)
+	return err
+}
+
+// ExportUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) ExportUsers(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ExportUsersParams
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", ctx.QueryParams(), &params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter format: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ExportUsers(ctx, params)
+	return err
+}
+
+// ImportUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) ImportUsers(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ImportUsersParams
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", ctx.QueryParams(), &params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter format: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ImportUsers(ctx, params)
+	return err
+}
+
+// ListWebhooks converts echo context to params.
+func (w *ServerInterfaceWrapper) ListWebhooks(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListWebhooks(ctx)
+	return err
+}
+
+// CreateWebhook converts echo context to params.
+func (w *ServerInterfaceWrapper) CreateWebhook(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.CreateWebhook(ctx)
+	return err
+}
+
+// DeleteWebhook converts echo context to params.
+func (w *ServerInterfaceWrapper) DeleteWebhook(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, ctx.Param("id"), &id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter id: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.DeleteWebhook(ctx, id)
+	return err
+}
+
+// GetWebhook converts echo context to params.
+func (w *ServerInterfaceWrapper) GetWebhook(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, ctx.Param("id"), &id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter id: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetWebhook(ctx, id)
+	return err
+}
+
+// UpdateWebhook converts echo context to params.
+func (w *ServerInterfaceWrapper) UpdateWebhook(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, ctx.Param("id"), &id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter id: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.UpdateWebhook(ctx, id)
+	return err
+}
+
+// ListWebhookDeadLetters converts echo context to params.
+func (w *ServerInterfaceWrapper) ListWebhookDeadLetters(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, ctx.Param("id"), &id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter id: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListWebhookDeadLetters(ctx, id)
+	return err
+}
+
+// ListWebhookDeliveries converts echo context to params.
+func (w *ServerInterfaceWrapper) ListWebhookDeliveries(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, ctx.Param("id"), &id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter id: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListWebhookDeliveries(ctx, id)
+	return err
+}
+
+// Graphql converts echo context to params.
+func (w *ServerInterfaceWrapper) Graphql(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.Graphql(ctx)
+	return err
+}
+
 // This is a simple interface which specifies echo.Route addition functions which
 // are present on both echo.Echo and echo.Group, since we want to allow using
 // either of them for path registration
@@ -148,9 +745,25 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 	}
 
 	router.GET(baseURL+"/", wrapper.HealthCheck)
+	router.GET(baseURL+"/admin/tenants", wrapper.ListTenants)
+	router.DELETE(baseURL+"/admin/tenants/:tenant", wrapper.PurgeTenant)
+	router.GET(baseURL+"/api/user", wrapper.SearchUsers)
 	router.POST(baseURL+"/api/user", wrapper.CreateUser)
+	router.GET(baseURL+"/api/user/events", wrapper.StreamUserEvents)
+	router.GET(baseURL+"/api/user/watch", wrapper.WatchUsers)
 	router.DELETE(baseURL+"/api/user/:id", wrapper.DeleteUser)
 	router.GET(baseURL+"/api/user/:id", wrapper.GetUser)
 	router.POST(baseURL+"/api/user/:id", wrapper.UpdateUser)
+	router.POST(baseURL+"/api/user:batch", wrapper.BatchUsers)
+	router.GET(baseURL+"/api/user:export", wrapper.ExportUsers)
+	router.POST(baseURL+"/api/user:import", wrapper.ImportUsers)
+	router.GET(baseURL+"/api/webhooks", wrapper.ListWebhooks)
+	router.POST(baseURL+"/api/webhooks", wrapper.CreateWebhook)
+	router.DELETE(baseURL+"/api/webhooks/:id", wrapper.DeleteWebhook)
+	router.GET(baseURL+"/api/webhooks/:id", wrapper.GetWebhook)
+	router.POST(baseURL+"/api/webhooks/:id", wrapper.UpdateWebhook)
+	router.GET(baseURL+"/api/webhooks/:id/dead-letters", wrapper.ListWebhookDeadLetters)
+	router.GET(baseURL+"/api/webhooks/:id/deliveries", wrapper.ListWebhookDeliveries)
+	router.POST(baseURL+"/graphql", wrapper.Graphql)
 
 }
@@ -0,0 +1,71 @@
+package driver
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ EchoRouter = (*Router)(nil)
+
+// Router registers the generated routes on echo, escaping colons that do not start a path parameter,
+// so custom methods like /api/user:batch are matched literally
+type Router struct {
+	router EchoRouter
+}
+
+func NewRouter(router EchoRouter) *Router {
+	return &Router{
+		router: router,
+	}
+}
+
+func (r Router) CONNECT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.CONNECT(escapePath(path), h, m...)
+}
+
+func (r Router) DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.DELETE(escapePath(path), h, m...)
+}
+
+func (r Router) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.GET(escapePath(path), h, m...)
+}
+
+func (r Router) HEAD(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.HEAD(escapePath(path), h, m...)
+}
+
+func (r Router) OPTIONS(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.OPTIONS(escapePath(path), h, m...)
+}
+
+func (r Router) PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.PATCH(escapePath(path), h, m...)
+}
+
+func (r Router) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.POST(escapePath(path), h, m...)
+}
+
+func (r Router) PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.PUT(escapePath(path), h, m...)
+}
+
+func (r Router) TRACE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.router.TRACE(escapePath(path), h, m...)
+}
+
+func escapePath(path string) string {
+	var b strings.Builder
+
+	for i, c := range path {
+		if c == ':' && i > 0 && path[i-1] != '/' {
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
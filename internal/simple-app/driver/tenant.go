@@ -0,0 +1,234 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver/pb"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const bearerPrefix = "Bearer "
+
+var (
+	errTenantMissing = errors.New("the request names no tenant")
+	errTenantToken   = errors.New("invalid tenant token")
+)
+
+// TenantResolver finds the tenant of a request in a header, the subdomain or a claim of the bearer token
+type TenantResolver struct {
+	cfg config.TenantConfig
+}
+
+func NewTenantResolver(cfg *config.Config) (*TenantResolver, error) {
+	t := &TenantResolver{
+		cfg: cfg.Tenant,
+	}
+
+	if !cfg.Tenant.Enabled {
+		return t, nil
+	}
+
+	switch cfg.Tenant.Source {
+	case config.TenantFromHeader:
+		if cfg.Tenant.Header == "" {
+			return nil, errors.New("error configuring tenants: the header source needs the header name")
+		}
+	case config.TenantFromSubdomain:
+		if cfg.Tenant.Domain == "" {
+			return nil, errors.New("error configuring tenants: the subdomain source needs the parent domain")
+		}
+	case config.TenantFromJWT:
+		if cfg.Tenant.JWTSecret == "" || cfg.Tenant.JWTClaim == "" {
+			return nil, errors.New("error configuring tenants: the jwt source needs the secret and the claim")
+		}
+	default:
+		return nil, fmt.Errorf("error configuring tenants: unknown source %q, expected %s, %s or %s",
+			cfg.Tenant.Source, config.TenantFromHeader, config.TenantFromSubdomain, config.TenantFromJWT)
+	}
+
+	if cfg.Tenant.Default != "" {
+		err := domain.ValidateTenant(cfg.Tenant.Default)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring tenants: %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+// Middleware scopes the user endpoints to the tenant of the request, the other endpoints are shared
+func (t TenantResolver) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+
+			if !t.cfg.Enabled || !tenantScoped(req.URL.Path) {
+				return next(ctx)
+			}
+
+			tenant, err := t.resolve(req.Header.Get, req.Host)
+			if err != nil {
+				if errors.Is(err, errTenantToken) {
+					return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+				}
+
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			ctx.SetRequest(req.WithContext(domain.WithTenant(req.Context(), tenant)))
+
+			return next(ctx)
+		}
+	}
+}
+
+// UnaryInterceptor scopes the calls of the user service to the tenant of the call
+func (t TenantResolver) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := t.scope(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor scopes the streams of the user service to the tenant of the call
+func (t TenantResolver) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := t.scope(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, tenantStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func (t TenantResolver) scope(ctx context.Context, method string) (context.Context, error) {
+	if !t.cfg.Enabled || !strings.HasPrefix(method, "/"+pb.UserService_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	header := func(name string) string {
+		values := md.Get(name)
+		if len(values) == 0 {
+			return ""
+		}
+
+		return values[0]
+	}
+
+	tenant, err := t.resolve(header, header(":authority"))
+	if err != nil {
+		if errors.Is(err, errTenantToken) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return domain.WithTenant(ctx, tenant), nil
+}
+
+// resolve takes the tenant from the configured source, falling back to the default tenant
+func (t TenantResolver) resolve(header func(name string) string, host string) (tenant string, err error) {
+	switch t.cfg.Source {
+	case config.TenantFromHeader:
+		tenant = header(t.cfg.Header)
+	case config.TenantFromSubdomain:
+		tenant = t.subdomain(host)
+	case config.TenantFromJWT:
+		tenant, err = t.claim(header(echo.HeaderAuthorization))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if tenant == "" {
+		tenant = t.cfg.Default
+	}
+
+	if tenant == "" {
+		return "", errTenantMissing
+	}
+
+	err = domain.ValidateTenant(tenant)
+	if err != nil {
+		return "", err
+	}
+
+	return tenant, nil
+}
+
+// subdomain is the label in front of the parent domain, host names ignore case
+func (t TenantResolver) subdomain(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(strings.Trim(t.cfg.Domain, "."))
+
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+
+	return strings.TrimSuffix(host, suffix)
+}
+
+// claim reads the tenant from a bearer token signed with the secret, a request without a token has no tenant
+func (t TenantResolver) claim(authorization string) (string, error) {
+	if authorization == "" {
+		return "", nil
+	}
+
+	raw, ok := strings.CutPrefix(authorization, bearerPrefix)
+	if !ok {
+		return "", fmt.Errorf("%w: expected a bearer token", errTenantToken)
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(raw, claims, func(*jwt.Token) (any, error) {
+		return []byte(t.cfg.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errTenantToken, err)
+	}
+
+	tenant, _ := claims[t.cfg.JWTClaim].(string)
+
+	return tenant, nil
+}
+
+// tenantScoped tells the user endpoints from the shared ones like the health check and the admin endpoints
+func tenantScoped(path string) bool {
+	return path == "/graphql" || strings.HasPrefix(path, "/api/user")
+}
+
+// tenantStream hands the scoped context to the stream handlers
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tenantStream) Context() context.Context {
+	return s.ctx
+}
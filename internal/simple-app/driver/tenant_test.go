@@ -0,0 +1,219 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver/pb"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const testJWTSecret = "jwt-secret"
+
+func newTestToken(t *testing.T, method jwt.SigningMethod, secret string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+
+	return bearerPrefix + token
+}
+
+func TestTenantResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.TenantConfig
+		headers map[string]string
+		host    string
+		tenant  string
+		err     error
+	}{
+		{
+			name:    "header",
+			cfg:     config.TenantConfig{Source: config.TenantFromHeader, Header: "X-Tenant-ID"},
+			headers: map[string]string{"X-Tenant-ID": "acme"},
+			tenant:  "acme",
+		},
+		{
+			name:   "default",
+			cfg:    config.TenantConfig{Source: config.TenantFromHeader, Header: "X-Tenant-ID", Default: "public"},
+			tenant: "public",
+		},
+		{
+			name: "missing",
+			cfg:  config.TenantConfig{Source: config.TenantFromHeader, Header: "X-Tenant-ID"},
+			err:  errTenantMissing,
+		},
+		{
+			name:    "malformed",
+			cfg:     config.TenantConfig{Source: config.TenantFromHeader, Header: "X-Tenant-ID"},
+			headers: map[string]string{"X-Tenant-ID": "acme::*"},
+			err:     domain.ErrorInvalidInput,
+		},
+		{
+			name:   "subdomain",
+			cfg:    config.TenantConfig{Source: config.TenantFromSubdomain, Domain: "example.com"},
+			host:   "Acme.Example.com:8080",
+			tenant: "acme",
+		},
+		{
+			name: "apex domain",
+			cfg:  config.TenantConfig{Source: config.TenantFromSubdomain, Domain: "example.com"},
+			host: "example.com",
+			err:  errTenantMissing,
+		},
+		{
+			name: "nested subdomain",
+			cfg:  config.TenantConfig{Source: config.TenantFromSubdomain, Domain: "example.com"},
+			host: "eu.acme.example.com",
+			err:  domain.ErrorInvalidInput,
+		},
+		{
+			name: "jwt",
+			cfg:  config.TenantConfig{Source: config.TenantFromJWT, JWTSecret: testJWTSecret, JWTClaim: "tenant"},
+			headers: map[string]string{echo.HeaderAuthorization: newTestToken(t, jwt.SigningMethodHS256, testJWTSecret,
+				jwt.MapClaims{"tenant": "acme", "exp": time.Now().Add(time.Hour).Unix()})},
+			tenant: "acme",
+		},
+		{
+			name: "jwt with wrong signature",
+			cfg:  config.TenantConfig{Source: config.TenantFromJWT, JWTSecret: testJWTSecret, JWTClaim: "tenant"},
+			headers: map[string]string{echo.HeaderAuthorization: newTestToken(t, jwt.SigningMethodHS256, "guess",
+				jwt.MapClaims{"tenant": "acme"})},
+			err: errTenantToken,
+		},
+		{
+			name: "jwt with other algorithm",
+			cfg:  config.TenantConfig{Source: config.TenantFromJWT, JWTSecret: testJWTSecret, JWTClaim: "tenant"},
+			headers: map[string]string{echo.HeaderAuthorization: newTestToken(t, jwt.SigningMethodHS512, testJWTSecret,
+				jwt.MapClaims{"tenant": "acme"})},
+			err: errTenantToken,
+		},
+		{
+			name: "expired jwt",
+			cfg:  config.TenantConfig{Source: config.TenantFromJWT, JWTSecret: testJWTSecret, JWTClaim: "tenant"},
+			headers: map[string]string{echo.HeaderAuthorization: newTestToken(t, jwt.SigningMethodHS256, testJWTSecret,
+				jwt.MapClaims{"tenant": "acme", "exp": time.Now().Add(-time.Hour).Unix()})},
+			err: errTenantToken,
+		},
+		{
+			name: "jwt without tenant",
+			cfg:  config.TenantConfig{Source: config.TenantFromJWT, JWTSecret: testJWTSecret, JWTClaim: "tenant"},
+			headers: map[string]string{echo.HeaderAuthorization: newTestToken(t, jwt.SigningMethodHS256, testJWTSecret,
+				jwt.MapClaims{"sub": "someone"})},
+			err: errTenantMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Enabled = true
+
+			resolver, err := NewTenantResolver(&config.Config{Tenant: tt.cfg})
+			require.NoError(t, err)
+
+			tenant, err := resolver.resolve(func(name string) string {
+				return tt.headers[name]
+			}, tt.host)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
+
+func TestNewTenantResolver(t *testing.T) {
+	for _, cfg := range []config.TenantConfig{
+		{Enabled: true, Source: "cookie"},
+		{Enabled: true, Source: config.TenantFromSubdomain},
+		{Enabled: true, Source: config.TenantFromJWT, JWTClaim: "tenant"},
+		{Enabled: true, Source: config.TenantFromHeader, Header: "X-Tenant-ID", Default: "Public"},
+	} {
+		_, err := NewTenantResolver(&config.Config{Tenant: cfg})
+		require.Error(t, err, cfg)
+	}
+
+	_, err := NewTenantResolver(&config.Config{Tenant: config.TenantConfig{Source: "cookie"}})
+	require.NoError(t, err, "the source is not checked while tenants are disabled")
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	resolver, err := NewTenantResolver(&config.Config{
+		Tenant: config.TenantConfig{Enabled: true, Source: config.TenantFromHeader, Header: "X-Tenant-ID"},
+	})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(resolver.Middleware())
+
+	handler := func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, domain.TenantFromContext(ctx.Request().Context()))
+	}
+	e.GET(apiUser, handler)
+	e.GET("/", handler)
+
+	serve := func(path, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve(apiUser, "acme")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "acme", rec.Body.String())
+
+	require.Equal(t, http.StatusBadRequest, serve(apiUser, "").Code)
+
+	// the health check is shared
+	rec = serve("/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Body.String())
+}
+
+func TestTenantInterceptor(t *testing.T) {
+	resolver, err := NewTenantResolver(&config.Config{
+		Tenant: config.TenantConfig{Enabled: true, Source: config.TenantFromHeader, Header: "X-Tenant-ID"},
+	})
+	require.NoError(t, err)
+
+	app := mocks.NewApplicationInterface(t)
+	client := newGRPCClient(t, app,
+		grpc.UnaryInterceptor(resolver.UnaryInterceptor()),
+		grpc.StreamInterceptor(resolver.StreamInterceptor()),
+	)
+	id := uuid.New()
+
+	app.On("GetUser", mock.MatchedBy(func(ctx context.Context) bool {
+		return domain.TenantFromContext(ctx) == "acme"
+	}), id).Return(domain.User{ID: id, Name: "name"}, nil).Once()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+	_, err = client.GetUser(ctx, &pb.GetUserRequest{Id: id.String()})
+	require.NoError(t, err)
+
+	_, err = client.GetUser(context.Background(), &pb.GetUserRequest{Id: id.String()})
+	requireCode(t, codes.InvalidArgument, err)
+}
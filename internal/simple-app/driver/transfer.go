@@ -0,0 +1,364 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+
+	maxImportErrors = 1000
+	maxLineSize     = 64 * 1024
+)
+
+// csvHeader is the header of exports, imports may leave out the trailing email and expires_at columns
+var csvHeader = []string{"id", "name", "email", "expires_at"}
+
+func (h HTTPServer) ExportUsers(ctx echo.Context, params ExportUsersParams) error {
+	format, err := transferFormat(params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, contentType(format))
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=users.%s", format))
+
+	err = WriteUsers(ctx.Request().Context(), h.app, resp, format)
+	if err != nil {
+		if resp.Committed {
+			// a truncated export must not look complete, so the connection is dropped instead of ending the body
+			panic(http.ErrAbortHandler)
+		}
+
+		resp.Header().Del(echo.HeaderContentDisposition)
+
+		return serverError(ctx, err)
+	}
+
+	return nil
+}
+
+func (h HTTPServer) ImportUsers(ctx echo.Context, params ImportUsersParams) error {
+	format, err := transferFormat(params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report, err := ReadUsers(ctx.Request().Context(), h.app, ctx.Request().Body, format)
+	if err != nil {
+		return serverError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, report)
+}
+
+// WriteUsers streams every user to w
+func WriteUsers(ctx context.Context, app domain.ApplicationInterface, w io.Writer, format TransferFormat) (err error) {
+	buf := bufio.NewWriter(w)
+
+	encode, err := newUserEncoder(buf, format)
+	if err != nil {
+		return fmt.Errorf("error writing users: %w", err)
+	}
+
+	for user, err := range app.ExportUsers(ctx) {
+		if err != nil {
+			return err
+		}
+
+		err = encode(toUser(user))
+		if err != nil {
+			return fmt.Errorf("error writing users: %w", err)
+		}
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing users: %w", err)
+	}
+
+	return nil
+}
+
+// ReadUsers imports the users streamed from r, err is only set when the import could not continue
+func ReadUsers(ctx context.Context, app domain.ApplicationInterface, r io.Reader, format TransferFormat) (report ImportReport, err error) {
+	report.Errors = []ImportError{}
+
+	err = app.ImportUsers(ctx, decodeUsers(r, format), func(result domain.ImportResult) error {
+		if result.Err == nil {
+			report.Imported++
+
+			return nil
+		}
+
+		report.Failed++
+
+		if len(report.Errors) == maxImportErrors {
+			truncated := true
+			report.Truncated = &truncated
+
+			return nil
+		}
+
+		importError := ImportError{
+			Line:  result.Line,
+			Error: result.Err.Error(),
+		}
+
+		if result.ID != uuid.Nil {
+			importError.Id = &result.ID
+		}
+
+		report.Errors = append(report.Errors, importError)
+
+		return nil
+	})
+
+	return report, err
+}
+
+func newUserEncoder(w io.Writer, format TransferFormat) (func(User) error, error) {
+	if format == Csv {
+		writer := csv.NewWriter(w)
+
+		err := writer.Write(csvHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(user User) error {
+			expiresAt := ""
+			if user.ExpiresAt != nil {
+				expiresAt = user.ExpiresAt.Format(time.RFC3339Nano)
+			}
+
+			err := writer.Write([]string{user.Id.String(), user.Name, fromEmail(user.Email), expiresAt})
+			if err != nil {
+				return err
+			}
+
+			writer.Flush()
+
+			return writer.Error()
+		}, nil
+	}
+
+	encoder := json.NewEncoder(w)
+
+	return func(user User) error {
+		return encoder.Encode(user)
+	}, nil
+}
+
+func decodeUsers(r io.Reader, format TransferFormat) iter.Seq[domain.ImportRecord] {
+	if format == Csv {
+		return decodeCSVUsers(r)
+	}
+
+	return decodeNDJSONUsers(r)
+}
+
+func decodeNDJSONUsers(r io.Reader) iter.Seq[domain.ImportRecord] {
+	return func(yield func(domain.ImportRecord) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+		line := 0
+
+		for scanner.Scan() {
+			line++
+
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+
+			if !yield(decodeNDJSONUser(line, data)) {
+				return
+			}
+		}
+
+		err := scanner.Err()
+		if err != nil {
+			yield(domain.ImportRecord{
+				Line: line + 1,
+				Err:  fmt.Errorf("%w: error reading line: %w", domain.ErrorInvalidInput, err),
+			})
+		}
+	}
+}
+
+func decodeNDJSONUser(line int, data []byte) domain.ImportRecord {
+	// ttl is part of exported users, it is taken from expires_at
+	var user struct {
+		ID        string     `json:"id"`
+		Name      string     `json:"name"`
+		Email     string     `json:"email"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		TTL       *int64     `json:"ttl"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&user)
+	if err != nil {
+		return domain.ImportRecord{Line: line, Err: fmt.Errorf("%w: malformed json: %w", domain.ErrorInvalidInput, err)}
+	}
+
+	record := newImportRecord(line, user.ID, user.Name, user.Email)
+	if user.ExpiresAt != nil {
+		record.User.ExpiresAt = *user.ExpiresAt
+	}
+
+	return record
+}
+
+func decodeCSVUsers(r io.Reader) iter.Seq[domain.ImportRecord] {
+	return func(yield func(domain.ImportRecord) bool) {
+		reader := csv.NewReader(r)
+		// every record has to have as many fields as the header
+		reader.FieldsPerRecord = 0
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if err != nil && !errors.Is(err, io.EOF) {
+			yield(domain.ImportRecord{Line: 1, Err: fmt.Errorf("%w: malformed header: %w", domain.ErrorInvalidInput, err)})
+
+			return
+		}
+
+		if err == nil && !validCSVHeader(header) {
+			yield(domain.ImportRecord{Line: 1, Err: fmt.Errorf("%w: header must be %s", domain.ErrorInvalidInput, strings.Join(csvHeader, ","))})
+
+			return
+		}
+
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			line, _ := reader.FieldPos(0)
+
+			var parseErr *csv.ParseError
+
+			switch {
+			case errors.As(err, &parseErr):
+				// the reader skips the broken record, so the import carries on with the next one
+				if !yield(domain.ImportRecord{Line: parseErr.Line, Err: fmt.Errorf("%w: %w", domain.ErrorInvalidInput, parseErr.Err)}) {
+					return
+				}
+			case err != nil:
+				yield(domain.ImportRecord{Line: line, Err: fmt.Errorf("%w: error reading csv: %w", domain.ErrorInvalidInput, err)})
+
+				return
+			default:
+				if !yield(newCSVImportRecord(line, record)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func validCSVHeader(header []string) bool {
+	if len(header) < 2 || len(header) > len(csvHeader) {
+		return false
+	}
+
+	for i, field := range header {
+		if !strings.EqualFold(field, csvHeader[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newCSVImportRecord fills the columns the header left out with empty fields
+func newCSVImportRecord(line int, record []string) domain.ImportRecord {
+	fields := make([]string, len(csvHeader))
+	copy(fields, record)
+
+	imported := newImportRecord(line, fields[0], fields[1], fields[2])
+	if imported.Err != nil || fields[3] == "" {
+		return imported
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, fields[3])
+	if err != nil {
+		imported.Err = fmt.Errorf("%w: malformed expires_at %q", domain.ErrorInvalidInput, fields[3])
+
+		return imported
+	}
+
+	imported.User.ExpiresAt = expiresAt
+
+	return imported
+}
+
+func newImportRecord(line int, id, name, email string) domain.ImportRecord {
+	record := domain.ImportRecord{
+		Line: line,
+		User: domain.User{Name: name, Email: email},
+	}
+
+	if id == "" {
+		return record
+	}
+
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		record.Err = fmt.Errorf("%w: malformed id %q", domain.ErrorInvalidInput, id)
+
+		return record
+	}
+
+	record.User.ID = parsed
+
+	return record
+}
+
+func transferFormat(format *TransferFormat) (TransferFormat, error) {
+	if format == nil {
+		return Ndjson, nil
+	}
+
+	return ParseTransferFormat(string(*format))
+}
+
+func ParseTransferFormat(format string) (TransferFormat, error) {
+	switch TransferFormat(format) {
+	case Ndjson, Csv:
+		return TransferFormat(format), nil
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func contentType(format TransferFormat) string {
+	if format == Csv {
+		return mimeCSV
+	}
+
+	return mimeNDJSON
+}
@@ -0,0 +1,197 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	apiExport = "/api/user:export"
+	apiImport = "/api/user:import"
+)
+
+func exportedUsers(users []domain.User, err error) iter.Seq2[domain.User, error] {
+	return func(yield func(domain.User, error) bool) {
+		for _, user := range users {
+			if !yield(user, nil) {
+				return
+			}
+		}
+
+		if err != nil {
+			yield(domain.User{}, err)
+		}
+	}
+}
+
+// importUsers stands in for the application, rejecting the records the driver could not decode
+func importUsers(_ context.Context, records iter.Seq[domain.ImportRecord], report func(domain.ImportResult) error) error {
+	for record := range records {
+		err := report(domain.ImportResult{Line: record.Line, ID: record.User.ID, Err: record.Err})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *HttpServerTestSuite) TestExportUsers() {
+	users := []domain.User{
+		{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email()},
+		{ID: uuid.New(), Name: "with, comma"},
+	}
+
+	s.Run("ndjson", func() {
+		expected := fmt.Sprintf("{\"email\":%q,\"id\":%q,\"name\":%q}\n{\"id\":%q,\"name\":%q}\n",
+			users[0].Email, users[0].ID, users[0].Name, users[1].ID, users[1].Name)
+		s.app.On("ExportUsers", mock.Anything).Return(exportedUsers(users, nil)).Once()
+		s.tester.GET(apiExport).
+			Expect().
+			Status(http.StatusOK).
+			ContentType(mimeNDJSON).
+			Body().IsEqual(expected)
+	})
+
+	s.Run("csv", func() {
+		expected := fmt.Sprintf("id,name,email,expires_at\n%s,%s,%s,\n%s,\"%s\",,\n",
+			users[0].ID, users[0].Name, users[0].Email, users[1].ID, users[1].Name)
+		s.app.On("ExportUsers", mock.Anything).Return(exportedUsers(users, nil)).Once()
+		s.tester.GET(apiExport).
+			WithQuery("format", Csv).
+			Expect().
+			Status(http.StatusOK).
+			ContentType(mimeCSV).
+			Body().IsEqual(expected)
+	})
+
+	s.Run("unknown format", func() {
+		s.tester.GET(apiExport).
+			WithQuery("format", "xml").
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	s.Run("error in app", func() {
+		s.app.On("ExportUsers", mock.Anything).Return(exportedUsers(nil, fakeError)).Once()
+		s.tester.GET(apiExport).
+			Expect().
+			Status(http.StatusInternalServerError)
+	})
+}
+
+func (s *HttpServerTestSuite) TestImportUsers() {
+	id := uuid.New()
+	name := gofakeit.Username()
+
+	s.Run("ndjson", func() {
+		s.app.On("ImportUsers", mock.Anything, mock.Anything, mock.Anything).Return(importUsers).Once()
+		report := s.tester.POST(apiImport).
+			WithHeader(echo.HeaderContentType, mimeNDJSON).
+			WithText(fmt.Sprintf("{\"id\":%q,\"name\":%q}\n\nnot json\n{\"id\":\"42\",\"name\":%q}\n", id, name, name)).
+			Expect().
+			Status(http.StatusOK).JSON().Object()
+		report.HasValue("imported", 1).HasValue("failed", 2)
+		errs := report.Value("errors").Array()
+		errs.Length().IsEqual(2)
+		errs.Element(0).Object().HasValue("line", 3)
+		errs.Element(1).Object().HasValue("line", 4).NotContainsKey("id")
+	})
+
+	s.Run("csv", func() {
+		s.app.On("ImportUsers", mock.Anything, mock.Anything, mock.Anything).Return(importUsers).Once()
+		report := s.tester.POST(apiImport).
+			WithQuery("format", Csv).
+			WithHeader(echo.HeaderContentType, mimeCSV).
+			WithText(fmt.Sprintf("id,name\n%s,%s\n%s\n", id, name, id)).
+			Expect().
+			Status(http.StatusOK).JSON().Object()
+		report.HasValue("imported", 1).HasValue("failed", 1)
+		report.Value("errors").Array().Element(0).Object().HasValue("line", 3)
+	})
+
+	s.Run("csv without header", func() {
+		s.app.On("ImportUsers", mock.Anything, mock.Anything, mock.Anything).Return(importUsers).Once()
+		s.tester.POST(apiImport).
+			WithQuery("format", Csv).
+			WithText(fmt.Sprintf("%s,%s\n", id, name)).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			HasValue("imported", 0).HasValue("failed", 1)
+	})
+
+	s.Run("error in app", func() {
+		s.app.On("ImportUsers", mock.Anything, mock.Anything, mock.Anything).Return(fakeError).Once()
+		s.tester.POST(apiImport).
+			WithText("").
+			Expect().
+			Status(http.StatusInternalServerError)
+	})
+}
+
+func (s *HttpServerTestSuite) TestTransferRoundTrip() {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	users := []domain.User{
+		{ID: uuid.New(), Name: gofakeit.Username(), Email: gofakeit.Email(), ExpiresAt: expiresAt},
+		{ID: uuid.New(), Name: "with, comma"},
+	}
+
+	for _, format := range []TransferFormat{Ndjson, Csv} {
+		s.Run(string(format), func() {
+			s.app.On("ExportUsers", mock.Anything).Return(exportedUsers(users, nil)).Once()
+			exported := s.tester.GET(apiExport).
+				WithQuery("format", format).
+				Expect().
+				Status(http.StatusOK).
+				Body().Raw()
+
+			var imported []domain.User
+
+			s.app.On("ImportUsers", mock.Anything, mock.Anything, mock.Anything).Return(
+				func(ctx context.Context, records iter.Seq[domain.ImportRecord], report func(domain.ImportResult) error) error {
+					return importUsers(ctx, func(yield func(domain.ImportRecord) bool) {
+						for record := range records {
+							imported = append(imported, record.User)
+
+							if !yield(record) {
+								return
+							}
+						}
+					}, report)
+				}).Once()
+			s.tester.POST(apiImport).
+				WithQuery("format", format).
+				WithText(exported).
+				Expect().
+				Status(http.StatusOK).JSON().Object().
+				HasValue("imported", len(users)).HasValue("failed", 0)
+
+			s.Require().Len(imported, len(users))
+			s.Require().Equal(users[1], imported[1])
+			s.Require().Equal(users[0].ID, imported[0].ID)
+			s.Require().Equal(users[0].Email, imported[0].Email)
+			s.Require().True(expiresAt.Equal(imported[0].ExpiresAt))
+		})
+	}
+}
+
+func (s *HttpServerTestSuite) TestDecodeUsers() {
+	records := slices.Collect(decodeUsers(
+		strings.NewReader("{\"id\":\""+uuid.NewString()+"\",\"name\":\"a\"}\n{\"name\":\"b\"}\n"), Ndjson))
+	s.Require().Len(records, 2)
+	s.Require().Equal(1, records[0].Line)
+	s.Require().Equal("b", records[1].User.Name)
+	s.Require().Equal(uuid.Nil, records[1].User.ID)
+}
@@ -0,0 +1,248 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func (h HTTPServer) WatchUsers(ctx echo.Context) error {
+	conn, err := h.upgrader.Upgrade(ctx.Response(), ctx.Request(), nil)
+	if err != nil {
+		// the upgrader has already responded with the error
+		return nil //nolint:nilerr
+	}
+
+	streamCtx, done := h.streams.open(ctx.Request().Context())
+	defer done()
+
+	newWatcher(conn, h.watch).run(streamCtx, h.events)
+
+	return nil
+}
+
+// watcher serves one websocket, it sends update and delete events of the users the client subscribed to
+type watcher struct {
+	conn    *websocket.Conn
+	cfg     config.WebSocketConfig
+	replies chan WatchMessage
+
+	mu          sync.Mutex
+	ids         map[string]struct{}
+	closeCode   int
+	closeReason string
+}
+
+func newWatcher(conn *websocket.Conn, cfg config.WebSocketConfig) *watcher {
+	return &watcher{
+		conn:    conn,
+		cfg:     cfg,
+		replies: make(chan WatchMessage, cfg.Buffer),
+		ids:     make(map[string]struct{}),
+	}
+}
+
+func (w *watcher) run(ctx context.Context, subscriber domain.EventSubscriber) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := subscriber.Subscribe(ctx, "")
+	if err != nil {
+		w.close(websocket.CloseInternalServerErr, "error subscribing to events")
+
+		return
+	}
+
+	readDone := make(chan struct{})
+
+	go func() {
+		defer close(readDone)
+		defer cancel()
+		w.read()
+	}()
+
+	code, reason := w.write(ctx, events)
+	w.close(code, reason)
+
+	<-readDone
+}
+
+// read handles the client requests until the connection breaks or the client sends faster than it reads
+func (w *watcher) read() {
+	w.conn.SetReadLimit(w.cfg.MaxMessageSize)
+	_ = w.conn.SetReadDeadline(time.Now().Add(w.cfg.PongTimeout))
+	w.conn.SetPongHandler(func(string) error {
+		return w.conn.SetReadDeadline(time.Now().Add(w.cfg.PongTimeout))
+	})
+
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			// the client closed the connection or stopped answering pings
+			w.setClose(websocket.CloseNormalClosure, "")
+
+			return
+		}
+
+		select {
+		case w.replies <- w.handle(data):
+		default:
+			w.setClose(websocket.ClosePolicyViolation, "too many requests without reading the replies")
+
+			return
+		}
+	}
+}
+
+func (w *watcher) handle(data []byte) WatchMessage {
+	var request WatchRequest
+
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		return watchError("malformed request: %s", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch request.Action {
+	case Subscribe:
+		added := 0
+
+		for _, id := range request.Ids {
+			if _, ok := w.ids[id.String()]; !ok {
+				added++
+			}
+		}
+
+		if len(w.ids)+added > w.cfg.MaxSubscriptions {
+			return watchError("at most %d users can be watched", w.cfg.MaxSubscriptions)
+		}
+
+		for _, id := range request.Ids {
+			w.ids[id.String()] = struct{}{}
+		}
+
+		return WatchMessage{Type: Subscribed, Ids: &request.Ids}
+	case Unsubscribe:
+		for _, id := range request.Ids {
+			delete(w.ids, id.String())
+		}
+
+		return WatchMessage{Type: Unsubscribed, Ids: &request.Ids}
+	default:
+		return watchError("unknown action %q", request.Action)
+	}
+}
+
+// write sends replies, events and pings until the connection ends and returns why it ended
+func (w *watcher) write(ctx context.Context, events <-chan domain.StreamEvent) (code int, reason string) {
+	ping := time.NewTicker(w.cfg.PingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-ctx.Done():
+			return w.closing()
+		case <-ping.C:
+			err = w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.cfg.WriteTimeout))
+		case reply := <-w.replies:
+			err = w.send(reply)
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return w.closing()
+				}
+
+				// the hub cut us off, the client can reconnect and subscribe again
+				return websocket.CloseTryAgainLater, "fell behind the event stream"
+			}
+
+			if !w.watching(event.Event) {
+				continue
+			}
+
+			userEvent, convErr := toUserEvent(event.Event)
+			if convErr != nil {
+				continue
+			}
+
+			err = w.send(WatchMessage{Type: Event, Event: &userEvent})
+		}
+
+		if err != nil {
+			// the connection is broken, there is nobody left to tell
+			return 0, ""
+		}
+	}
+}
+
+// watching reports whether the client is told about the event, users are watched once they exist
+func (w *watcher) watching(event domain.Event) bool {
+	switch event.Type {
+	case domain.EventUserUpdated, domain.EventUserDeleted, domain.EventUserExpired:
+	default:
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.ids[event.UserID]
+
+	return ok
+}
+
+func (w *watcher) send(message WatchMessage) error {
+	err := w.conn.SetWriteDeadline(time.Now().Add(w.cfg.WriteTimeout))
+	if err != nil {
+		return fmt.Errorf("error setting write deadline: %w", err)
+	}
+
+	return w.conn.WriteJSON(message)
+}
+
+func (w *watcher) setClose(code int, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closeCode = code
+	w.closeReason = reason
+}
+
+// closing picks the close code once the context is done, which is either the reader giving up or shutdown
+func (w *watcher) closing() (code int, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closeCode != 0 {
+		return w.closeCode, w.closeReason
+	}
+
+	return websocket.CloseGoingAway, "server is shutting down"
+}
+
+func (w *watcher) close(code int, reason string) {
+	if code != 0 {
+		_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(w.cfg.WriteTimeout))
+	}
+
+	_ = w.conn.Close()
+}
+
+func watchError(format string, args ...any) WatchMessage {
+	message := fmt.Sprintf(format, args...)
+
+	return WatchMessage{Type: Error, Error: &message}
+}
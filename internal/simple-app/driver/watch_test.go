@@ -0,0 +1,134 @@
+package driver
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	apiUserWatch = "/api/user/watch"
+)
+
+func (s *HttpServerTestSuite) dialWatch(baseURL string) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(baseURL, "http")+apiUserWatch, nil)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+
+	return conn
+}
+
+func (s *HttpServerTestSuite) readWatchMessage(conn *websocket.Conn) WatchMessage {
+	var message WatchMessage
+
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	s.Require().NoError(conn.ReadJSON(&message))
+
+	return message
+}
+
+func (s *HttpServerTestSuite) TestWatchUsers() {
+	ctx := context.Background()
+	watched := uuid.New()
+
+	newStreamEvent := func(eventType domain.EventType, id uuid.UUID) domain.StreamEvent {
+		return domain.StreamEvent{
+			StreamID: "1700000000000-0",
+			Event:    domain.NewEvent(ctx, eventType, id.String(), gofakeit.Username()),
+		}
+	}
+
+	s.Run("subscribe and receive events", func() {
+		events := make(chan domain.StreamEvent)
+		s.events.On("Subscribe", mock.Anything, "").Return((<-chan domain.StreamEvent)(events), nil).Once()
+
+		conn := s.dialWatch(s.url)
+		defer conn.Close()
+
+		s.Require().NoError(conn.WriteJSON(WatchRequest{Action: Subscribe, Ids: []uuid.UUID{watched}}))
+		message := s.readWatchMessage(conn)
+		s.Equal(Subscribed, message.Type)
+		s.Equal([]uuid.UUID{watched}, *message.Ids)
+
+		events <- newStreamEvent(domain.EventUserCreated, watched)
+		events <- newStreamEvent(domain.EventUserUpdated, uuid.New())
+		updated := newStreamEvent(domain.EventUserUpdated, watched)
+		events <- updated
+
+		message = s.readWatchMessage(conn)
+		s.Equal(Event, message.Type)
+		s.Equal(updated.Event.ID, message.Event.Id)
+		s.Equal(watched, message.Event.UserId)
+
+		s.Require().NoError(conn.WriteJSON(WatchRequest{Action: Unsubscribe, Ids: []uuid.UUID{watched}}))
+		s.Equal(Unsubscribed, s.readWatchMessage(conn).Type)
+
+		events <- newStreamEvent(domain.EventUserDeleted, watched)
+		close(events)
+
+		_, _, err := conn.ReadMessage()
+		s.True(websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+	})
+
+	s.Run("invalid requests", func() {
+		events := make(chan domain.StreamEvent)
+		s.events.On("Subscribe", mock.Anything, "").Return((<-chan domain.StreamEvent)(events), nil).Once()
+
+		conn := s.dialWatch(s.url)
+		defer conn.Close()
+
+		s.Require().NoError(conn.WriteMessage(websocket.TextMessage, []byte("{")))
+		s.Equal(Error, s.readWatchMessage(conn).Type)
+
+		s.Require().NoError(conn.WriteJSON(WatchRequest{Action: "watch", Ids: []uuid.UUID{watched}}))
+		s.Equal(Error, s.readWatchMessage(conn).Type)
+
+		s.Require().NoError(conn.WriteJSON(WatchRequest{Action: Subscribe, Ids: []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}}))
+		message := s.readWatchMessage(conn)
+		s.Equal(Error, message.Type)
+		s.Contains(*message.Error, "at most 2 users")
+	})
+
+	s.Run("error in subscriber", func() {
+		s.events.On("Subscribe", mock.Anything, "").Return(nil, fakeError).Once()
+
+		conn := s.dialWatch(s.url)
+		defer conn.Close()
+
+		_, _, err := conn.ReadMessage()
+		s.True(websocket.IsCloseError(err, websocket.CloseInternalServerErr), err)
+	})
+}
+
+func (s *HttpServerTestSuite) TestWatchUsersShutdown() {
+	events := mocks.NewEventSubscriber(s.T())
+	server := NewHTTPServer(testConfig, s.app, s.webhooks, s.tenants, events, s.newGraphQL(), s.readiness)
+	e := echo.New()
+	RegisterHandlers(NewRouter(e), server)
+
+	ts := httptest.NewServer(e)
+
+	events.On("Subscribe", mock.Anything, "").Return((<-chan domain.StreamEvent)(make(chan domain.StreamEvent)), nil).Once()
+
+	conn := s.dialWatch(ts.URL)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.Require().NoError(server.ShutdownStreams(ctx))
+	s.Require().NoError(ts.Config.Shutdown(ctx))
+
+	_, _, err := conn.ReadMessage()
+	s.True(websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
@@ -0,0 +1,227 @@
+package driver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func (h HTTPServer) ListWebhooks(ctx echo.Context) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	webhooks, err := h.webhooks.ListWebhooks(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	response := make([]Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, toWebhook(webhook, false))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h HTTPServer) CreateWebhook(ctx echo.Context) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	var webhookRequest WebhookRequest
+
+	err := ctx.Bind(&webhookRequest)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	webhook, err := h.webhooks.CreateWebhook(ctx.Request().Context(), webhookRequest.Url, fromEventTypes(webhookRequest.Events))
+	if err != nil {
+		if errors.Is(err, domain.ErrorInvalidInput) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, toWebhook(webhook, true))
+}
+
+func (h HTTPServer) DeleteWebhook(ctx echo.Context, id uuid.UUID) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	err := h.webhooks.DeleteWebhook(ctx.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.NoContent(http.StatusOK)
+}
+
+func (h HTTPServer) GetWebhook(ctx echo.Context, id uuid.UUID) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	webhook, err := h.webhooks.GetWebhook(ctx.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, toWebhook(webhook, false))
+}
+
+func (h HTTPServer) UpdateWebhook(ctx echo.Context, id uuid.UUID) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	var webhookRequest WebhookRequest
+
+	err := ctx.Bind(&webhookRequest)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	webhook, err := h.webhooks.UpdateWebhook(ctx.Request().Context(), id, webhookRequest.Url, fromEventTypes(webhookRequest.Events))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrorNotFound):
+			return ctx.NoContent(http.StatusNotFound)
+		case errors.Is(err, domain.ErrorInvalidInput):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, toWebhook(webhook, false))
+}
+
+func (h HTTPServer) ListWebhookDeliveries(ctx echo.Context, id uuid.UUID) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	attempts, err := h.webhooks.ListDeliveryAttempts(ctx.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	response := make([]WebhookDeliveryAttempt, 0, len(attempts))
+
+	for _, attempt := range attempts {
+		item := WebhookDeliveryAttempt{
+			At:         attempt.At,
+			Attempt:    attempt.Attempt,
+			DeliveryId: attempt.DeliveryID,
+			EventId:    attempt.EventID,
+			EventType:  EventType(attempt.EventType),
+			Status:     WebhookDeliveryAttemptStatus(attempt.Status),
+		}
+
+		if attempt.StatusCode != 0 {
+			item.StatusCode = &attempt.StatusCode
+		}
+
+		if attempt.Error != "" {
+			item.Error = &attempt.Error
+		}
+
+		response = append(response, item)
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h HTTPServer) ListWebhookDeadLetters(ctx echo.Context, id uuid.UUID) error {
+	if h.webhooks == nil {
+		return webhooksUnavailable()
+	}
+
+	deliveries, err := h.webhooks.ListDeadLetters(ctx.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrorNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	response := make([]WebhookDeadLetter, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		item := WebhookDeadLetter{
+			Attempts:   delivery.Attempt,
+			DeliveryId: delivery.ID,
+			EventId:    delivery.Event.ID,
+			EventType:  EventType(delivery.Event.Type),
+			UserId:     delivery.Event.UserID,
+		}
+
+		if delivery.LastError != "" {
+			item.LastError = &delivery.LastError
+		}
+
+		response = append(response, item)
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// webhooksUnavailable answers the webhook endpoints while redis is not the storage, the webhooks are only kept there
+func webhooksUnavailable() error {
+	return echo.NewHTTPError(http.StatusNotImplemented, "webhooks need the redis storage")
+}
+
+func toWebhook(webhook domain.Webhook, withSecret bool) Webhook {
+	events := make([]EventType, 0, len(webhook.Events))
+	for _, eventType := range webhook.Events {
+		events = append(events, EventType(eventType))
+	}
+
+	response := Webhook{
+		CreatedAt: webhook.CreatedAt,
+		Events:    events,
+		Id:        webhook.ID,
+		Url:       webhook.URL,
+	}
+
+	if withSecret {
+		response.Secret = &webhook.Secret
+	}
+
+	return response
+}
+
+func fromEventTypes(eventTypes *[]EventType) []domain.EventType {
+	if eventTypes == nil {
+		return nil
+	}
+
+	events := make([]domain.EventType, 0, len(*eventTypes))
+	for _, eventType := range *eventTypes {
+		events = append(events, domain.EventType(eventType))
+	}
+
+	return events
+}
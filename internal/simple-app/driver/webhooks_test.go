@@ -0,0 +1,212 @@
+package driver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain/mocks"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	apiWebhooks = "/api/webhooks"
+)
+
+func (s *HttpServerTestSuite) TestCreateWebhook() {
+	webhook := domain.Webhook{
+		ID:        uuid.New(),
+		URL:       gofakeit.URL(),
+		Secret:    gofakeit.Word(),
+		Events:    []domain.EventType{domain.EventUserCreated},
+		CreatedAt: time.Now().UTC(),
+	}
+	events := []EventType{UserCreated}
+
+	s.Run("happy case", func() {
+		s.webhooks.On("CreateWebhook", mock.Anything, webhook.URL, webhook.Events).Return(webhook, nil).Once()
+		s.tester.POST(apiWebhooks).
+			WithJSON(WebhookRequest{Url: webhook.URL, Events: &events}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			HasValue("id", webhook.ID).
+			HasValue("url", webhook.URL).
+			HasValue("secret", webhook.Secret)
+	})
+
+	s.Run("invalid input", func() {
+		err := fmt.Errorf("%w: webhook url must be an absolute http or https url", domain.ErrorInvalidInput)
+		s.webhooks.On("CreateWebhook", mock.Anything, webhook.URL, webhook.Events).Return(domain.Webhook{}, err).Once()
+		s.tester.POST(apiWebhooks).
+			WithJSON(WebhookRequest{Url: webhook.URL, Events: &events}).
+			Expect().
+			Status(http.StatusBadRequest).JSON().Object().HasValue("message", err.Error())
+	})
+
+	s.Run("error in app", func() {
+		s.webhooks.On("CreateWebhook", mock.Anything, webhook.URL, webhook.Events).Return(domain.Webhook{}, fakeError).Once()
+		s.tester.POST(apiWebhooks).
+			WithJSON(WebhookRequest{Url: webhook.URL, Events: &events}).
+			Expect().
+			Status(http.StatusInternalServerError).JSON().Object().HasValue("message", fakeError.Error())
+	})
+}
+
+func (s *HttpServerTestSuite) TestGetWebhook() {
+	webhook := domain.Webhook{ID: uuid.New(), URL: gofakeit.URL(), Secret: gofakeit.Word()}
+
+	s.Run("happy case", func() {
+		s.webhooks.On("GetWebhook", mock.Anything, webhook.ID).Return(webhook, nil).Once()
+		s.tester.GET(apiWebhooks+"/"+webhook.ID.String()).
+			Expect().
+			Status(http.StatusOK).JSON().Object().
+			HasValue("url", webhook.URL).
+			NotContainsKey("secret")
+	})
+
+	s.Run("not found", func() {
+		s.webhooks.On("GetWebhook", mock.Anything, webhook.ID).Return(domain.Webhook{}, domain.ErrorNotFound).Once()
+		s.tester.GET(apiWebhooks + "/" + webhook.ID.String()).
+			Expect().
+			Status(http.StatusNotFound).NoContent()
+	})
+}
+
+func (s *HttpServerTestSuite) TestListWebhooks() {
+	webhooks := []domain.Webhook{
+		{ID: uuid.New(), URL: gofakeit.URL()},
+		{ID: uuid.New(), URL: gofakeit.URL()},
+	}
+
+	s.webhooks.On("ListWebhooks", mock.Anything).Return(webhooks, nil).Once()
+	s.tester.GET(apiWebhooks).
+		Expect().
+		Status(http.StatusOK).JSON().Array().Length().IsEqual(2)
+}
+
+func (s *HttpServerTestSuite) TestUpdateWebhook() {
+	webhook := domain.Webhook{ID: uuid.New(), URL: gofakeit.URL()}
+
+	s.Run("happy case", func() {
+		s.webhooks.On("UpdateWebhook", mock.Anything, webhook.ID, webhook.URL, []domain.EventType(nil)).Return(webhook, nil).Once()
+		s.tester.POST(apiWebhooks+"/"+webhook.ID.String()).
+			WithJSON(WebhookRequest{Url: webhook.URL}).
+			Expect().
+			Status(http.StatusOK).JSON().Object().HasValue("url", webhook.URL)
+	})
+
+	s.Run("not found", func() {
+		s.webhooks.On("UpdateWebhook", mock.Anything, webhook.ID, webhook.URL, []domain.EventType(nil)).
+			Return(domain.Webhook{}, domain.ErrorNotFound).Once()
+		s.tester.POST(apiWebhooks + "/" + webhook.ID.String()).
+			WithJSON(WebhookRequest{Url: webhook.URL}).
+			Expect().
+			Status(http.StatusNotFound).NoContent()
+	})
+}
+
+func (s *HttpServerTestSuite) TestDeleteWebhook() {
+	id := uuid.New()
+
+	s.Run("happy case", func() {
+		s.webhooks.On("DeleteWebhook", mock.Anything, id).Return(nil).Once()
+		s.tester.DELETE(apiWebhooks + "/" + id.String()).
+			Expect().
+			Status(http.StatusOK).NoContent()
+	})
+
+	s.Run("not found", func() {
+		s.webhooks.On("DeleteWebhook", mock.Anything, id).Return(domain.ErrorNotFound).Once()
+		s.tester.DELETE(apiWebhooks + "/" + id.String()).
+			Expect().
+			Status(http.StatusNotFound).NoContent()
+	})
+}
+
+func (s *HttpServerTestSuite) TestListWebhookDeliveries() {
+	id := uuid.New()
+	attempts := []domain.DeliveryAttempt{
+		{
+			DeliveryID: gofakeit.UUID(),
+			EventID:    gofakeit.UUID(),
+			EventType:  domain.EventUserUpdated,
+			Attempt:    2,
+			StatusCode: http.StatusBadGateway,
+			Error:      "webhook responded with status 502",
+			Status:     domain.DeliveryRetrying,
+			At:         time.Now().UTC(),
+		},
+	}
+
+	s.webhooks.On("ListDeliveryAttempts", mock.Anything, id).Return(attempts, nil).Once()
+	s.tester.GET(apiWebhooks+"/"+id.String()+"/deliveries").
+		Expect().
+		Status(http.StatusOK).JSON().Array().Value(0).Object().
+		HasValue("status", "retrying").
+		HasValue("status_code", http.StatusBadGateway).
+		HasValue("attempt", 2)
+}
+
+func (s *HttpServerTestSuite) TestListWebhookDeadLetters() {
+	id := uuid.New()
+	deliveries := []domain.WebhookDelivery{
+		{
+			ID:        gofakeit.UUID(),
+			WebhookID: id.String(),
+			Event:     domain.Event{ID: gofakeit.UUID(), Type: domain.EventUserDeleted, UserID: gofakeit.UUID()},
+			Attempt:   8,
+			LastError: "connection refused",
+		},
+	}
+
+	s.Run("happy case", func() {
+		s.webhooks.On("ListDeadLetters", mock.Anything, id).Return(deliveries, nil).Once()
+		s.tester.GET(apiWebhooks+"/"+id.String()+"/dead-letters").
+			Expect().
+			Status(http.StatusOK).JSON().Array().Value(0).Object().
+			HasValue("attempts", 8).
+			HasValue("last_error", "connection refused")
+	})
+
+	s.Run("not found", func() {
+		s.webhooks.On("ListDeadLetters", mock.Anything, id).Return(nil, domain.ErrorNotFound).Once()
+		s.tester.GET(apiWebhooks + "/" + id.String() + "/dead-letters").
+			Expect().
+			Status(http.StatusNotFound).NoContent()
+	})
+}
+
+func TestWithoutRedis(t *testing.T) {
+	cfg := &config.Config{Tenant: config.TenantConfig{AdminToken: testAdminToken}}
+	graphql, err := NewGraphQL(cfg, new(mocks.ApplicationInterface))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(AdminMiddleware(cfg))
+	RegisterHandlers(NewRouter(e), NewHTTPServer(cfg, new(mocks.ApplicationInterface), nil, nil,
+		new(mocks.EventSubscriber), graphql, new(mocks.Readiness)))
+
+	serve := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, bearerPrefix+testAdminToken)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusNotImplemented, serve(http.MethodGet, apiWebhooks))
+	require.Equal(t, http.StatusNotImplemented, serve(http.MethodDelete, apiWebhooks+"/"+uuid.NewString()))
+	require.Equal(t, http.StatusNotImplemented, serve(http.MethodGet, apiTenants))
+	require.Equal(t, http.StatusNotImplemented, serve(http.MethodDelete, apiTenants+"/acme"))
+}
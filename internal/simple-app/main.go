@@ -6,11 +6,15 @@ import (
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven"
 	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driver/pb"
 
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 
 	echoZapMiddleware "github.com/adlandh/echo-zap-middleware"
 	"github.com/labstack/echo/v4"
@@ -19,9 +23,20 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
+const importPath = "/api/user:import"
+
 func main() {
+	// without a command the binary serves, so images that run it bare keep working
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	fx.New(createService()).Run()
 }
 
@@ -32,41 +47,302 @@ func createService() fx.Option {
 				return &fxevent.ZapLogger{Logger: log}
 			},
 		),
+		createCore(),
 		fx.Provide(
-			config.NewConfig,
+			newMemoryEventStream,
+			newEventPublishers,
+			newEventStream,
+			newWebhookStorage,
+			newWebhookSender,
+			newWebhookApplication,
 			fx.Annotate(
-				zap.NewDevelopment,
+				application.NewEventHub,
+				fx.As(new(domain.EventSubscriber)),
 			),
+			newTenantApplication,
+			driver.NewTenantResolver,
+			driver.NewGraphQL,
+			driver.NewHTTPServer,
+			driver.NewGRPCServer,
+		),
+		fx.Invoke(
+			application.NewOutboxRelay,
+			newWebhookDispatcher,
+			application.NewExpirySweeper,
+			newEcho,
+			newGRPC,
+		),
+	)
+}
+
+// createCore provides the storage and the application, which the commands need as well as the service
+func createCore() fx.Option {
+	return fx.Options(
+		createStorage(),
+		fx.Provide(
+			newTenantStorage,
 			fx.Annotate(
-				driven.NewRedisStorage,
+				newUserStorage,
 				fx.As(new(domain.UserStorage)),
+				fx.As(new(domain.Outbox)),
+				fx.As(new(domain.UserExpiry)),
 			),
 			fx.Annotate(
 				application.NewApplication,
 				fx.As(new(domain.ApplicationInterface)),
 			),
-			fx.Annotate(
-				driver.NewHTTPServer,
-				fx.As(new(driver.ServerInterface)),
-			),
 		),
-		fx.Invoke(
-			newEcho,
+	)
+}
+
+// createStorage provides the storage without the decorators, for the commands that work on the storage alone
+func createStorage() fx.Option {
+	return fx.Provide(
+		config.NewConfig,
+		fx.Annotate(
+			zap.NewDevelopment,
+		),
+		newRedisStorage,
+		driven.NewKeyRing,
+		fx.Annotate(
+			openUserStorage,
+			fx.As(fx.Self()),
+			fx.As(new(domain.Readiness)),
 		),
 	)
 }
 
-func newEcho(lc fx.Lifecycle, server driver.ServerInterface, cfg *config.Config, log *zap.Logger) *echo.Echo {
+// userStorage keeps the users together with the outbox of their events, so both change in one transaction.
+// The service is ready once the storage is
+type userStorage interface {
+	domain.UserStorage
+	domain.Outbox
+	domain.UserExpiry
+	domain.Readiness
+}
+
+// newRedisStorage is nil unless redis is the storage, the other storages run without redis
+func newRedisStorage(lc fx.Lifecycle, cfg *config.Config, log *zap.Logger) (*driven.RedisStorage, error) {
+	if cfg.Storage != config.StorageRedis {
+		return nil, nil
+	}
+
+	return driven.NewRedisStorage(lc, cfg, log)
+}
+
+func newUserStorage(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	storage userStorage,
+	keys *driven.KeyRing,
+	redisStorage *driven.RedisStorage,
+	log *zap.Logger,
+) (userStorage, error) {
+	if keys == nil && !cfg.Resilience.Enabled && !cfg.Cache.Enabled {
+		return storage, nil
+	}
+
+	var (
+		users domain.UserStorage = storage
+		cache *driven.CachedStorage
+		err   error
+	)
+
+	if cfg.Resilience.Enabled {
+		users = driven.NewResilientStorage(cfg, users, log)
+	}
+
+	// the names are encrypted outside the retries, a value that cannot be decrypted is not the storage failing
+	// and must not open the breaker. The cache keeps the readable users
+	if keys != nil {
+		users = driven.NewEncryptedStorage(keys, users)
+	}
+
+	// the cache goes in front, so hits are served even while the breaker is open
+	if cfg.Cache.Enabled {
+		// without redis there is no channel to the other replicas, each one only drops the users it changed
+		var invalidator driven.CacheInvalidator
+		if redisStorage != nil {
+			invalidator = driven.NewRedisCacheInvalidator(lc, cfg, redisStorage, log)
+		}
+
+		cache, err = driven.NewCachedStorage(cfg, users, invalidator, log)
+		if err != nil {
+			return nil, err
+		}
+
+		users = cache
+	}
+
+	return decoratedUserStorage{UserStorage: users, Outbox: storage, UserExpiry: storage, Readiness: storage, cache: cache}, nil
+}
+
+// newTenantStorage purges the tenants from the cache as well as from redis, it is nil without redis
+func newTenantStorage(storage *driven.RedisStorage, users domain.UserStorage) domain.TenantStorage {
+	if storage == nil {
+		return nil
+	}
+
+	if decorated, ok := users.(decoratedUserStorage); ok && decorated.cache != nil {
+		return driven.NewCachedTenantStorage(storage, decorated.cache)
+	}
+
+	return storage
+}
+
+func newTenantApplication(log *zap.Logger, storage domain.TenantStorage) domain.TenantApplicationInterface {
+	if storage == nil {
+		return nil
+	}
+
+	return application.NewTenantApplication(log, storage)
+}
+
+// newMemoryEventStream keeps the events in memory when there is no redis stream, it is nil with redis
+func newMemoryEventStream(cfg *config.Config, storage *driven.RedisStorage) *driven.MemoryEventStream {
+	if storage != nil {
+		return nil
+	}
+
+	return driven.NewMemoryEventStream(cfg)
+}
+
+// newEventPublishers are where the outbox relay delivers the events to, the stream and the webhooks while there are any
+func newEventPublishers(
+	cfg *config.Config,
+	storage *driven.RedisStorage,
+	memory *driven.MemoryEventStream,
+	webhooks domain.WebhookStorage,
+) []domain.EventPublisher {
+	if storage == nil {
+		return []domain.EventPublisher{memory}
+	}
+
+	return []domain.EventPublisher{
+		driven.NewRedisStreamPublisher(cfg, storage),
+		application.NewWebhookPublisher(webhooks),
+	}
+}
+
+// newEventStream decrypts the names in the events, which are encrypted all the way from the outbox
+func newEventStream(
+	cfg *config.Config,
+	storage *driven.RedisStorage,
+	memory *driven.MemoryEventStream,
+	keys *driven.KeyRing,
+	log *zap.Logger,
+) domain.EventStream {
+	var stream domain.EventStream = memory
+	if storage != nil {
+		stream = driven.NewRedisStreamReader(cfg, storage)
+	}
+
+	if keys == nil {
+		return stream
+	}
+
+	return driven.NewEncryptedEventStream(keys, stream, log)
+}
+
+// newWebhookStorage keeps the webhooks in redis, without redis there are no webhooks and it is nil
+func newWebhookStorage(storage *driven.RedisStorage) domain.WebhookStorage {
+	if storage == nil {
+		return nil
+	}
+
+	return driven.NewRedisWebhookStorage(storage)
+}
+
+func newWebhookSender(cfg *config.Config, keys *driven.KeyRing) domain.WebhookSender {
+	sender := driven.NewHTTPWebhookSender(cfg)
+	if keys == nil {
+		return sender
+	}
+
+	return driven.NewEncryptedWebhookSender(keys, sender)
+}
+
+func newWebhookApplication(log *zap.Logger, storage domain.WebhookStorage) domain.WebhookApplicationInterface {
+	if storage == nil {
+		return nil
+	}
+
+	return application.NewWebhookApplication(log, storage)
+}
+
+func newWebhookDispatcher(
+	lc fx.Lifecycle,
+	cfg *config.Config,
+	log *zap.Logger,
+	storage domain.WebhookStorage,
+	sender domain.WebhookSender,
+) {
+	if storage == nil {
+		return
+	}
+
+	application.NewWebhookDispatcher(lc, cfg, log, storage, sender)
+}
+
+// openUserStorage is the configured storage itself, without the decorators
+func openUserStorage(lc fx.Lifecycle, cfg *config.Config, redisStorage *driven.RedisStorage) (userStorage, error) {
+	// only the redis storage keeps the users of every tenant apart
+	if cfg.Tenant.Enabled && cfg.Storage != config.StorageRedis {
+		return nil, fmt.Errorf("tenants need the %s storage, not %s", config.StorageRedis, cfg.Storage)
+	}
+
+	switch cfg.Storage {
+	case config.StorageRedis:
+		return redisStorage, nil
+	case config.StoragePostgres:
+		return driven.NewPostgresStorage(lc, cfg)
+	case config.StorageBolt:
+		return driven.NewBoltStorage(lc, cfg)
+	}
+
+	return nil, fmt.Errorf("unknown storage %q, expected %s, %s or %s",
+		cfg.Storage, config.StorageRedis, config.StoragePostgres, config.StorageBolt)
+}
+
+// decoratedUserStorage goes through the decorators for the users, the outbox is read and the expired users are swept
+// straight from the storage, expiry events carry no name the encryption would have to hide
+type decoratedUserStorage struct {
+	domain.UserStorage
+	domain.Outbox
+	domain.UserExpiry
+	domain.Readiness
+
+	// cache is nil while the cache is disabled
+	cache *driven.CachedStorage
+}
+
+func newEcho(
+	lc fx.Lifecycle,
+	server *driver.HTTPServer,
+	tenants *driver.TenantResolver,
+	cfg *config.Config,
+	log *zap.Logger,
+) *echo.Echo {
 	e := echo.New()
 	e.Use(echoZapMiddleware.Middleware(log))
 	e.Use(middleware.Secure())
 	e.Use(middleware.Recover())
-	e.Use(middleware.BodyLimit("1M"))
+	e.Use(middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Limit: "1M",
+		// imports are streamed, so they are not held in memory whatever their size
+		Skipper: func(c echo.Context) bool {
+			return c.Request().URL.Path == importPath
+		},
+	}))
 	e.Use(middleware.RequestID())
+	e.Use(driver.AdminMiddleware(cfg))
+	e.Use(tenants.Middleware())
+	// the metrics expose the command line and the memory stats, so only admins get to see them
+	e.GET("/admin/debug/vars", echo.WrapHandler(expvar.Handler()))
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) (err error) {
-			driver.RegisterHandlers(e, server)
+			driver.RegisterHandlers(driver.NewRouter(e), server)
 			go func() {
 				err = e.Start(":" + cfg.Port)
 				if err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -76,7 +352,13 @@ func newEcho(lc fx.Lifecycle, server driver.ServerInterface, cfg *config.Config,
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			err := e.Shutdown(ctx)
+			// event streams and websockets never go idle, so they are ended before the server waits for idle connections
+			err := server.ShutdownStreams(ctx)
+			if err != nil {
+				return fmt.Errorf("error closing event streams: %w", err)
+			}
+
+			err = e.Shutdown(ctx)
 			if err != nil {
 				return fmt.Errorf("error shutting down echo server: %w", err)
 			}
@@ -86,3 +368,76 @@ func newEcho(lc fx.Lifecycle, server driver.ServerInterface, cfg *config.Config,
 
 	return e
 }
+
+func newGRPC(
+	lc fx.Lifecycle,
+	server *driver.GRPCServer,
+	readiness domain.Readiness,
+	tenants *driver.TenantResolver,
+	cfg *config.Config,
+	log *zap.Logger,
+) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tenants.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(tenants.StreamInterceptor()),
+	)
+	healthServer := health.NewServer()
+	// serving once the storage has answered, which may be after a degraded start
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	stop := make(chan struct{})
+
+	pb.RegisterUserServiceServer(s, server)
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			listener, err := new(net.ListenConfig).Listen(ctx, "tcp", ":"+cfg.GRPCPort)
+			if err != nil {
+				return fmt.Errorf("error listening on grpc port: %w", err)
+			}
+
+			go func() {
+				err := s.Serve(listener)
+				if err != nil {
+					log.Error("error serving grpc", zap.Error(err))
+				}
+			}()
+
+			go func() {
+				select {
+				case <-readiness.Ready():
+					healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+				case <-stop:
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+
+			// tells load balancers to move away before the in-flight calls are drained
+			healthServer.Shutdown()
+
+			stopped := make(chan struct{})
+
+			go func() {
+				s.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				s.Stop()
+
+				return fmt.Errorf("error stopping grpc server gracefully: %w", ctx.Err())
+			}
+		},
+	})
+
+	return s
+}
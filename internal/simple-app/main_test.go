@@ -1,13 +1,193 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/config"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/domain"
+	"github.com/adlandh/acorn-simple-app/internal/simple-app/driven"
+
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
 )
 
 func TestCreateService(t *testing.T) {
 	err := fx.ValidateApp(createService())
 	require.NoError(t, err)
 }
+
+func TestServiceWithoutRedis(t *testing.T) {
+	t.Setenv("STORAGE", config.StorageBolt)
+	t.Setenv("BOLT_PATH", filepath.Join(t.TempDir(), "users.db"))
+	t.Setenv("PORT", "0")
+	t.Setenv("GRPC_PORT", "0")
+	t.Setenv("OUTBOX_INTERVAL", "10ms")
+	t.Setenv("CACHE_ENABLED", "true")
+
+	var (
+		redis     *driven.RedisStorage
+		app       domain.ApplicationInterface
+		events    domain.EventSubscriber
+		readiness domain.Readiness
+	)
+
+	fxApp := fxtest.New(t, createService(), fx.Populate(&redis, &app, &events, &readiness))
+	fxApp.RequireStart()
+	t.Cleanup(fxApp.RequireStop)
+
+	require.Nil(t, redis)
+	require.Eventually(t, func() bool {
+		select {
+		case <-readiness.Ready():
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := events.Subscribe(ctx, "")
+	require.NoError(t, err)
+
+	id, err := app.CreateUser(ctx, "name", "", time.Time{})
+	require.NoError(t, err)
+
+	// the outbox is relayed to the events kept in memory
+	select {
+	case event := <-subscription:
+		require.Equal(t, domain.EventUserCreated, event.Event.Type)
+		require.Equal(t, id.String(), event.Event.UserID)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no event")
+	}
+}
+
+func TestCreateCore(t *testing.T) {
+	var app domain.ApplicationInterface
+
+	err := fx.ValidateApp(createCore(), fx.Populate(&app))
+	require.NoError(t, err)
+}
+
+func TestStorageCommandsWithoutRedis(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "users.backup")
+
+	t.Setenv("STORAGE", config.StorageBolt)
+	t.Setenv("CACHE_ENABLED", "true")
+	t.Setenv("BOLT_PATH", filepath.Join(dir, "users.db"))
+	require.Equal(t, 0, runCommand("backup", []string{"-output", backup}))
+
+	t.Setenv("BOLT_PATH", filepath.Join(dir, "restored.db"))
+	require.Equal(t, 0, runCommand("restore", []string{"-input", backup}))
+}
+
+func TestUnknownCommand(t *testing.T) {
+	require.Equal(t, 2, runCommand("unknown", nil))
+}
+
+func TestHealthcheck(t *testing.T) {
+	ready := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !ready {
+			http.Error(w, "Not ready", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("Ok"))
+	}))
+	defer server.Close()
+
+	require.Equal(t, 1, runCommand("healthcheck", []string{"-url", server.URL}))
+
+	ready = true
+	require.Equal(t, 0, runCommand("healthcheck", []string{"-url", server.URL}))
+
+	server.Close()
+	require.Equal(t, 1, runCommand("healthcheck", []string{"-url", server.URL}), "service not running")
+}
+
+func TestConfigCommand(t *testing.T) {
+	require.Equal(t, 0, runCommand("config", []string{"print"}))
+	require.Equal(t, 1, runCommand("config", nil))
+}
+
+func TestVersionCommand(t *testing.T) {
+	require.Equal(t, 0, runCommand("version", nil))
+}
+
+func TestUndecryptableUsersKeepTheBreakerClosed(t *testing.T) {
+	ctx := context.Background()
+	lc := fxtest.NewLifecycle(t)
+	cfg := &config.Config{
+		Storage: config.StorageBolt,
+		Bolt:    config.BoltConfig{Path: filepath.Join(t.TempDir(), "users.db"), Timeout: time.Second},
+		Resilience: config.ResilienceConfig{
+			Enabled: true, MaxAttempts: 1, BackoffBase: time.Millisecond, BackoffMax: time.Millisecond,
+			FailureThreshold: 2, OpenTimeout: time.Minute,
+		},
+		Encryption: config.EncryptionConfig{
+			Enabled:   true,
+			ActiveKey: "k1",
+			Keys:      map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))},
+			IndexKey:  base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", 32))),
+		},
+	}
+
+	bolt, err := driven.NewBoltStorage(lc, cfg)
+	require.NoError(t, err)
+
+	keys, err := driven.NewKeyRing(cfg)
+	require.NoError(t, err)
+
+	users, err := newUserStorage(lc, cfg, bolt, keys, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+
+	// sealed for another user, so it cannot be opened as this one
+	sealed, err := keys.Seal("name", uuid.NewString())
+	require.NoError(t, err)
+
+	broken := domain.User{ID: uuid.New(), Name: sealed}
+	require.NoError(t, bolt.Store(ctx, broken))
+
+	user := domain.User{ID: uuid.New(), Name: "name"}
+	require.NoError(t, users.Store(ctx, user))
+
+	for range cfg.Resilience.FailureThreshold + 1 {
+		_, err = users.Read(ctx, broken.ID.String())
+		require.Error(t, err)
+	}
+
+	read, err := users.Read(ctx, user.ID.String())
+	require.NoError(t, err)
+	require.Equal(t, user, read)
+}
+
+func TestTenantsNeedRedis(t *testing.T) {
+	cfg := &config.Config{Storage: config.StorageBolt, Tenant: config.TenantConfig{Enabled: true}}
+
+	_, err := openUserStorage(fxtest.NewLifecycle(t), cfg, nil)
+	require.Error(t, err)
+}
+
+func TestUnknownStorage(t *testing.T) {
+	_, err := openUserStorage(fxtest.NewLifecycle(t), &config.Config{Storage: "memcached"}, nil)
+	require.Error(t, err)
+}